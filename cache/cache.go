@@ -13,12 +13,39 @@ type CacheItem struct {
 	ExpiresAt time.Time
 }
 
+// NewCacheItem creates an item for the value that expires after ttl, or never
+// when ttl is not positive
+func NewCacheItem(key string, value []byte, ttl time.Duration) *CacheItem {
+	now := time.Now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	return &CacheItem{
+		Key:       key,
+		Value:     value,
+		Size:      len(value),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// isExpired checks if the item has a TTL that lapsed before now
+func (i *CacheItem) isExpired(now time.Time) bool {
+	return !i.ExpiresAt.IsZero() && now.After(i.ExpiresAt)
+}
+
 // Cache defines the interface for our caching mechanism
 type Cache interface {
 	// Get retrieves an item from the cache by key
 	// Returns the item and a boolean indicating if it was found
 	Get(key string) (*CacheItem, bool)
 
+	// Peek retrieves an unexpired item without marking it as recently used
+	// or counting it as a hit or miss
+	Peek(key string) (*CacheItem, bool)
+
 	// Set adds or updates an item in the cache
 	// Returns true if the item was added, false if it was updated
 	Set(key string, value []byte, ttl time.Duration) bool
@@ -36,17 +63,34 @@ type Cache interface {
 	// Capacity returns the maximum number of items the cache can hold
 	Capacity() int
 
+	// Keys returns the keys of all unexpired items, the ones the eviction
+	// policy would keep longest first
+	Keys() []string
+
 	// Stats returns statistics about the cache usage
 	Stats() CacheStats
+
+	// ResetStats zeroes the hit, miss and eviction counters, keeping all items
+	ResetStats()
 }
 
 // CacheStats contains statistics about cache usage
 type CacheStats struct {
-	Size      int     // Current number of items
-	Capacity  int     // Maximum number of items
-	Hits      int64   // Number of cache hits
-	Misses    int64   // Number of cache misses
-	HitRate   float64 // Hit rate (hits / (hits + misses))
-	Evictions int64   // Number of items evicted
-	AvgSize   int     // Average size of items in bytes
-}
\ No newline at end of file
+	Size         int     `json:"size"`          // Current number of items
+	Capacity     int     `json:"capacity"`      // Maximum number of items
+	Hits         int64   `json:"hits"`          // Number of cache hits
+	Misses       int64   `json:"misses"`        // Number of cache misses
+	HitRate      float64 `json:"hit_rate"`      // Hit rate (hits / (hits + misses))
+	Evictions    int64   `json:"evictions"`     // Number of items evicted
+	EvictionRuns int64   `json:"eviction_runs"` // Number of eviction passes
+	AvgSize      int     `json:"avg_size"`      // Average size of items in bytes
+	MaxBytes     int     `json:"max_bytes"`     // Total size limit in bytes, 0 means unlimited
+
+	// Hits by tier of a TieredCache, included in Hits
+	L1Hits int64 `json:"l1_hits,omitempty"` // Served by the local cache
+	L2Hits int64 `json:"l2_hits,omitempty"` // Served by the shared cache
+
+	// Entry format failures, tracked by the user of the cache
+	SerializationErrors   int64 `json:"serialization_errors"`   // Responses that could not be encoded for storage
+	DeserializationErrors int64 `json:"deserialization_errors"` // Stored entries that could not be decoded
+}
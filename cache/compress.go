@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Compression identifies the algorithm a cache value is compressed with
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+	CompressionLZ4
+)
+
+// compressionMarker starts every marked value and is followed by the algorithm
+// byte. Values stored without a marker are returned as they are, so entries
+// written before compression was enabled keep decoding.
+const compressionMarker = 0x00
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ParseCompression converts an algorithm name from configuration into a Compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "zstd":
+		return CompressionZstd, nil
+	case "lz4":
+		return CompressionLZ4, nil
+	}
+	return CompressionNone, fmt.Errorf("unknown compression algorithm: %q", name)
+}
+
+// String returns the configuration name of the algorithm
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionLZ4:
+		return "lz4"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(c))
+}
+
+// Compress compresses value with the given algorithm and marks it so that
+// Decompress can reverse it regardless of the algorithm configured later
+func Compress(value []byte, algo Compression) ([]byte, error) {
+	// Uncompressed values only need a marker if they could be mistaken for one
+	if algo == CompressionNone && (len(value) == 0 || value[0] != compressionMarker) {
+		return value, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(compressionMarker)
+	buf.WriteByte(byte(algo))
+
+	switch algo {
+	case CompressionNone:
+		buf.Write(value)
+	case CompressionGzip:
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(value); err != nil {
+			return nil, fmt.Errorf("error compressing with gzip: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("error compressing with gzip: %w", err)
+		}
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(value, buf.Bytes()), nil
+	case CompressionLZ4:
+		writer := lz4.NewWriter(&buf)
+		if _, err := writer.Write(value); err != nil {
+			return nil, fmt.Errorf("error compressing with lz4: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("error compressing with lz4: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %d", byte(algo))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress reverses Compress using the algorithm recorded in the value
+func Decompress(value []byte) ([]byte, error) {
+	if len(value) == 0 || value[0] != compressionMarker {
+		return value, nil
+	}
+	if len(value) < 2 {
+		return nil, fmt.Errorf("truncated compression marker")
+	}
+
+	payload := value[2:]
+	switch algo := Compression(value[1]); algo {
+	case CompressionNone:
+		return payload, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing gzip: %w", err)
+		}
+		defer reader.Close()
+		return readAll(reader, algo)
+	case CompressionZstd:
+		decoded, err := zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing zstd: %w", err)
+		}
+		return decoded, nil
+	case CompressionLZ4:
+		return readAll(lz4.NewReader(bytes.NewReader(payload)), algo)
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %d", byte(algo))
+	}
+}
+
+// readAll reads a whole decompression stream, wrapping errors with the algorithm name
+func readAll(reader io.Reader, algo Compression) ([]byte, error) {
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %s: %w", algo, err)
+	}
+	return decoded, nil
+}
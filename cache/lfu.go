@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lfuEntry tracks how often a cached item has been accessed
+type lfuEntry struct {
+	item    *CacheItem
+	freq    int
+	element *list.Element // Position within the list for freq
+}
+
+// LFUCache is a thread-safe cache that evicts the least frequently used item.
+// Items with the same access count are kept in recency order, so ties are
+// broken by evicting the least recently used of them.
+type LFUCache struct {
+	capacity     int
+	evictions    int64
+	evictionRuns int64
+	hits         int64
+	misses       int64
+	totalSize    int
+	items        map[string]*lfuEntry
+	freqs        map[int]*list.List // Entries per access count, most recent first
+	minFreq      int
+	mutex        sync.Mutex
+}
+
+// NewLFUCache creates a new LFU cache with the given capacity
+func NewLFUCache(capacity int) *LFUCache {
+	return &LFUCache{
+		capacity: capacity,
+		items:    make(map[string]*lfuEntry),
+		freqs:    make(map[int]*list.List),
+	}
+}
+
+// Get retrieves an item from the cache and counts the access
+func (c *LFUCache) Get(key string) (*CacheItem, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.items[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+
+	// Check if the item has expired
+	if entry.item.isExpired(time.Now()) {
+		c.evictEntry(entry)
+		c.misses++
+		return nil, false
+	}
+
+	c.touch(entry)
+	c.hits++
+	return entry.item, true
+}
+
+// Peek retrieves an item without counting the access or affecting the statistics
+func (c *LFUCache) Peek(key string) (*CacheItem, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.items[key]
+	if !exists || entry.item.isExpired(time.Now()) {
+		return nil, false
+	}
+	return entry.item, true
+}
+
+// Set adds or updates an item in the cache; updates count as an access
+func (c *LFUCache) Set(key string, value []byte, ttl time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	item := NewCacheItem(key, value, ttl)
+
+	// Update existing item
+	if entry, exists := c.items[key]; exists {
+		c.totalSize = c.totalSize - entry.item.Size + item.Size
+		entry.item = item
+		c.touch(entry)
+		return false
+	}
+
+	if c.capacity <= 0 {
+		return false
+	}
+
+	// Make room by evicting the least frequently used item
+	if len(c.items) >= c.capacity {
+		c.evictionRuns++
+		c.evictLeastFrequent()
+	}
+
+	// New items start with a single access
+	entry := &lfuEntry{item: item, freq: 1}
+	entry.element = c.frequencyList(1).PushFront(entry)
+	c.items[key] = entry
+	c.totalSize += item.Size
+	c.minFreq = 1
+	return true
+}
+
+// Remove deletes an item from the cache
+func (c *LFUCache) Remove(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, exists := c.items[key]; exists {
+		c.evictEntry(entry)
+		return true
+	}
+	return false
+}
+
+// Clear removes all items from the cache
+func (c *LFUCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.items = make(map[string]*lfuEntry)
+	c.freqs = make(map[int]*list.List)
+	c.minFreq = 0
+	c.totalSize = 0
+	// Don't reset statistics
+}
+
+// Size returns the current number of items in the cache
+func (c *LFUCache) Size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Capacity returns the maximum number of items the cache can hold
+func (c *LFUCache) Capacity() int {
+	return c.capacity
+}
+
+// Keys returns the keys of all unexpired items, most frequently used first
+func (c *LFUCache) Keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	freqs := make([]int, 0, len(c.freqs))
+	for freq := range c.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(freqs)))
+
+	now := time.Now()
+	keys := make([]string, 0, len(c.items))
+	for _, freq := range freqs {
+		for element := c.freqs[freq].Front(); element != nil; element = element.Next() {
+			item := element.Value.(*lfuEntry).item
+			if !item.isExpired(now) {
+				keys = append(keys, item.Key)
+			}
+		}
+	}
+	return keys
+}
+
+// ResetStats zeroes the hit, miss and eviction counters without touching items
+func (c *LFUCache) ResetStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.hits = 0
+	c.misses = 0
+	c.evictions = 0
+	c.evictionRuns = 0
+}
+
+// Stats returns statistics about the cache usage
+func (c *LFUCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	size := len(c.items)
+	total := c.hits + c.misses
+	hitRate := 0.0
+	avgSize := 0
+
+	if total > 0 {
+		hitRate = float64(c.hits) / float64(total)
+	}
+
+	if size > 0 {
+		avgSize = c.totalSize / size
+	}
+
+	return CacheStats{
+		Size:         size,
+		Capacity:     c.capacity,
+		Hits:         c.hits,
+		Misses:       c.misses,
+		HitRate:      hitRate,
+		Evictions:    c.evictions,
+		EvictionRuns: c.evictionRuns,
+		AvgSize:      avgSize,
+	}
+}
+
+// frequencyList returns the list for an access count, creating it if needed
+func (c *LFUCache) frequencyList(freq int) *list.List {
+	l, exists := c.freqs[freq]
+	if !exists {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+// unlink removes an entry from its frequency list, dropping the list once empty
+func (c *LFUCache) unlink(entry *lfuEntry) {
+	l := c.freqs[entry.freq]
+	l.Remove(entry.element)
+	if l.Len() == 0 {
+		delete(c.freqs, entry.freq)
+	}
+}
+
+// touch counts an access, moving the entry to the front of the next frequency
+func (c *LFUCache) touch(entry *lfuEntry) {
+	c.unlink(entry)
+	if c.minFreq == entry.freq && c.freqs[entry.freq] == nil {
+		c.minFreq++
+	}
+	entry.freq++
+	entry.element = c.frequencyList(entry.freq).PushFront(entry)
+}
+
+// evictLeastFrequent removes the least recently used of the least frequently
+// used items
+func (c *LFUCache) evictLeastFrequent() {
+	// minFreq may be stale after removals, so fall back to a scan
+	l, exists := c.freqs[c.minFreq]
+	if !exists {
+		c.minFreq = 0
+		for freq := range c.freqs {
+			if c.minFreq == 0 || freq < c.minFreq {
+				c.minFreq = freq
+			}
+		}
+		if l, exists = c.freqs[c.minFreq]; !exists {
+			return
+		}
+	}
+	c.evictEntry(l.Back().Value.(*lfuEntry))
+}
+
+// evictEntry removes an entry from the cache
+func (c *LFUCache) evictEntry(entry *lfuEntry) {
+	c.unlink(entry)
+	delete(c.items, entry.item.Key)
+	c.totalSize -= entry.item.Size
+	c.evictions++
+}
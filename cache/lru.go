@@ -2,103 +2,299 @@ package cache
 
 import (
 	"container/list"
+	"fmt"
+	"math"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// LRUCache is a thread-safe LRU cache implementation
+// LRUCache is a thread-safe LRU cache implementation. Hits on items that are
+// already among the most recently used quarter aren't moved to the front, so
+// that reads of hot items only take the read lock; the order among those items
+// is approximate, eviction from the back is not affected.
 type LRUCache struct {
-	capacity    int
-	evictions   int64
-	hits        int64
-	misses      int64
-	totalSize   int
-	items       map[string]*list.Element
+	capacity     int
+	highMark     int // Item count above which eviction kicks in
+	lowMark      int // Item count eviction brings the cache back down to
+	evictions    int64
+	evictionRuns int64
+	hits         atomic.Int64
+	misses       atomic.Int64
+	totalSize    int
+	maxBytes     int // Upper bound for totalSize, 0 means unlimited
+	items        map[string]*list.Element
 	evictionList *list.List
-	mutex       sync.RWMutex
+	mutex        sync.RWMutex
+
+	// clock counts moves to the front of the list; an item moved there less
+	// than promoteDistance moves ago is still near the front
+	clock           uint64
+	promoteDistance uint64
+
+	stop      chan struct{} // Closed to end the sweeper, nil without one
+	closeOnce sync.Once
+
+	fills fillGroup // In-progress GetOrSet fills
+
+	onEvict func(key string, item *CacheItem, reason EvictReason)
+	evicted []evictedItem // Evictions awaiting onEvict until the lock is released
+}
+
+// EvictReason tells why an item left the cache
+type EvictReason byte
+
+const (
+	EvictCapacity EvictReason = iota // Made room for other items
+	EvictTTL                         // Expired
+	EvictManual                      // Removed or cleared by a caller
+)
+
+// String returns the name of the reason
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictTTL:
+		return "ttl"
+	case EvictManual:
+		return "manual"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(r))
+}
+
+// evictedItem is an eviction to report to onEvict
+type evictedItem struct {
+	item   *CacheItem
+	reason EvictReason
+}
+
+// lruEntry is the list element value of a cached item
+type lruEntry struct {
+	item       *CacheItem
+	generation uint64 // Value of the clock when last moved to the front
+}
+
+// LRUOptions configures an LRUCache
+type LRUOptions struct {
+	Capacity int // Maximum number of items
+
+	// HighWatermark and LowWatermark are fractions of Capacity. Once the cache
+	// grows past the high watermark it is evicted down to the low watermark in
+	// a single pass; both default to 1, which evicts one item per insert.
+	HighWatermark float64
+	LowWatermark  float64
+
+	// MaxBytes bounds the total size of all values, 0 means unlimited
+	MaxBytes int
+
+	// SweepInterval is how often expired items are removed in the background,
+	// 0 leaves them in place until they are read
+	SweepInterval time.Duration
+
+	// OnEvict is called for every item leaving the cache other than by being
+	// replaced. It runs after the cache lock is released, so it may use the
+	// cache, but items may have changed again by the time it runs.
+	OnEvict func(key string, item *CacheItem, reason EvictReason)
 }
 
 // NewLRUCache creates a new LRU cache with the given capacity
 func NewLRUCache(capacity int) *LRUCache {
-	return &LRUCache{
-		capacity:    capacity,
-		items:       make(map[string]*list.Element),
+	return NewLRUCacheWithOptions(LRUOptions{Capacity: capacity})
+}
+
+// NewLRUCacheWithBytes creates a new LRU cache bounded by both item count and
+// total value size in bytes
+func NewLRUCacheWithBytes(maxItems, maxBytes int) *LRUCache {
+	return NewLRUCacheWithOptions(LRUOptions{Capacity: maxItems, MaxBytes: maxBytes})
+}
+
+// NewLRUCacheWithSweep creates a new LRU cache that removes expired items in
+// the background every interval; Close stops the sweeper
+func NewLRUCacheWithSweep(capacity int, interval time.Duration) *LRUCache {
+	return NewLRUCacheWithOptions(LRUOptions{Capacity: capacity, SweepInterval: interval})
+}
+
+// NewLRUCacheWithOptions creates a new LRU cache with the given options
+func NewLRUCacheWithOptions(opts LRUOptions) *LRUCache {
+	high := opts.HighWatermark
+	if high <= 0 || high > 1 {
+		high = 1
+	}
+	low := opts.LowWatermark
+	if low <= 0 || low > high {
+		low = high
+	}
+
+	// Batch eviction must leave at least the item just inserted
+	lowMark := max(int(math.Round(low*float64(opts.Capacity))), min(opts.Capacity, 1))
+
+	c := &LRUCache{
+		capacity:     opts.Capacity,
+		highMark:     max(int(math.Round(high*float64(opts.Capacity))), lowMark),
+		lowMark:      lowMark,
+		maxBytes:     opts.MaxBytes,
+		items:        make(map[string]*list.Element),
 		evictionList: list.New(),
+
+		promoteDistance: uint64(max(opts.Capacity, 0) / 4),
+		onEvict:         opts.OnEvict,
+	}
+
+	if opts.SweepInterval > 0 {
+		c.stop = make(chan struct{})
+		go c.sweep(opts.SweepInterval)
+	}
+	return c
+}
+
+// sweep removes expired items every interval until the cache is closed
+func (c *LRUCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.RemoveExpired()
+		case <-c.stop:
+			return
+		}
 	}
 }
 
+// RemoveExpired evicts all items past their expiration time and returns how
+// many were removed
+func (c *LRUCache) RemoveExpired() int {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	now := time.Now()
+	removed := 0
+	for element := c.evictionList.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*lruEntry).item.isExpired(now) {
+			c.evictElement(element, EvictTTL)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// Close stops the background sweeper, if any; it is safe to call more than once
+func (c *LRUCache) Close() {
+	if c.stop == nil {
+		return
+	}
+	c.closeOnce.Do(func() { close(c.stop) })
+}
+
 // Get retrieves an item from the cache
 func (c *LRUCache) Get(key string) (*CacheItem, bool) {
 	c.mutex.RLock()
 	element, exists := c.items[key]
-	c.mutex.RUnlock()
-
 	if !exists {
-		c.mutex.Lock()
-		c.misses++
-		c.mutex.Unlock()
+		c.mutex.RUnlock()
+		c.misses.Add(1)
 		return nil, false
 	}
+	entry := element.Value.(*lruEntry)
+	item := entry.item
+	expired := item.isExpired(time.Now())
+	nearFront := c.clock-entry.generation < c.promoteDistance
+	c.mutex.RUnlock()
 
-	item := element.Value.(*CacheItem)
+	// Hot items need no reordering and are served under the read lock alone
+	if !expired && nearFront {
+		c.hits.Add(1)
+		return item, true
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
 
-	// Check if the item has expired
-	if !item.ExpiresAt.IsZero() && time.Now().After(item.ExpiresAt) {
-		c.mutex.Lock()
-		c.evictElement(element)
-		c.misses++
-		c.mutex.Unlock()
+	// The item may have been replaced or removed while unlocked
+	current := c.items[key] == element && entry.item == item
+	if expired {
+		if current {
+			c.evictElement(element, EvictTTL)
+		}
+		c.misses.Add(1)
 		return nil, false
 	}
 
 	// Move to front (most recently used)
-	c.mutex.Lock()
-	c.evictionList.MoveToFront(element)
-	c.hits++
-	c.mutex.Unlock()
+	if current {
+		c.moveToFront(element)
+	}
+	c.hits.Add(1)
+	return item, true
+}
+
+// Peek retrieves an item without affecting its recency or the statistics
+func (c *LRUCache) Peek(key string) (*CacheItem, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	element, exists := c.items[key]
+	if !exists {
+		return nil, false
+	}
 
+	item := element.Value.(*lruEntry).item
+	if item.isExpired(time.Now()) {
+		return nil, false
+	}
 	return item, true
 }
 
 // Set adds or updates an item in the cache
 func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) bool {
+	return c.setItem(NewCacheItem(key, value, ttl))
+}
+
+// setItem adds or updates a prepared item in the cache
+func (c *LRUCache) setItem(item *CacheItem) bool {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
 
-	// Calculate expiration time
-	var expiresAt time.Time
-	if ttl > 0 {
-		expiresAt = time.Now().Add(ttl)
-	}
+	key := item.Key
 
-	// Create cache item
-	item := &CacheItem{
-		Key:       key,
-		Value:     value,
-		Size:      len(value),
-		CreatedAt: time.Now(),
-		ExpiresAt: expiresAt,
+	// A value that can never fit would evict everything else and then itself
+	if c.maxBytes > 0 && item.Size > c.maxBytes {
+		if element, exists := c.items[key]; exists {
+			c.evictElement(element, EvictCapacity)
+		}
+		return false
 	}
 
 	// Check if the key already exists
 	if element, exists := c.items[key]; exists {
 		// Update existing item
-		oldItem := element.Value.(*CacheItem)
-		c.totalSize = c.totalSize - oldItem.Size + item.Size
-		element.Value = item
-		c.evictionList.MoveToFront(element)
+		entry := element.Value.(*lruEntry)
+		c.totalSize = c.totalSize - entry.item.Size + item.Size
+		entry.item = item
+		c.moveToFront(element)
+		c.evictOverBytes()
 		return false
 	}
 
 	// Add new item
-	element := c.evictionList.PushFront(item)
+	c.clock++
+	element := c.evictionList.PushFront(&lruEntry{item: item, generation: c.clock})
 	c.items[key] = element
 	c.totalSize += item.Size
 
-	// Evict items if we're over capacity
-	for c.evictionList.Len() > c.capacity {
-		c.evictOldest()
+	// Evict items in one batch once we're over the high watermark
+	if c.evictionList.Len() > c.highMark {
+		c.evictionRuns++
+		for c.evictionList.Len() > c.lowMark {
+			c.evictOldest()
+		}
 	}
+	c.evictOverBytes()
 
 	return true
 }
@@ -106,25 +302,74 @@ func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) bool {
 // Remove deletes an item from the cache
 func (c *LRUCache) Remove(key string) bool {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
 
 	if element, exists := c.items[key]; exists {
-		return c.evictElement(element)
+		return c.evictElement(element, EvictManual)
 	}
 	return false
 }
 
+// RemoveMatching deletes every item whose key matches the predicate and
+// returns the number of items removed
+func (c *LRUCache) RemoveMatching(predicate func(key string) bool) int {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	removed := 0
+	for key, element := range c.items {
+		if predicate(key) {
+			c.evictElement(element, EvictManual)
+			removed++
+		}
+	}
+	return removed
+}
+
 // Clear removes all items from the cache
 func (c *LRUCache) Clear() {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
 
+	if c.onEvict != nil {
+		for element := c.evictionList.Front(); element != nil; element = element.Next() {
+			c.evicted = append(c.evicted, evictedItem{element.Value.(*lruEntry).item, EvictManual})
+		}
+	}
 	c.items = make(map[string]*list.Element)
 	c.evictionList = list.New()
 	c.totalSize = 0
 	// Don't reset statistics
 }
 
+// SoftClear expires all items at random points within the stagger window
+// instead of removing them at once, so the re-fetch load is spread out
+func (c *LRUCache) SoftClear(window time.Duration) {
+	if window <= 0 {
+		c.Clear()
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for element := c.evictionList.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*lruEntry)
+		expiresAt := now.Add(time.Duration(rand.Int64N(int64(window))))
+
+		// Keep items that would expire before their jittered deadline anyway
+		if !entry.item.ExpiresAt.IsZero() && entry.item.ExpiresAt.Before(expiresAt) {
+			continue
+		}
+
+		// Replace the item rather than mutating it, readers may still hold it
+		updated := *entry.item
+		updated.ExpiresAt = expiresAt
+		entry.item = &updated
+	}
+}
+
 // Size returns the current number of items in the cache
 func (c *LRUCache) Size() int {
 	c.mutex.RLock()
@@ -132,23 +377,52 @@ func (c *LRUCache) Size() int {
 	return c.evictionList.Len()
 }
 
+// Keys returns the keys of all unexpired items, most recently used first
+func (c *LRUCache) Keys() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, c.evictionList.Len())
+	for element := c.evictionList.Front(); element != nil; element = element.Next() {
+		item := element.Value.(*lruEntry).item
+		if item.isExpired(now) {
+			continue
+		}
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
 // Capacity returns the maximum number of items the cache can hold
 func (c *LRUCache) Capacity() int {
 	return c.capacity
 }
 
+// ResetStats zeroes the hit, miss and eviction counters without touching items
+func (c *LRUCache) ResetStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.evictions = 0
+	c.evictionRuns = 0
+}
+
 // Stats returns statistics about the cache usage
 func (c *LRUCache) Stats() CacheStats {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
 	size := c.evictionList.Len()
-	total := c.hits + c.misses
+	hits, misses := c.hits.Load(), c.misses.Load()
+	total := hits + misses
 	hitRate := 0.0
 	avgSize := 0
 
 	if total > 0 {
-		hitRate = float64(c.hits) / float64(total)
+		hitRate = float64(hits) / float64(total)
 	}
 
 	if size > 0 {
@@ -156,30 +430,62 @@ func (c *LRUCache) Stats() CacheStats {
 	}
 
 	return CacheStats{
-		Size:      size,
-		Capacity:  c.capacity,
-		Hits:      c.hits,
-		Misses:    c.misses,
-		HitRate:   hitRate,
-		Evictions: c.evictions,
-		AvgSize:   avgSize,
+		Size:         size,
+		Capacity:     c.capacity,
+		Hits:         hits,
+		Misses:       misses,
+		HitRate:      hitRate,
+		Evictions:    c.evictions,
+		EvictionRuns: c.evictionRuns,
+		AvgSize:      avgSize,
+		MaxBytes:     c.maxBytes,
+	}
+}
+
+// moveToFront marks an item as the most recently used
+func (c *LRUCache) moveToFront(element *list.Element) {
+	c.clock++
+	element.Value.(*lruEntry).generation = c.clock
+	c.evictionList.MoveToFront(element)
+}
+
+// evictOverBytes evicts least recently used items until the total size fits
+// the byte limit; the front item always fits on its own
+func (c *LRUCache) evictOverBytes() {
+	for c.maxBytes > 0 && c.totalSize > c.maxBytes {
+		c.evictOldest()
 	}
 }
 
 // evictOldest removes the least recently used item from the cache
 func (c *LRUCache) evictOldest() bool {
 	if element := c.evictionList.Back(); element != nil {
-		return c.evictElement(element)
+		return c.evictElement(element, EvictCapacity)
 	}
 	return false
 }
 
+// unlock releases the write lock, then reports the evictions made while
+// holding it to onEvict
+func (c *LRUCache) unlock() {
+	evicted := c.evicted
+	c.evicted = nil
+	c.mutex.Unlock()
+
+	for _, e := range evicted {
+		c.onEvict(e.item.Key, e.item, e.reason)
+	}
+}
+
 // evictElement removes an item from the cache
-func (c *LRUCache) evictElement(element *list.Element) bool {
-	item := element.Value.(*CacheItem)
+func (c *LRUCache) evictElement(element *list.Element, reason EvictReason) bool {
+	item := element.Value.(*lruEntry).item
+	if c.onEvict != nil {
+		c.evicted = append(c.evicted, evictedItem{item, reason})
+	}
 	c.evictionList.Remove(element)
 	delete(c.items, item.Key)
 	c.totalSize -= item.Size
 	c.evictions++
 	return true
-}
\ No newline at end of file
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedItem is the on-disk form of a cache item
+type persistedItem struct {
+	Key       string
+	Value     []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SaveToFile writes all unexpired items to the file, replacing it atomically
+func (c *LRUCache) SaveToFile(path string) error {
+	// Least recently used first, so loading them in order restores recency
+	c.mutex.RLock()
+	now := time.Now()
+	items := make([]persistedItem, 0, c.evictionList.Len())
+	for element := c.evictionList.Back(); element != nil; element = element.Prev() {
+		item := element.Value.(*lruEntry).item
+		if item.isExpired(now) {
+			continue
+		}
+		items = append(items, persistedItem{
+			Key:       item.Key,
+			Value:     item.Value,
+			CreatedAt: item.CreatedAt,
+			ExpiresAt: item.ExpiresAt,
+		})
+	}
+	c.mutex.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(writer).Encode(items); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error encoding cache file: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing cache file: %w", err)
+	}
+	return nil
+}
+
+// LoadFromFile restores items saved by SaveToFile with their original
+// expiration times; items that expired in the meantime are skipped
+func (c *LRUCache) LoadFromFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening cache file: %w", err)
+	}
+	defer file.Close()
+
+	var items []persistedItem
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&items); err != nil {
+		return fmt.Errorf("error decoding cache file: %w", err)
+	}
+
+	now := time.Now()
+	for _, saved := range items {
+		item := &CacheItem{
+			Key:       saved.Key,
+			Value:     saved.Value,
+			Size:      len(saved.Value),
+			CreatedAt: saved.CreatedAt,
+			ExpiresAt: saved.ExpiresAt,
+		}
+		if item.isExpired(now) {
+			continue
+		}
+		c.setItem(item)
+	}
+	return nil
+}
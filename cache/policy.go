@@ -0,0 +1,42 @@
+package cache
+
+import "fmt"
+
+// EvictionPolicy selects which item a full cache evicts
+type EvictionPolicy byte
+
+const (
+	PolicyLRU EvictionPolicy = iota // Least recently used
+	PolicyLFU                       // Least frequently used, ties broken by recency
+)
+
+// ParseEvictionPolicy converts a policy name from configuration into an EvictionPolicy
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "", "lru":
+		return PolicyLRU, nil
+	case "lfu":
+		return PolicyLFU, nil
+	}
+	return PolicyLRU, fmt.Errorf("unknown eviction policy: %q", name)
+}
+
+// String returns the configuration name of the policy
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(p))
+}
+
+// NewCacheWithPolicy creates a cache with the given capacity that evicts
+// according to the policy
+func NewCacheWithPolicy(capacity int, policy EvictionPolicy) Cache {
+	if policy == PolicyLFU {
+		return NewLFUCache(capacity)
+	}
+	return NewLRUCache(capacity)
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisHeaderSize is the length of the creation and expiration times stored
+// in front of every value
+const redisHeaderSize = 16
+
+// RedisOptions configures a RedisCache
+type RedisOptions struct {
+	Addr     string // Address of the Redis server as host:port
+	Password string // Empty when the server doesn't require authentication
+	DB       int    // Database number
+
+	// KeyPrefix is put in front of every key, so that instances sharing the
+	// cache agree on the keys and other data in the database is left alone
+	KeyPrefix string
+
+	// Capacity is only reported, Redis' own memory limit and maxmemory
+	// policy decide what is evicted
+	Capacity int
+
+	// Timeout bounds every Redis command, 0 means one second
+	Timeout time.Duration
+}
+
+// RedisCache is a cache kept in Redis, shared by every proxy instance that
+// points at the same server and key prefix. Expiration is left to Redis.
+type RedisCache struct {
+	client   *redis.Client
+	prefix   string
+	capacity int
+	timeout  time.Duration
+
+	// Counted per process, other instances keep their own
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewRedisCache creates a cache backed by the Redis server in the options.
+// Connections are made on demand; use Ping to check the server is reachable.
+func NewRedisCache(opts RedisOptions) *RedisCache {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	return &RedisCache{
+		client: redis.NewClient(&redis.Options{
+			Addr:         opts.Addr,
+			Password:     opts.Password,
+			DB:           opts.DB,
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		}),
+		prefix:   opts.KeyPrefix,
+		capacity: opts.Capacity,
+		timeout:  timeout,
+	}
+}
+
+// context returns the context a single Redis command runs under
+func (c *RedisCache) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// Ping checks that the Redis server can be reached
+func (c *RedisCache) Ping() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the connections to the Redis server
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// Get retrieves an item from the cache by key. Redis errors are logged and
+// reported as misses, so a failing server degrades to an empty cache.
+func (c *RedisCache) Get(key string) (*CacheItem, bool) {
+	item, found := c.Peek(key)
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return item, found
+}
+
+// Peek retrieves an unexpired item without counting it as a hit or miss
+func (c *RedisCache) Peek(key string) (*CacheItem, bool) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	}
+	if err != nil {
+		logging.Warnf("Error reading %q from redis: %v", key, err)
+		return nil, false
+	}
+
+	item, ok := decodeRedisItem(key, data)
+	if !ok {
+		logging.Warnf("Ignoring malformed redis cache entry %q", key)
+		return nil, false
+	}
+	if item.isExpired(time.Now()) {
+		return nil, false
+	}
+	return item, true
+}
+
+// Set adds or updates an item in the cache
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) bool {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	// Checking for the key in the same round trip is cheaper than having
+	// SET return the old value
+	item := NewCacheItem(key, value, ttl)
+	var exists *redis.IntCmd
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, c.prefix+key)
+		pipe.Set(ctx, c.prefix+key, encodeRedisItem(item), max(ttl, 0))
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Error writing %q to redis: %v", key, err)
+		return false
+	}
+	return exists.Val() == 0
+}
+
+// Remove deletes an item from the cache
+func (c *RedisCache) Remove(key string) bool {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	removed, err := c.client.Del(ctx, c.prefix+key).Result()
+	if err != nil {
+		logging.Warnf("Error removing %q from redis: %v", key, err)
+	}
+	return removed > 0
+}
+
+// Clear removes all items under the key prefix, leaving other data alone
+func (c *RedisCache) Clear() {
+	keys, err := c.scan()
+	if err != nil {
+		logging.Warnf("Error listing redis cache keys: %v", err)
+	}
+
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), 500)]
+		keys = keys[len(batch):]
+
+		ctx, cancel := c.context()
+		err := c.client.Del(ctx, batch...).Err()
+		cancel()
+		if err != nil {
+			logging.Warnf("Error clearing redis cache: %v", err)
+			return
+		}
+	}
+}
+
+// Size returns the number of items under the key prefix
+func (c *RedisCache) Size() int {
+	keys, err := c.scan()
+	if err != nil {
+		logging.Warnf("Error listing redis cache keys: %v", err)
+	}
+	return len(keys)
+}
+
+// Capacity returns the configured capacity of the cache
+func (c *RedisCache) Capacity() int {
+	return c.capacity
+}
+
+// Keys returns the keys of all items in no particular order, Redis doesn't
+// tell which ones it would evict first
+func (c *RedisCache) Keys() []string {
+	keys, err := c.scan()
+	if err != nil {
+		logging.Warnf("Error listing redis cache keys: %v", err)
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, c.prefix)
+	}
+	return keys
+}
+
+// Stats returns statistics about the cache usage; hits and misses are those
+// of this process only
+func (c *RedisCache) Stats() CacheStats {
+	hits, misses := c.hits.Load(), c.misses.Load()
+	hitRate := 0.0
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+
+	return CacheStats{
+		Size:     c.Size(),
+		Capacity: c.capacity,
+		Hits:     hits,
+		Misses:   misses,
+		HitRate:  hitRate,
+	}
+}
+
+// ResetStats zeroes the hit and miss counters
+func (c *RedisCache) ResetStats() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+}
+
+// scan returns the full Redis keys of all items under the prefix
+func (c *RedisCache) scan() ([]string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var keys []string
+	iter := c.client.Scan(ctx, 0, escapeGlob(c.prefix)+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// escapeGlob escapes the characters that are special in Redis match patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// encodeRedisItem stores an item's creation and expiration times in front of
+// its value, since Redis only keeps the remaining TTL
+func encodeRedisItem(item *CacheItem) []byte {
+	var expiresAt int64
+	if !item.ExpiresAt.IsZero() {
+		expiresAt = item.ExpiresAt.UnixNano()
+	}
+
+	data := make([]byte, redisHeaderSize+len(item.Value))
+	binary.BigEndian.PutUint64(data[0:8], uint64(item.CreatedAt.UnixNano()))
+	binary.BigEndian.PutUint64(data[8:16], uint64(expiresAt))
+	copy(data[redisHeaderSize:], item.Value)
+	return data
+}
+
+// decodeRedisItem reverses encodeRedisItem
+func decodeRedisItem(key string, data []byte) (*CacheItem, bool) {
+	if len(data) < redisHeaderSize {
+		return nil, false
+	}
+
+	item := &CacheItem{
+		Key:       key,
+		Value:     data[redisHeaderSize:],
+		Size:      len(data) - redisHeaderSize,
+		CreatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(data[0:8]))),
+	}
+	if expiresAt := int64(binary.BigEndian.Uint64(data[8:16])); expiresAt != 0 {
+		item.ExpiresAt = time.Unix(0, expiresAt)
+	}
+	return item, true
+}
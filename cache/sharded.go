@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"hash/maphash"
+	"time"
+)
+
+// ShardedLRUCache spreads keys over independent LRU caches, each with its own
+// lock, so that concurrent requests for different keys rarely contend.
+// Recency is tracked per shard: a full shard evicts its own least recently
+// used item even when another shard holds older ones.
+type ShardedLRUCache struct {
+	shards   []*LRUCache
+	seed     maphash.Seed
+	capacity int
+	maxBytes int
+}
+
+// NewShardedLRUCache creates a cache of the given capacity split evenly over
+// the given number of LRU shards
+func NewShardedLRUCache(capacity, shards int) *ShardedLRUCache {
+	return NewShardedLRUCacheWithOptions(LRUOptions{Capacity: capacity}, shards)
+}
+
+// NewShardedLRUCacheWithOptions creates a sharded cache whose shards share the
+// options; the capacity and byte limit are split evenly between them
+func NewShardedLRUCacheWithOptions(opts LRUOptions, shards int) *ShardedLRUCache {
+	if shards < 1 {
+		shards = 1
+	}
+	if opts.Capacity > 0 && shards > opts.Capacity {
+		shards = opts.Capacity
+	}
+
+	c := &ShardedLRUCache{
+		shards:   make([]*LRUCache, shards),
+		seed:     maphash.MakeSeed(),
+		capacity: opts.Capacity,
+		maxBytes: opts.MaxBytes,
+	}
+	for i := range c.shards {
+		shardOpts := opts
+		shardOpts.Capacity = splitEvenly(opts.Capacity, shards, i)
+		shardOpts.MaxBytes = splitEvenly(opts.MaxBytes, shards, i)
+		c.shards[i] = NewLRUCacheWithOptions(shardOpts)
+	}
+	return c
+}
+
+// splitEvenly returns the i-th of n parts of total, handing the remainder to
+// the first parts
+func splitEvenly(total, n, i int) int {
+	part := total / n
+	if i < total%n {
+		part++
+	}
+	return part
+}
+
+// shard returns the shard holding key
+func (c *ShardedLRUCache) shard(key string) *LRUCache {
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+// Get retrieves an item from the cache
+func (c *ShardedLRUCache) Get(key string) (*CacheItem, bool) {
+	return c.shard(key).Get(key)
+}
+
+// Peek retrieves an item without affecting its recency or the statistics
+func (c *ShardedLRUCache) Peek(key string) (*CacheItem, bool) {
+	return c.shard(key).Peek(key)
+}
+
+// Set adds or updates an item in the cache
+func (c *ShardedLRUCache) Set(key string, value []byte, ttl time.Duration) bool {
+	return c.shard(key).Set(key, value, ttl)
+}
+
+// Remove deletes an item from the cache
+func (c *ShardedLRUCache) Remove(key string) bool {
+	return c.shard(key).Remove(key)
+}
+
+// Clear removes all items from the cache
+func (c *ShardedLRUCache) Clear() {
+	for _, shard := range c.shards {
+		shard.Clear()
+	}
+}
+
+// SoftClear expires the items of every shard within the stagger window
+func (c *ShardedLRUCache) SoftClear(window time.Duration) {
+	for _, shard := range c.shards {
+		shard.SoftClear(window)
+	}
+}
+
+// Close stops the shards' background sweepers, if any
+func (c *ShardedLRUCache) Close() {
+	for _, shard := range c.shards {
+		shard.Close()
+	}
+}
+
+// Size returns the current number of items in the cache
+func (c *ShardedLRUCache) Size() int {
+	size := 0
+	for _, shard := range c.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+// Capacity returns the maximum number of items the cache can hold
+func (c *ShardedLRUCache) Capacity() int {
+	return c.capacity
+}
+
+// Keys returns the keys of all unexpired items. The shards' keys are
+// interleaved, most recently used first within each shard, since recency
+// isn't comparable across shards.
+func (c *ShardedLRUCache) Keys() []string {
+	perShard := make([][]string, len(c.shards))
+	total := 0
+	for i, shard := range c.shards {
+		perShard[i] = shard.Keys()
+		total += len(perShard[i])
+	}
+
+	keys := make([]string, 0, total)
+	for rank := 0; len(keys) < total; rank++ {
+		for _, shardKeys := range perShard {
+			if rank < len(shardKeys) {
+				keys = append(keys, shardKeys[rank])
+			}
+		}
+	}
+	return keys
+}
+
+// ResetStats zeroes the hit, miss and eviction counters of every shard
+func (c *ShardedLRUCache) ResetStats() {
+	for _, shard := range c.shards {
+		shard.ResetStats()
+	}
+}
+
+// Stats returns statistics about the cache usage, summed over all shards
+func (c *ShardedLRUCache) Stats() CacheStats {
+	stats := CacheStats{Capacity: c.capacity, MaxBytes: c.maxBytes}
+	totalSize := 0
+	for _, shard := range c.shards {
+		shardStats := shard.Stats()
+		stats.Size += shardStats.Size
+		stats.Hits += shardStats.Hits
+		stats.Misses += shardStats.Misses
+		stats.Evictions += shardStats.Evictions
+		stats.EvictionRuns += shardStats.EvictionRuns
+
+		shard.mutex.RLock()
+		totalSize += shard.totalSize
+		shard.mutex.RUnlock()
+	}
+
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	if stats.Size > 0 {
+		stats.AvgSize = totalSize / stats.Size
+	}
+	return stats
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errFillAborted is returned to waiters when the fill they were waiting on
+// panicked instead of returning
+var errFillAborted = errors.New("cache fill aborted")
+
+// fillCall is an in-progress fill that concurrent callers wait on
+type fillCall struct {
+	done chan struct{}
+	item *CacheItem
+	err  error
+}
+
+// fillGroup makes sure only one fill runs per key at a time
+type fillGroup struct {
+	calls map[string]*fillCall
+	mutex sync.Mutex
+}
+
+// do runs fill unless one is already running for the key, in which case it
+// waits for that one and shares its result
+func (g *fillGroup) do(key string, fill func() (*CacheItem, error)) (*CacheItem, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*fillCall)
+	}
+	if call, exists := g.calls[key]; exists {
+		g.mutex.Unlock()
+		<-call.done
+		return call.item, call.err
+	}
+	call := &fillCall{done: make(chan struct{}), err: errFillAborted}
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	// Forget the call once it's done, so a failure isn't handed to later callers
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(call.done)
+	}()
+
+	call.item, call.err = fill()
+	return call.item, call.err
+}
+
+// GetOrSet returns the cached item for the key, or runs fill and caches its
+// value for ttl. Concurrent callers missing the same key share a single fill;
+// an error is returned to all of them and nothing is cached.
+func (c *LRUCache) GetOrSet(key string, ttl time.Duration, fill func() ([]byte, error)) (*CacheItem, error) {
+	if item, found := c.Get(key); found {
+		return item, nil
+	}
+
+	return c.fills.do(key, func() (*CacheItem, error) {
+		// Another fill may have completed between the miss and getting here
+		if item, found := c.Peek(key); found {
+			return item, nil
+		}
+
+		value, err := fill()
+		if err != nil {
+			return nil, err
+		}
+		item := NewCacheItem(key, value, ttl)
+		c.setItem(item)
+		return item, nil
+	})
+}
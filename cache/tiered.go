@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TieredCache checks a fast local cache before a slower shared one, copying
+// items found only in the shared cache into the local one.
+//
+// The tiers are not kept coherent: once an item is in the local cache it is
+// served from there until it expires or is evicted, even if another instance
+// has since replaced or removed it in the shared cache. Keep the local cache
+// small or its TTLs short where that matters.
+type TieredCache struct {
+	l1 Cache // Local, checked first
+	l2 Cache // Shared, the source of truth for size and keys
+
+	l1Hits atomic.Int64
+	l2Hits atomic.Int64
+	misses atomic.Int64
+}
+
+// NewTieredCache creates a cache that reads from l1 before l2 and writes to both
+func NewTieredCache(l1, l2 Cache) *TieredCache {
+	return &TieredCache{l1: l1, l2: l2}
+}
+
+// Get retrieves an item from the first tier that has it
+func (c *TieredCache) Get(key string) (*CacheItem, bool) {
+	if item, found := c.l1.Get(key); found {
+		c.l1Hits.Add(1)
+		return item, true
+	}
+
+	item, found := c.l2.Get(key)
+	if !found {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.l2Hits.Add(1)
+
+	// Keep the local copy no longer than the shared one
+	ttl := time.Duration(0)
+	if !item.ExpiresAt.IsZero() {
+		if ttl = time.Until(item.ExpiresAt); ttl <= 0 {
+			return item, true
+		}
+	}
+	c.l1.Set(key, item.Value, ttl)
+	return item, true
+}
+
+// Peek retrieves an unexpired item from the first tier that has it, without
+// copying it into the local cache
+func (c *TieredCache) Peek(key string) (*CacheItem, bool) {
+	if item, found := c.l1.Peek(key); found {
+		return item, true
+	}
+	return c.l2.Peek(key)
+}
+
+// Set adds or updates an item in both tiers and reports whether it was new
+// to the shared one
+func (c *TieredCache) Set(key string, value []byte, ttl time.Duration) bool {
+	c.l1.Set(key, value, ttl)
+	return c.l2.Set(key, value, ttl)
+}
+
+// Remove deletes an item from both tiers
+func (c *TieredCache) Remove(key string) bool {
+	removedL1 := c.l1.Remove(key)
+	removedL2 := c.l2.Remove(key)
+	return removedL1 || removedL2
+}
+
+// Clear removes all items from both tiers
+func (c *TieredCache) Clear() {
+	c.l1.Clear()
+	c.l2.Clear()
+}
+
+// Size returns the number of items in the shared cache
+func (c *TieredCache) Size() int {
+	return c.l2.Size()
+}
+
+// Capacity returns the capacity of the shared cache
+func (c *TieredCache) Capacity() int {
+	return c.l2.Capacity()
+}
+
+// Keys returns the keys of the shared cache
+func (c *TieredCache) Keys() []string {
+	return c.l2.Keys()
+}
+
+// Stats returns the statistics of the shared cache, with hits and misses
+// counted across both tiers
+func (c *TieredCache) Stats() CacheStats {
+	stats := c.l2.Stats()
+	l1Hits, l2Hits, misses := c.l1Hits.Load(), c.l2Hits.Load(), c.misses.Load()
+
+	stats.Hits = l1Hits + l2Hits
+	stats.Misses = misses
+	stats.L1Hits = l1Hits
+	stats.L2Hits = l2Hits
+	stats.HitRate = 0
+	if total := stats.Hits + misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// ResetStats zeroes the counters of both tiers
+func (c *TieredCache) ResetStats() {
+	c.l1.ResetStats()
+	c.l2.ResetStats()
+	c.l1Hits.Store(0)
+	c.l2Hits.Store(0)
+	c.misses.Store(0)
+}
@@ -1,11 +1,21 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Config holds all configuration settings for the proxy server
@@ -17,19 +27,434 @@ type Config struct {
 	WriteTimeout   int      `json:"write_timeout"`   // In seconds
 	IdleTimeout    int      `json:"idle_timeout"`    // In seconds
 	MaxHeaderBytes int      `json:"max_header_bytes"`
+	WriteBufferSize int     `json:"write_buffer_size"` // Bytes of response body buffered per write, 0 disables
+	
+	// Listener TLS settings, the server speaks plain HTTP unless both files are set
+	TLSCertFile   string `json:"tls_cert_file"`   // PEM certificate chain served to clients
+	TLSKeyFile    string `json:"tls_key_file"`    // PEM private key of the certificate
+	TLSMinVersion string `json:"tls_min_version"` // Oldest TLS version accepted from clients
+	
+	// Shutdown settings
+	ShutdownTimeout          int `json:"shutdown_timeout"`           // Seconds in-flight requests get to complete
+	ShutdownProgressInterval int `json:"shutdown_progress_interval"` // Seconds between drain progress logs
 	
 	// Cache settings
 	CacheSize      int      `json:"cache_size"`      // Number of items
+	CacheMaxBytes  int      `json:"cache_max_bytes"` // Total size of cached values, 0 means unlimited
 	CacheTTL       int      `json:"cache_ttl"`       // Time to live in seconds
+	MinCacheTTL    int      `json:"min_cache_ttl"`   // Lower bound for computed TTLs in seconds, 0 disables
+	MaxCacheTTL    int      `json:"max_cache_ttl"`   // Upper bound for computed TTLs in seconds, 0 disables
+	CacheTTLJitter float64 `json:"cache_ttl_jitter"` // Fraction each TTL is randomly shortened or lengthened by so entries stored together don't expire together, 0 disables
+	CacheKeySalt   string   `json:"cache_key_salt"`  // Changing it makes previously cached entries unreachable
+	CacheablePOST  bool     `json:"cacheable_post"`  // Cache POST responses keyed by a hash of the body; only safe for read-only endpoints
+	LastModifiedFraction float64 `json:"last_modified_fraction"` // TTL as a fraction of the Last-Modified age when no explicit freshness is given, 0 disables
+	RevalidateWindow int `json:"revalidate_window"` // Seconds stale entries with an ETag or Last-Modified are kept for conditional revalidation, 0 disables
+	NegativeCacheTTL int `json:"negative_cache_ttl"` // Seconds 404 and 410 responses are cached for, 0 disables
+	CacheHighWatermark float64 `json:"cache_high_watermark"` // Fraction of capacity that triggers batch eviction
+	CacheLowWatermark  float64 `json:"cache_low_watermark"`  // Fraction of capacity batch eviction brings the cache down to
+	CacheCompression   string  `json:"cache_compression"`    // Algorithm for new cache entries: none, gzip, zstd or lz4
+	CacheGzipMinSize   int     `json:"cache_gzip_min_size"`  // Bodies of compressible responses at least this many bytes are stored gzipped and served as is to gzip clients, 0 disables
+	CacheSweepInterval int     `json:"cache_sweep_interval"` // Seconds between background removals of expired entries, 0 disables
+	CacheSoftClearWindow int   `json:"cache_soft_clear_window"` // Seconds over which POST /admin/cache/clear staggers expirations, 0 clears at once
+	CacheEvictionPolicy string `json:"cache_eviction_policy"` // Which entry a full cache evicts: lru or lfu
+	CacheShards        int     `json:"cache_shards"`         // Independently locked LRU shards the cache is split into, 1 disables sharding
+	CacheBackend       string  `json:"cache_backend"`        // Where entries are kept: memory, redis to share them between instances, or tiered for memory in front of redis
+	RedisAddr          string  `json:"redis_addr"`           // Address of the Redis server as host:port
+	RedisPassword      string  `json:"redis_password"`       // Empty when the Redis server doesn't require authentication
+	RedisDB            int     `json:"redis_db"`             // Redis database number
+	RedisKeyPrefix     string  `json:"redis_key_prefix"`     // Prefix of cache keys in Redis; instances sharing a cache must agree on it
+	CacheFile          string  `json:"cache_file"`           // Cache contents are saved here on shutdown and restored at startup, empty disables
+	
+	// CacheHitHeaders are added to cache hits only; values may reference entry
+	// metadata through the {age}, {created_at}, {expires_at} and {size} placeholders
+	CacheHitHeaders map[string]string `json:"cache_hit_headers"`
+	
+	// Cache bypass settings
+	CacheBypassPeers []string `json:"cache_bypass_peers"` // IPs/CIDRs whose requests never read from the cache
+	CacheBypassStore bool     `json:"cache_bypass_store"` // Whether responses to bypassing clients are still cached
+	
+	// CacheKeyNormalization rules normalize request paths in cache keys only,
+	// the first rule matching the host applies
+	CacheKeyNormalization []PathNormalizationRule `json:"cache_key_normalization"`
+	
+	MaxConcurrentRefreshes int `json:"max_concurrent_refreshes"` // Background refreshes allowed at once, excess ones are dropped
 	
 	// Proxy settings
 	ProxyTimeout   int      `json:"proxy_timeout"`   // In seconds
+	MaxRedirects   int      `json:"max_redirects"`   // Upstream redirects followed; 0 returns them to the client, negative follows up to RedirectCap
 	AllowedDomains []string `json:"allowed_domains"` // Empty means all domains are allowed
+	AllowedDomainsExact bool `json:"allowed_domains_exact"` // Plain entries match only that host, not its subdomains
+	BlockedDomains []string `json:"blocked_domains"` // Always rejected, even when allowed; entries match like allowed_domains
 	MaxConnections int      `json:"max_connections"` // Maximum concurrent connections
+	QueueTimeout   int      `json:"queue_timeout"`   // Max seconds a request waits for a worker, 0 waits for the request deadline
+	MinWorkers        int   `json:"min_workers"`         // Workers kept when idle, more are added up to max_connections while requests queue up; 0 always runs max_connections
+	WorkerIdleTimeout int   `json:"worker_idle_timeout"` // Seconds after which idle workers above min_workers retire
+	QueueFullTimeout int    `json:"queue_full_timeout"` // Max milliseconds a request waits for room in a full queue before a 503, 0 waits up to queue_timeout
+	RequestTimeout int      `json:"request_timeout"` // Max seconds to serve a request before answering 503, 0 disables
+	MaxResponseBytes  int64 `json:"max_response_bytes"`  // Larger upstream bodies are answered with 502, 0 means unlimited
+	MaxCacheableBytes int64 `json:"max_cacheable_bytes"` // Larger bodies are proxied but not cached, 0 means unlimited
+	MaxRetries   int `json:"max_retries"`   // Retries of GET and HEAD requests after timeouts or 502/503/504, 0 disables
+	RetryBackoff int `json:"retry_backoff"` // Milliseconds before the first retry, doubling with each one
+	RateLimitMode     string `json:"rate_limit_mode"`      // "reject" or "delay" requests over the rate limit
+	RateLimitMaxDelay int    `json:"rate_limit_max_delay"` // Max milliseconds a request is delayed in delay mode
+	
+	// TrustProxyHeaders rate limits, filters and matches cache bypass peers by the IP
+	// in X-Forwarded-For or X-Real-IP; only enable it behind a load balancer that sets them
+	TrustProxyHeaders bool     `json:"trust_proxy_headers"`
+	TrustedProxies    []string `json:"trusted_proxies"` // IPs/CIDRs of the load balancers whose headers are trusted, empty trusts every peer
+	
+	// Client IP filtering, applied before anything is proxied
+	AllowedClientIPs []string `json:"allowed_client_ips"` // IPs/CIDRs of the clients that may use the proxy, empty allows all
+	BlockedClientIPs []string `json:"blocked_client_ips"` // IPs/CIDRs always rejected, even when allowed
+	
+	// Per-client state such as rate limit buckets is reclaimed after being idle
+	ClientIdleTimeout     int `json:"client_idle_timeout"`     // In seconds
+	ClientCleanupInterval int `json:"client_cleanup_interval"` // Seconds between sweeps for idle clients
+	
+	// TunnelAllUpgrades tunnels every Connection: Upgrade request like WebSockets
+	// instead of rejecting non-WebSocket protocols with 501 Not Implemented
+	TunnelAllUpgrades bool `json:"tunnel_all_upgrades"`
+	MaxTunnels        int  `json:"max_tunnels"`        // Concurrent tunnels across all clients, 0 means unlimited
+	MaxTunnelsPerIP   int  `json:"max_tunnels_per_ip"` // Concurrent tunnels per client IP, 0 means unlimited
+	
+	// UpstreamAcceptEncoding overrides the Accept-Encoding sent upstream: empty
+	// passes the client's through, "identity" or "gzip" always request that encoding
+	UpstreamAcceptEncoding string `json:"upstream_accept_encoding"`
+	
+	// FallbackResponses replace matching upstream error responses with a static
+	// response; the first rule matching the host and status wins
+	FallbackResponses []FallbackRule `json:"fallback_responses"`
+	
+	// Load shedding settings
+	ShedThreshold        float64 `json:"shed_threshold"`          // Load pressure (0-1) at which new requests are shed, 0 disables
+	ShedFraction         float64 `json:"shed_fraction"`           // Share of normal priority requests shed; low priority always is, high never
+	ShedRetryAfter       int     `json:"shed_retry_after"`        // Retry-After seconds sent with shed responses and full queue rejections
+	ShedMaxInflightBytes int64   `json:"shed_max_inflight_bytes"` // Buffered response bytes counted as full pressure, 0 ignores them
+	
+	// CookieStripRules remove Set-Cookie headers from matching responses, which
+	// then become cacheable; the first rule matching the host and path applies
+	CookieStripRules []CookieStripRule `json:"cookie_strip_rules"`
+	
+	// HeaderRules rewrite the headers of upstream requests and their responses;
+	// every rule matching the host applies, in order
+	HeaderRules []HeaderRule `json:"header_rules"`
+	
+	// PathRewrites change the path of requests before they are looked up in the
+	// cache and forwarded; the first rule matching the host and path applies
+	PathRewrites []PathRewriteRule `json:"path_rewrites"`
+	
+	// NegativeCache opts in to briefly caching upstream 5xx responses; the first
+	// rule matching the host and status sets the TTL. 404 and 410 responses are
+	// covered by NegativeCacheTTL instead.
+	NegativeCache []NegativeCacheRule `json:"negative_cache"`
+	
+	// DomainOverrides adjust caching for upstream domains; the first override
+	// matching the host applies, global settings cover the rest
+	DomainOverrides []DomainOverride `json:"domain_overrides"`
+	
+	// Body checksum settings, verifying Content-MD5 and Digest (MD5, SHA-256) headers
+	VerifyBodyChecksum   bool     `json:"verify_body_checksum"`
+	ChecksumContentTypes []string `json:"checksum_content_types"` // Media types to verify, all when both lists are empty
+	ChecksumPaths        []string `json:"checksum_paths"`         // Target path prefixes to verify
+	ChecksumMaxBytes     int64    `json:"checksum_max_bytes"`     // Larger bodies are rejected with 413 instead of buffered, 0 means unlimited
+	
+	// Deduplication settings
+	DedupInFlight       bool `json:"dedup_in_flight"`       // Collapse identical in-flight requests carrying an Idempotency-Key
+	CollapseCacheMisses bool `json:"collapse_cache_misses"` // Let concurrent misses for the same cache entry share one upstream fetch
+	DedupWaitTimeout    int  `json:"dedup_wait_timeout"`    // Max seconds a duplicate waits for the in-flight request
+	
+	// UpstreamProxyURL routes forwarded requests through another proxy, given as
+	// http://, https:// or socks5:// URL with optional user:password@
+	// credentials; empty honors the HTTP_PROXY environment variables. CONNECT
+	// tunnels always dial their target directly.
+	UpstreamProxyURL string `json:"upstream_proxy_url"`
+	
+	// Upstream connection pool settings
+	MaxIdleConns        int `json:"max_idle_conns"`          // Idle upstream connections kept across all hosts, 0 means unlimited
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"` // Idle upstream connections kept per host, 0 means 2
+	MaxConnsPerHost     int `json:"max_conns_per_host"`      // Open upstream connections per host, 0 means unlimited
+	IdleConnTimeout     int `json:"idle_conn_timeout"`       // Seconds an idle upstream connection is kept, 0 keeps it forever
+	TLSHandshakeTimeout int `json:"tls_handshake_timeout"`   // Max seconds for an upstream TLS handshake, 0 means no limit
+	
+	// Upstream TLS settings
+	UpstreamCAFile        string `json:"upstream_ca_file"`          // PEM bundle of extra CAs trusted for upstreams
+	TLSWarnMinVersion     string `json:"tls_warn_min_version"`      // Warn when an upstream negotiates an older TLS version
+	TLSCertExpiryWarnDays int    `json:"tls_cert_expiry_warn_days"` // Warn when an upstream certificate expires sooner, 0 disables
+	
+	// Priority settings
+	PriorityHeader    string   `json:"priority_header"`     // Request header carrying a high/normal/low priority
+	HighPriorityPaths []string `json:"high_priority_paths"` // Path prefixes always served with high priority
+	
+	// Compression settings
+	CompressBypassHeader string   `json:"compress_bypass_header"` // Skip compression when this request header is present
+	CompressTrustedPeers []string `json:"compress_trusted_peers"` // IPs/CIDRs whose requests are never compressed
+	GzipMinSize          int      `json:"gzip_min_size"`          // Smaller response bodies are sent uncompressed, 0 compresses all
+	
+	// DecompressRequests decodes gzip request bodies before forwarding them,
+	// for upstreams that don't accept Content-Encoding on requests
+	DecompressRequests   bool  `json:"decompress_requests"`
+	MaxDecompressedBytes int64 `json:"max_decompressed_bytes"` // Larger decoded bodies are rejected with 413, 0 means unlimited
+	
+	// AuthUsers require clients to authenticate with one of these usernames,
+	// mapped to bcrypt password hashes; empty leaves the proxy open to all
+	AuthUsers map[string]string `json:"auth_users"`
+	AuthRealm string            `json:"auth_realm"` // Realm sent in authentication challenges
+	
+	// Admin settings
+	AdminToken string `json:"admin_token"` // Bearer token for /admin/ endpoints, empty allows loopback clients only
+	EnablePprof bool  `json:"enable_pprof"` // Serve runtime profiles under /debug/pprof/ to the clients allowed on /admin/
+	AdminHost  string `json:"admin_host"` // Interface the admin listener binds to
+	AdminPort  int    `json:"admin_port"` // Port of a separate listener for the health, stats, metrics and admin endpoints, 0 serves them on the proxy port
+	
+	// Health check settings, answered by the proxy itself; empty disables
+	HealthPath string `json:"health_path"` // Liveness probe
+	ReadyPath  string `json:"ready_path"`  // Readiness probe, 503 while the worker pool isn't accepting requests
+	
+	MetricsEnabled bool `json:"metrics_enabled"` // Record Prometheus metrics and serve them at /metrics
+	
+	// Middleware lists the middleware wrapping the proxy, outermost first, out
+	// of MiddlewareNames; empty uses DefaultMiddleware
+	Middleware []string `json:"middleware"`
 	
 	// Logging settings
-	LogLevel       string   `json:"log_level"`
-	LogFile        string   `json:"log_file"`
+	LogLevel       string   `json:"log_level"` // debug, info, warn or error
+	LogFile        string   `json:"log_file"`  // Messages are appended here instead of stderr, empty disables
+	LogFormat      string   `json:"log_format"` // text, or json for one object per message
+	
+	ConfigFile string `json:"-"` // File given by --config, re-read on SIGHUP
+}
+
+// RedirectCap is the most upstream redirects followed, even when MaxRedirects
+// asks for no limit, so redirect loops still end
+const RedirectCap = 100
+
+// MiddlewareNames are the middleware that can be listed in Config.Middleware
+var MiddlewareNames = []string{
+	"recover", "request_id", "logger", "request_timer", "ip_filter", "auth", "metrics",
+	"buffer", "compress", "cors", "security_headers", "rate_limit", "decompress_requests", "timeout",
+}
+
+// DefaultMiddleware is the middleware order used when none is configured
+var DefaultMiddleware = []string{
+	"request_id", "logger", "ip_filter", "auth", "metrics", "buffer", "compress", "cors", "rate_limit",
+	"decompress_requests", "timeout",
+}
+
+// sensitiveKeys are the json keys of settings hidden from config dumps
+var sensitiveKeys = []string{"admin_token", "auth_users", "cache_key_salt", "redis_password", "tls_key_file", "upstream_proxy_url"}
+
+// RedactedJSON encodes the configuration as JSON with sensitive settings masked
+func (c *Config) RedactedJSON() ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding config: %w", err)
+	}
+	
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+	
+	// Not only strings, auth_users maps usernames to password hashes
+	for _, key := range sensitiveKeys {
+		if !isEmptyJSON(fields[key]) {
+			fields[key] = "[REDACTED]"
+		}
+	}
+	
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+// isEmptyJSON checks if a decoded JSON value is null, an empty string or an
+// empty object or array
+func isEmptyJSON(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// FallbackRule maps a range of upstream status codes for a host to a static response
+type FallbackRule struct {
+	Host        string `json:"host"`         // Upstream host name, empty matches every host
+	MinStatus   int    `json:"min_status"`   // First upstream status code the rule applies to
+	MaxStatus   int    `json:"max_status"`   // Last upstream status code, 0 means MinStatus only
+	StatusCode  int    `json:"status_code"`  // Status code sent to the client
+	Body        string `json:"body"`
+	ContentType string `json:"content_type"` // Defaults to text/plain
+}
+
+// Matches reports whether the rule applies to an upstream response from host with status
+func (f FallbackRule) Matches(host string, status int) bool {
+	if f.Host != "" && !strings.EqualFold(f.Host, host) {
+		return false
+	}
+	maxStatus := f.MaxStatus
+	if maxStatus == 0 {
+		maxStatus = f.MinStatus
+	}
+	return status >= f.MinStatus && status <= maxStatus
+}
+
+// PathNormalizationRule selects how a host's paths are normalized in cache keys
+type PathNormalizationRule struct {
+	Host               string `json:"host"`                 // Upstream host name, empty matches every host
+	StripTrailingSlash bool   `json:"strip_trailing_slash"` // Key /path/ and /path alike
+	LowercasePath      bool   `json:"lowercase_path"`       // Key paths case-insensitively
+}
+
+// Normalize applies the rule to a path
+func (n PathNormalizationRule) Normalize(path string) string {
+	if n.StripTrailingSlash {
+		path = strings.TrimRight(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+	if n.LowercasePath {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// CookieStripRule selects the cookies stripped from a host's responses
+type CookieStripRule struct {
+	Host       string   `json:"host"`        // Upstream host name, required
+	PathPrefix string   `json:"path_prefix"` // Empty matches every path
+	Cookies    []string `json:"cookies"`     // Cookie names to strip, empty strips all
+}
+
+// Matches reports whether the rule applies to a request for host and path
+func (c CookieStripRule) Matches(host, path string) bool {
+	return strings.EqualFold(c.Host, host) && strings.HasPrefix(path, c.PathPrefix)
+}
+
+// Strips reports whether the rule strips the named cookie
+func (c CookieStripRule) Strips(name string) bool {
+	if len(c.Cookies) == 0 {
+		return true
+	}
+	for _, cookie := range c.Cookies {
+		if cookie == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderRule injects, overrides and strips headers on the way to and from a
+// domain. Removals are applied before additions.
+type HeaderRule struct {
+	Domain                string            `json:"domain"`                  // Matched like allowed_domains, empty matches every host
+	AddRequestHeaders     map[string]string `json:"add_request_headers"`     // Set on the upstream request, replacing client values
+	RemoveRequestHeaders  []string          `json:"remove_request_headers"`  // Dropped from the upstream request
+	AddResponseHeaders    map[string]string `json:"add_response_headers"`    // Set on the response, replacing upstream values
+	RemoveResponseHeaders []string          `json:"remove_response_headers"` // Dropped from the response
+}
+
+// Matches reports whether the rule applies to host, which must not carry a port
+func (h HeaderRule) Matches(host string) bool {
+	return h.Domain == "" || MatchDomain(h.Domain, host, false)
+}
+
+// PathRewriteRule rewrites the paths of requests to a domain. The prefix is
+// stripped first, then the expression replaced, then the prefix added.
+type PathRewriteRule struct {
+	Domain      string `json:"domain"`       // Matched like allowed_domains, empty matches every host
+	StripPrefix string `json:"strip_prefix"` // Path prefix removed, the rule only applies to paths under it
+	Match       string `json:"match"`        // Regular expression replaced in the path, the rule only applies to paths it matches
+	Replace     string `json:"replace"`      // Replacement for match, may refer to groups as $1
+	AddPrefix   string `json:"add_prefix"`   // Path prefix added
+}
+
+// DomainOverride replaces global cache settings for a domain and its subdomains
+type DomainOverride struct {
+	Domain       string `json:"domain"`         // Domain suffix, e.g. example.com also matches api.example.com
+	TTL          int    `json:"ttl"`            // Seconds used in place of cache_ttl, 0 keeps it
+	NoCache      bool   `json:"no_cache"`       // Never cache the domain's responses
+	MaxBodyBytes int64  `json:"max_body_bytes"` // Used in place of max_cacheable_bytes, 0 keeps it
+}
+
+// Matches reports whether the override applies to host, which must not carry a port
+func (d DomainOverride) Matches(host string) bool {
+	return MatchDomain(d.Domain, host, false)
+}
+
+// MatchDomain reports whether host, which must not carry a port, matches a
+// domain pattern. A plain pattern such as example.com matches that host and,
+// unless exact is set, its subdomains; a wildcard pattern such as *.internal
+// matches subdomains only. Names are compared case-insensitively and on label
+// boundaries, so example.com never matches notexample.com.
+func MatchDomain(pattern, host string, exact bool) bool {
+	host = strings.TrimSuffix(host, ".")
+	wildcard := strings.HasPrefix(pattern, "*.")
+	domain := strings.TrimPrefix(strings.TrimPrefix(pattern, "*"), ".")
+	if strings.EqualFold(host, domain) {
+		return !wildcard
+	}
+	if exact && !wildcard {
+		return false
+	}
+	return len(host) > len(domain) && host[len(host)-len(domain)-1] == '.' &&
+		strings.EqualFold(host[len(host)-len(domain):], domain)
+}
+
+// ParseDomainOverride parses the --domain-override flag's format,
+// "domain[:setting,...]" with the settings ttl=N, no_cache and max_body_bytes=N
+func ParseDomainOverride(value string) (DomainOverride, error) {
+	domain, settings, _ := strings.Cut(value, ":")
+	override := DomainOverride{Domain: strings.TrimSpace(domain)}
+	if override.Domain == "" {
+		return override, fmt.Errorf("domain is required")
+	}
+	
+	for _, setting := range strings.Split(settings, ",") {
+		name, raw, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		var err error
+		switch name {
+		case "":
+		case "ttl":
+			override.TTL, err = strconv.Atoi(raw)
+		case "no_cache":
+			override.NoCache = true
+		case "max_body_bytes":
+			override.MaxBodyBytes, err = strconv.ParseInt(raw, 10, 64)
+		default:
+			return override, fmt.Errorf("unknown setting %q", name)
+		}
+		if err != nil {
+			return override, fmt.Errorf("invalid %s: %q", name, raw)
+		}
+	}
+	
+	return override, nil
+}
+
+// NegativeCacheRule selects upstream error statuses for a host to cache briefly
+type NegativeCacheRule struct {
+	Host     string `json:"host"`     // Upstream host name, empty matches every host
+	Statuses []int  `json:"statuses"` // 5xx status codes to cache
+	TTL      int    `json:"ttl"`      // In seconds, keep it short
+}
+
+// Matches reports whether the rule applies to an upstream response from host with status
+func (n NegativeCacheRule) Matches(host string, status int) bool {
+	if n.Host != "" && !strings.EqualFold(n.Host, host) {
+		return false
+	}
+	for _, s := range n.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
 
 // NewDefaultConfig returns a new Config with default values
@@ -41,16 +466,79 @@ func NewDefaultConfig() *Config {
 		WriteTimeout:   30,
 		IdleTimeout:    60,
 		MaxHeaderBytes: 1 << 20, // 1MB
+		WriteBufferSize: 32 << 10, // 32KB
+		TLSMinVersion:   "1.2",
+		ShutdownTimeout:          5,
+		ShutdownProgressInterval: 1,
 		
 		CacheSize:      1024,
 		CacheTTL:       3600, // 1 hour
+		LastModifiedFraction: 0.1,
+		RevalidateWindow:     600,
+		CacheHighWatermark: 1,
+		CacheLowWatermark:  1,
+		CacheCompression:   "none",
+		CacheSweepInterval: 60,
+		CacheEvictionPolicy: "lru",
+		CacheShards:        1,
+		CacheBackend:       "memory",
+		RedisAddr:          "localhost:6379",
+		RedisKeyPrefix:     "proxy-cache:",
+		MaxConcurrentRefreshes: 10,
+		CacheBypassPeers:       []string{},
+		CacheBypassStore:       true,
 		
 		ProxyTimeout:   30,
+		MaxRedirects:   10,
 		AllowedDomains: []string{},
 		MaxConnections: 100,
+		QueueFullTimeout: 100,
+		WorkerIdleTimeout: 30,
+		MaxResponseBytes:  100 << 20, // 100MB
+		RetryBackoff:      100,
+		MaxCacheableBytes: 10 << 20,  // 10MB
+		RateLimitMode:     "reject",
+		RateLimitMaxDelay: 500,
+		TrustedProxies:    []string{},
+		AllowedClientIPs:  []string{},
+		BlockedClientIPs:  []string{},
+		ClientIdleTimeout:     60,
+		ClientCleanupInterval: 60,
+		MaxTunnels:      1000,
+		MaxTunnelsPerIP: 50,
+		
+		MaxIdleConns:        512,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     90,
+		TLSHandshakeTimeout: 10,
+		
+		ShedFraction:         0.5,
+		ShedRetryAfter:       5,
+		ShedMaxInflightBytes: 256 << 20, // 256MB
+		
+		DedupWaitTimeout: 10,
+		
+		TLSWarnMinVersion:     "1.2",
+		TLSCertExpiryWarnDays: 14,
+		
+		HighPriorityPaths: []string{},
+		
+		CompressTrustedPeers: []string{},
+		GzipMinSize:          1024, // 1KB
+		
+		MaxDecompressedBytes: 10 << 20, // 10MB
+		
+		ChecksumMaxBytes: 10 << 20, // 10MB
+		
+		AuthRealm: "proxy",
+		
+		AdminHost:  "localhost",
+		HealthPath: "/healthz",
+		ReadyPath:  "/readyz",
 		
 		LogLevel:       "info",
 		LogFile:        "",
+		LogFormat:      "text",
 	}
 }
 
@@ -91,32 +579,127 @@ func (c *Config) SaveToFile(filename string) error {
 	return nil
 }
 
-// ParseFlags parses command line flags and updates the configuration
-func (c *Config) ParseFlags() {
-	flag.IntVar(&c.Port, "port", c.Port, "Port to listen on")
-	flag.StringVar(&c.Host, "host", c.Host, "Host to listen on")
-	flag.IntVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Read timeout in seconds")
-	flag.IntVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "Write timeout in seconds")
-	flag.IntVar(&c.CacheSize, "cache-size", c.CacheSize, "LRU cache size (number of items)")
-	flag.IntVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "Cache TTL in seconds")
-	flag.IntVar(&c.ProxyTimeout, "proxy-timeout", c.ProxyTimeout, "Proxy timeout in seconds")
-	flag.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "Maximum concurrent connections")
+// Load builds the configuration from its sources, each overriding the one
+// before: defaults, the file given by --config, the environment and the
+// command line flags in args
+func Load(args []string) (*Config, error) {
+	c := NewDefaultConfig()
+	if err := c.LoadFromEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.ParseArgs(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseFlags parses the command line flags and updates the configuration,
+// exiting after printing the usage if asked for help
+func (c *Config) ParseFlags() error {
+	err := c.ParseArgs(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	return err
+}
+
+// ParseArgs parses command line flags from args and updates the configuration.
+// If a config file is given it replaces the configuration, and the environment
+// and the flags are applied again on top of it.
+func (c *Config) ParseArgs(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.IntVar(&c.Port, "port", c.Port, "Port to listen on")
+	flags.StringVar(&c.Host, "host", c.Host, "Host to listen on")
+	flags.IntVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Read timeout in seconds")
+	flags.IntVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "Write timeout in seconds")
+	flags.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "PEM certificate file, serves HTTPS together with --tls-key")
+	flags.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "PEM private key file, serves HTTPS together with --tls-cert")
+	flags.StringVar(&c.TLSMinVersion, "tls-min-version", c.TLSMinVersion, "Minimum TLS version accepted from clients")
+	flags.IntVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Seconds in-flight requests get to complete on shutdown")
+	flags.IntVar(&c.CacheSize, "cache-size", c.CacheSize, "LRU cache size (number of items)")
+	flags.IntVar(&c.CacheMaxBytes, "cache-max-bytes", c.CacheMaxBytes, "Maximum total size of cached values in bytes (0 disables)")
+	flags.IntVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "Cache TTL in seconds")
+	flags.IntVar(&c.MinCacheTTL, "min-cache-ttl", c.MinCacheTTL, "Minimum cache TTL in seconds (0 disables)")
+	flags.IntVar(&c.MaxCacheTTL, "max-cache-ttl", c.MaxCacheTTL, "Maximum cache TTL in seconds (0 disables)")
+	flags.IntVar(&c.NegativeCacheTTL, "negative-cache-ttl", c.NegativeCacheTTL, "Seconds to cache 404 and 410 responses for (0 disables)")
+	flags.IntVar(&c.CacheSoftClearWindow, "cache-soft-clear-window", c.CacheSoftClearWindow, "Seconds over which clearing the cache staggers expirations (0 clears at once)")
+	flags.StringVar(&c.CacheFile, "cache-file", c.CacheFile, "File the cache is saved to on shutdown and loaded from at startup")
+	flags.StringVar(&c.CacheKeySalt, "cache-key-salt", c.CacheKeySalt, "Salt mixed into cache keys; change it to logically flush the cache")
+	flags.BoolVar(&c.CacheablePOST, "cacheable-post", c.CacheablePOST, "Cache POST responses keyed by a hash of the request body")
+	flags.StringVar(&c.CacheEvictionPolicy, "cache-eviction-policy", c.CacheEvictionPolicy, "Cache eviction policy: lru or lfu")
+	flags.IntVar(&c.CacheShards, "cache-shards", c.CacheShards, "Number of independently locked LRU cache shards")
+	flags.StringVar(&c.CacheBackend, "cache-backend", c.CacheBackend, "Cache backend: memory, redis or tiered")
+	flags.StringVar(&c.RedisAddr, "redis-addr", c.RedisAddr, "Redis server address for the redis cache backend")
+	flags.StringVar(&c.CacheCompression, "cache-compression", c.CacheCompression, "Cache entry compression: none, gzip, zstd or lz4")
+	flags.IntVar(&c.CacheGzipMinSize, "cache-gzip-min-size", c.CacheGzipMinSize, "Minimum body size in bytes stored gzipped in the cache (0 disables)")
+	flags.IntVar(&c.MaxConcurrentRefreshes, "max-concurrent-refreshes", c.MaxConcurrentRefreshes, "Maximum background cache refreshes running at once")
+	flags.IntVar(&c.ProxyTimeout, "proxy-timeout", c.ProxyTimeout, "Proxy timeout in seconds")
+	flags.IntVar(&c.MaxRedirects, "max-redirects", c.MaxRedirects, "Upstream redirects to follow (0 returns them to the client, negative follows up to the cap)")
+	flags.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "Maximum concurrent connections")
+	flags.BoolVar(&c.TunnelAllUpgrades, "tunnel-all-upgrades", c.TunnelAllUpgrades, "Tunnel non-WebSocket protocol upgrades instead of rejecting them")
+	flags.IntVar(&c.QueueTimeout, "queue-timeout", c.QueueTimeout, "Max seconds a request waits for a worker (0 disables)")
+	flags.IntVar(&c.MinWorkers, "min-workers", c.MinWorkers, "Workers kept when idle, scaling up to max-connections (0 disables scaling)")
+	flags.IntVar(&c.QueueFullTimeout, "queue-full-timeout", c.QueueFullTimeout, "Max milliseconds a request waits for room in a full queue (0 disables)")
+	flags.IntVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "Max seconds to serve a request (0 disables)")
+	flags.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, "Retries of idempotent requests after transient upstream failures")
+	flags.Int64Var(&c.MaxResponseBytes, "max-response-bytes", c.MaxResponseBytes, "Maximum upstream response body size in bytes (0 disables)")
+	flags.IntVar(&c.MaxIdleConnsPerHost, "max-idle-conns-per-host", c.MaxIdleConnsPerHost, "Idle upstream connections kept per host")
+	flags.IntVar(&c.MaxConnsPerHost, "max-conns-per-host", c.MaxConnsPerHost, "Open upstream connections per host (0 disables)")
+	flags.BoolVar(&c.DecompressRequests, "decompress-requests", c.DecompressRequests, "Decode gzip request bodies before forwarding them")
+	flags.BoolVar(&c.AllowedDomainsExact, "allowed-domains-exact", c.AllowedDomainsExact, "Match allowed domains exactly instead of including their subdomains")
+	flags.StringVar(&c.UpstreamProxyURL, "upstream-proxy", c.UpstreamProxyURL, "Proxy URL (http, https or socks5) forwarded requests are routed through")
+	flags.Int64Var(&c.MaxCacheableBytes, "max-cacheable-bytes", c.MaxCacheableBytes, "Maximum response body size in bytes that is cached (0 disables)")
+	flags.BoolVar(&c.MetricsEnabled, "metrics", c.MetricsEnabled, "Serve Prometheus metrics at /metrics")
+	flags.BoolVar(&c.EnablePprof, "enable-pprof", c.EnablePprof, "Serve runtime profiles at /debug/pprof/ to admin clients")
+	flags.StringVar(&c.AdminHost, "admin-host", c.AdminHost, "Interface the admin listener binds to")
+	flags.IntVar(&c.AdminPort, "admin-port", c.AdminPort, "Port for a separate admin listener (0 serves admin endpoints on the proxy port)")
+	flags.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level: debug, info, warn or error")
+	flags.StringVar(&c.LogFile, "log-file", c.LogFile, "File log messages are appended to instead of stderr")
+	flags.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format: text or json")
 	
-	allowedDomains := flag.String("allowed-domains", "", "Comma-separated list of allowed domains")
-	configFile := flag.String("config", "", "Path to configuration file")
+	allowedDomains := flags.String("allowed-domains", "", "Comma-separated list of allowed domains")
+	blockedDomains := flags.String("blocked-domains", "", "Comma-separated list of blocked domains")
+	middleware := flags.String("middleware", "", "Comma-separated list of middleware, outermost first")
+	configFile := flags.String("config", "", "Path to configuration file")
 	
-	flag.Parse()
+	var domainOverrides []DomainOverride
+	flags.Func("domain-override", "Cache override for a domain as domain[:ttl=N,no_cache,max_body_bytes=N], repeatable", func(value string) error {
+		override, err := ParseDomainOverride(value)
+		if err != nil {
+			return err
+		}
+		domainOverrides = append(domainOverrides, override)
+		return nil
+	})
+	
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
 	
 	// If a config file is specified, load it
 	if *configFile != "" {
-		if fileConfig, err := LoadFromFile(*configFile); err == nil {
-			*c = *fileConfig
-			
-			// Command line flags override config file
-			flag.Parse()
+		fileConfig, err := LoadFromFile(*configFile)
+		if err != nil {
+			return err
+		}
+		*c = *fileConfig
+		c.ConfigFile = *configFile
+		
+		// The environment and then the command line override the config file
+		if err := c.LoadFromEnv(); err != nil {
+			return err
+		}
+		domainOverrides = nil
+		if err := flags.Parse(args); err != nil {
+			return err
 		}
 	}
 	
+	// Overrides given on the command line take precedence over the file's
+	if len(domainOverrides) > 0 {
+		c.DomainOverrides = append(domainOverrides, c.DomainOverrides...)
+	}
+	
 	// Parse allowed domains from command line
 	if *allowedDomains != "" {
 		c.AllowedDomains = strings.Split(*allowedDomains, ",")
@@ -124,6 +707,23 @@ func (c *Config) ParseFlags() {
 			c.AllowedDomains[i] = strings.TrimSpace(domain)
 		}
 	}
+	
+	// Parse blocked domains from command line
+	if *blockedDomains != "" {
+		c.BlockedDomains = strings.Split(*blockedDomains, ",")
+		for i, domain := range c.BlockedDomains {
+			c.BlockedDomains[i] = strings.TrimSpace(domain)
+		}
+	}
+	
+	// Parse the middleware order from command line
+	if *middleware != "" {
+		c.Middleware = strings.Split(*middleware, ",")
+		for i, name := range c.Middleware {
+			c.Middleware[i] = strings.TrimSpace(name)
+		}
+	}
+	return nil
 }
 
 // Validate checks if the configuration is valid
@@ -132,6 +732,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid port number: %d", c.Port)
 	}
 	
+	if c.AdminPort < 0 || c.AdminPort > 65535 {
+		return fmt.Errorf("invalid admin port number: %d", c.AdminPort)
+	}
+	if c.AdminPort == c.Port {
+		return fmt.Errorf("admin port %d is already the proxy port", c.AdminPort)
+	}
+	
 	if c.ReadTimeout <= 0 {
 		return fmt.Errorf("invalid read timeout: %d", c.ReadTimeout)
 	}
@@ -140,22 +747,456 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid write timeout: %d", c.WriteTimeout)
 	}
 	
+	if c.WriteBufferSize < 0 {
+		return fmt.Errorf("invalid write buffer size: %d", c.WriteBufferSize)
+	}
+	
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("invalid TLS settings: cert file and key file must be set together")
+	}
+	
+	if c.TLSCertFile != "" {
+		if _, err := os.Stat(c.TLSCertFile); err != nil {
+			return fmt.Errorf("invalid TLS cert file: %w", err)
+		}
+		if _, err := os.Stat(c.TLSKeyFile); err != nil {
+			return fmt.Errorf("invalid TLS key file: %w", err)
+		}
+	}
+	
+	if _, ok := ParseTLSVersion(c.TLSMinVersion); !ok && c.TLSMinVersion != "" {
+		return fmt.Errorf("invalid TLS min version: %q", c.TLSMinVersion)
+	}
+	
+	if c.GzipMinSize < 0 {
+		return fmt.Errorf("invalid gzip min size: %d", c.GzipMinSize)
+	}
+	
+	if c.MaxDecompressedBytes < 0 {
+		return fmt.Errorf("invalid max decompressed bytes: %d", c.MaxDecompressedBytes)
+	}
+	
+	if c.ChecksumMaxBytes < 0 {
+		return fmt.Errorf("invalid checksum max bytes: %d", c.ChecksumMaxBytes)
+	}
+	
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown timeout: %d", c.ShutdownTimeout)
+	}
+	
+	if c.ShutdownProgressInterval <= 0 {
+		return fmt.Errorf("invalid shutdown progress interval: %d", c.ShutdownProgressInterval)
+	}
+	
 	if c.CacheSize <= 0 {
 		return fmt.Errorf("invalid cache size: %d", c.CacheSize)
 	}
 	
+	if c.CacheMaxBytes < 0 {
+		return fmt.Errorf("invalid cache max bytes: %d", c.CacheMaxBytes)
+	}
+	
 	if c.CacheTTL <= 0 {
 		return fmt.Errorf("invalid cache TTL: %d", c.CacheTTL)
 	}
 	
+	if c.RevalidateWindow < 0 {
+		return fmt.Errorf("invalid revalidate window: %d", c.RevalidateWindow)
+	}
+	
+	if c.NegativeCacheTTL < 0 {
+		return fmt.Errorf("invalid negative cache TTL: %d", c.NegativeCacheTTL)
+	}
+	
+	if c.CacheSweepInterval < 0 {
+		return fmt.Errorf("invalid cache sweep interval: %d", c.CacheSweepInterval)
+	}
+	
+	if c.CacheSoftClearWindow < 0 {
+		return fmt.Errorf("invalid cache soft clear window: %d", c.CacheSoftClearWindow)
+	}
+	
+	if c.CacheHighWatermark <= 0 || c.CacheHighWatermark > 1 {
+		return fmt.Errorf("invalid cache high watermark: %g", c.CacheHighWatermark)
+	}
+	
+	if c.CacheLowWatermark <= 0 || c.CacheLowWatermark > c.CacheHighWatermark {
+		return fmt.Errorf("invalid cache low watermark: %g", c.CacheLowWatermark)
+	}
+	
+	switch c.CacheEvictionPolicy {
+	case "", "lru", "lfu":
+	default:
+		return fmt.Errorf("invalid cache eviction policy: %q", c.CacheEvictionPolicy)
+	}
+	
+	if c.CacheShards < 1 {
+		return fmt.Errorf("invalid cache shards: %d", c.CacheShards)
+	}
+	
+	switch c.CacheCompression {
+	case "", "none", "gzip", "zstd", "lz4":
+	default:
+		return fmt.Errorf("invalid cache compression: %q", c.CacheCompression)
+	}
+	
+	switch c.CacheBackend {
+	case "", "memory":
+	case "redis", "tiered":
+		if c.RedisAddr == "" {
+			return fmt.Errorf("%s cache backend requires a redis address", c.CacheBackend)
+		}
+		if c.RedisDB < 0 {
+			return fmt.Errorf("invalid redis DB: %d", c.RedisDB)
+		}
+	default:
+		return fmt.Errorf("invalid cache backend: %q", c.CacheBackend)
+	}
+	
+	if c.CacheGzipMinSize < 0 {
+		return fmt.Errorf("invalid cache gzip min size: %d", c.CacheGzipMinSize)
+	}
+	
+	if c.MaxConcurrentRefreshes <= 0 {
+		return fmt.Errorf("invalid max concurrent refreshes: %d", c.MaxConcurrentRefreshes)
+	}
+	
+	if c.LastModifiedFraction < 0 || c.LastModifiedFraction > 1 {
+		return fmt.Errorf("invalid last modified fraction: %g", c.LastModifiedFraction)
+	}
+	
+	if c.CacheTTLJitter < 0 || c.CacheTTLJitter >= 1 {
+		return fmt.Errorf("invalid cache TTL jitter: %g", c.CacheTTLJitter)
+	}
+	
+	if c.MinCacheTTL < 0 {
+		return fmt.Errorf("invalid min cache TTL: %d", c.MinCacheTTL)
+	}
+	
+	if c.MaxCacheTTL < 0 {
+		return fmt.Errorf("invalid max cache TTL: %d", c.MaxCacheTTL)
+	}
+	
+	if c.MinCacheTTL > 0 && c.MaxCacheTTL > 0 && c.MinCacheTTL > c.MaxCacheTTL {
+		return fmt.Errorf("min cache TTL %d exceeds max cache TTL %d", c.MinCacheTTL, c.MaxCacheTTL)
+	}
+	
 	if c.ProxyTimeout <= 0 {
 		return fmt.Errorf("invalid proxy timeout: %d", c.ProxyTimeout)
 	}
 	
+	if c.MaxRedirects > RedirectCap {
+		return fmt.Errorf("invalid max redirects: %d exceeds %d", c.MaxRedirects, RedirectCap)
+	}
+	
 	if c.MaxConnections <= 0 {
 		return fmt.Errorf("invalid max connections: %d", c.MaxConnections)
 	}
 	
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries: %d", c.MaxRetries)
+	}
+	
+	if c.MaxRetries > 0 && c.RetryBackoff <= 0 {
+		return fmt.Errorf("invalid retry backoff: %d", c.RetryBackoff)
+	}
+	
+	if c.MaxResponseBytes < 0 {
+		return fmt.Errorf("invalid max response bytes: %d", c.MaxResponseBytes)
+	}
+	
+	if c.MaxCacheableBytes < 0 {
+		return fmt.Errorf("invalid max cacheable bytes: %d", c.MaxCacheableBytes)
+	}
+	
+	switch c.RateLimitMode {
+	case "", "reject", "delay":
+	default:
+		return fmt.Errorf("invalid rate limit mode: %q", c.RateLimitMode)
+	}
+	
+	if c.RateLimitMaxDelay < 0 {
+		return fmt.Errorf("invalid rate limit max delay: %d", c.RateLimitMaxDelay)
+	}
+	
+	if c.ClientIdleTimeout <= 0 {
+		return fmt.Errorf("invalid client idle timeout: %d", c.ClientIdleTimeout)
+	}
+	
+	if c.ClientCleanupInterval <= 0 {
+		return fmt.Errorf("invalid client cleanup interval: %d", c.ClientCleanupInterval)
+	}
+	
+	if c.QueueTimeout < 0 {
+		return fmt.Errorf("invalid queue timeout: %d", c.QueueTimeout)
+	}
+	
+	if c.MinWorkers < 0 || c.MinWorkers > c.MaxConnections {
+		return fmt.Errorf("invalid min workers: %d", c.MinWorkers)
+	}
+	
+	if c.WorkerIdleTimeout <= 0 {
+		return fmt.Errorf("invalid worker idle timeout: %d", c.WorkerIdleTimeout)
+	}
+	
+	if c.QueueFullTimeout < 0 {
+		return fmt.Errorf("invalid queue full timeout: %d", c.QueueFullTimeout)
+	}
+	
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("invalid request timeout: %d", c.RequestTimeout)
+	}
+	
+	if c.MaxTunnels < 0 {
+		return fmt.Errorf("invalid max tunnels: %d", c.MaxTunnels)
+	}
+	
+	if c.MaxTunnelsPerIP < 0 {
+		return fmt.Errorf("invalid max tunnels per IP: %d", c.MaxTunnelsPerIP)
+	}
+	
+	switch c.UpstreamAcceptEncoding {
+	case "", "identity", "gzip":
+	default:
+		return fmt.Errorf("invalid upstream accept encoding: %q", c.UpstreamAcceptEncoding)
+	}
+	
+	for i, rule := range c.FallbackResponses {
+		if !validStatus(rule.MinStatus) || (rule.MaxStatus != 0 && (!validStatus(rule.MaxStatus) || rule.MaxStatus < rule.MinStatus)) {
+			return fmt.Errorf("invalid fallback response %d: status range %d-%d", i, rule.MinStatus, rule.MaxStatus)
+		}
+		if !validStatus(rule.StatusCode) {
+			return fmt.Errorf("invalid fallback response %d: status code %d", i, rule.StatusCode)
+		}
+	}
+	
+	if c.ShedThreshold < 0 || c.ShedThreshold > 1 {
+		return fmt.Errorf("invalid shed threshold: %g", c.ShedThreshold)
+	}
+	
+	if c.ShedFraction < 0 || c.ShedFraction > 1 {
+		return fmt.Errorf("invalid shed fraction: %g", c.ShedFraction)
+	}
+	
+	if c.ShedRetryAfter < 0 {
+		return fmt.Errorf("invalid shed retry after: %d", c.ShedRetryAfter)
+	}
+	
+	if c.ShedMaxInflightBytes < 0 {
+		return fmt.Errorf("invalid shed max inflight bytes: %d", c.ShedMaxInflightBytes)
+	}
+	
+	for i, rule := range c.CookieStripRules {
+		if rule.Host == "" {
+			return fmt.Errorf("invalid cookie strip rule %d: host is required", i)
+		}
+	}
+	
+	for i, rule := range c.HeaderRules {
+		names := rule.RemoveRequestHeaders
+		names = append(names[:len(names):len(names)], rule.RemoveResponseHeaders...)
+		for name := range rule.AddRequestHeaders {
+			names = append(names, name)
+		}
+		for name := range rule.AddResponseHeaders {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+				return fmt.Errorf("invalid header rule %d: header name %q", i, name)
+			}
+		}
+	}
+	
+	for user, hash := range c.AuthUsers {
+		if user == "" || strings.Contains(user, ":") {
+			return fmt.Errorf("invalid auth user: %q", user)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid password hash for auth user %q: %w", user, err)
+		}
+	}
+	
+	for i, rule := range c.PathRewrites {
+		if rule.StripPrefix == "" && rule.Match == "" && rule.AddPrefix == "" {
+			return fmt.Errorf("invalid path rewrite %d: nothing to rewrite", i)
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("invalid path rewrite %d: %w", i, err)
+		}
+	}
+	
+	for i, rule := range c.NegativeCache {
+		for _, status := range rule.Statuses {
+			if status < 500 || status > 599 {
+				return fmt.Errorf("invalid negative cache rule %d: status %d is not a 5xx status", i, status)
+			}
+		}
+		if rule.TTL <= 0 {
+			return fmt.Errorf("invalid negative cache rule %d: TTL %d", i, rule.TTL)
+		}
+	}
+	
+	for _, domain := range c.AllowedDomains {
+		name := strings.TrimPrefix(domain, "*.")
+		if name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("invalid allowed domain: %q", domain)
+		}
+	}
+	
+	for _, domain := range c.BlockedDomains {
+		name := strings.TrimPrefix(domain, "*.")
+		if name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("invalid blocked domain: %q", domain)
+		}
+	}
+	
+	for i, override := range c.DomainOverrides {
+		if strings.TrimPrefix(override.Domain, ".") == "" {
+			return fmt.Errorf("invalid domain override %d: domain is required", i)
+		}
+		if override.TTL < 0 {
+			return fmt.Errorf("invalid domain override %d: TTL %d", i, override.TTL)
+		}
+		if override.MaxBodyBytes < 0 {
+			return fmt.Errorf("invalid domain override %d: max body bytes %d", i, override.MaxBodyBytes)
+		}
+	}
+	
+	if _, ok := logging.ParseLevel(c.LogLevel); !ok {
+		return fmt.Errorf("invalid log level: %q", c.LogLevel)
+	}
+	
+	if _, ok := logging.ParseFormat(c.LogFormat); !ok {
+		return fmt.Errorf("invalid log format: %q", c.LogFormat)
+	}
+	
+	if (c.DedupInFlight || c.CollapseCacheMisses) && c.DedupWaitTimeout <= 0 {
+		return fmt.Errorf("invalid dedup wait timeout: %d", c.DedupWaitTimeout)
+	}
+	
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("invalid max idle conns: %d", c.MaxIdleConns)
+	}
+	
+	if c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("invalid max idle conns per host: %d", c.MaxIdleConnsPerHost)
+	}
+	
+	if c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("invalid max conns per host: %d", c.MaxConnsPerHost)
+	}
+	
+	if c.IdleConnTimeout < 0 {
+		return fmt.Errorf("invalid idle conn timeout: %d", c.IdleConnTimeout)
+	}
+	
+	if c.TLSHandshakeTimeout < 0 {
+		return fmt.Errorf("invalid TLS handshake timeout: %d", c.TLSHandshakeTimeout)
+	}
+	
+	if c.UpstreamProxyURL != "" {
+		if _, err := ParseUpstreamProxyURL(c.UpstreamProxyURL); err != nil {
+			return fmt.Errorf("invalid upstream proxy URL: %w", err)
+		}
+	}
+	
+	if c.UpstreamCAFile != "" {
+		if _, err := os.Stat(c.UpstreamCAFile); err != nil {
+			return fmt.Errorf("invalid upstream CA file: %w", err)
+		}
+	}
+	
+	if _, ok := ParseTLSVersion(c.TLSWarnMinVersion); !ok && c.TLSWarnMinVersion != "" {
+		return fmt.Errorf("invalid TLS warn min version: %q", c.TLSWarnMinVersion)
+	}
+	
+	if c.TLSCertExpiryWarnDays < 0 {
+		return fmt.Errorf("invalid TLS cert expiry warn days: %d", c.TLSCertExpiryWarnDays)
+	}
+	
+	if err := validateNetworks("compress trusted peers", c.CompressTrustedPeers); err != nil {
+		return err
+	}
+	
+	if err := validateNetworks("cache bypass peers", c.CacheBypassPeers); err != nil {
+		return err
+	}
+	
+	if err := validateNetworks("trusted proxies", c.TrustedProxies); err != nil {
+		return err
+	}
+	
+	seen := make(map[string]bool)
+	for _, name := range c.Middleware {
+		if !slices.Contains(MiddlewareNames, name) {
+			return fmt.Errorf("invalid middleware: unknown name %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("invalid middleware: %q listed twice", name)
+		}
+		seen[name] = true
+	}
+	
+	if err := validateNetworks("allowed client IPs", c.AllowedClientIPs); err != nil {
+		return err
+	}
+	
+	if err := validateNetworks("blocked client IPs", c.BlockedClientIPs); err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// ParseUpstreamProxyURL parses the upstream proxy URL, accepting the schemes
+// the HTTP transport can route requests through
+func ParseUpstreamProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	return u, nil
+}
+
+// ParseTLSVersion converts a version string such as "1.2" into its tls package constant
+func ParseTLSVersion(version string) (uint16, bool) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, true
+	case "1.1":
+		return tls.VersionTLS11, true
+	case "1.2":
+		return tls.VersionTLS12, true
+	case "1.3":
+		return tls.VersionTLS13, true
+	}
+	return 0, false
+}
+
+// validStatus reports whether code is a valid HTTP status code
+func validStatus(code int) bool {
+	return code >= 100 && code <= 599
+}
+
+// validateNetworks checks that every entry is an IP address or CIDR range
+func validateNetworks(field string, entries []string) error {
+	for _, entry := range entries {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid %s entry: %q", field, entry)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the name of every environment variable read by LoadFromEnv
+const EnvPrefix = "PROXY_"
+
+// EnvName returns the environment variable setting the field with the given
+// JSON name, e.g. PROXY_CACHE_SIZE for cache_size
+func EnvName(jsonName string) string {
+	return EnvPrefix + strings.ToUpper(jsonName)
+}
+
+// LoadFromEnv overrides the configuration with the environment variables that
+// are set, named after the fields' JSON names as returned by EnvName. Lists
+// are comma separated, maps and lists of rules are given as JSON.
+func (c *Config) LoadFromEnv() error {
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+
+		name := EnvName(jsonName)
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(value.Field(i), raw); err != nil {
+			return fmt.Errorf("error parsing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromEnv parses an environment variable's value into the field
+func setFromEnv(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			field.Set(reflect.ValueOf(splitList(raw)))
+			return nil
+		}
+		return json.Unmarshal([]byte(raw), field.Addr().Interface())
+	default:
+		return json.Unmarshal([]byte(raw), field.Addr().Interface())
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(raw string) []string {
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
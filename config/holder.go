@@ -0,0 +1,58 @@
+package config
+
+import (
+	"sync/atomic"
+)
+
+// Holder gives concurrent readers the current configuration while reloads
+// replace it. Configurations are never modified once stored, so readers may
+// keep the one returned by Load for the rest of a request.
+type Holder struct {
+	current atomic.Pointer[Config]
+}
+
+// NewHolder creates a holder starting out with the given configuration
+func NewHolder(cfg *Config) *Holder {
+	h := &Holder{}
+	h.current.Store(cfg)
+	return h
+}
+
+// Load returns the current configuration
+func (h *Holder) Load() *Config {
+	return h.current.Load()
+}
+
+// Reload takes over the settings that can change at runtime from next,
+// keeping the current value of every other field:
+//
+//   - allowed_domains, allowed_domains_exact and blocked_domains
+//   - cache_ttl
+//   - max_connections, as far as the rate limit is concerned; the number of
+//     workers is fixed at startup
+//   - rate_limit_mode and rate_limit_max_delay
+//   - log_level
+//   - auth_users, while authentication is enabled; it can't be turned on or
+//     off without a restart
+//
+// The resulting configuration is validated first and left unapplied if invalid.
+func (h *Holder) Reload(next *Config) (*Config, error) {
+	updated := *h.Load()
+	updated.AllowedDomains = next.AllowedDomains
+	updated.AllowedDomainsExact = next.AllowedDomainsExact
+	updated.BlockedDomains = next.BlockedDomains
+	updated.CacheTTL = next.CacheTTL
+	updated.MaxConnections = next.MaxConnections
+	updated.RateLimitMode = next.RateLimitMode
+	updated.RateLimitMaxDelay = next.RateLimitMaxDelay
+	updated.LogLevel = next.LogLevel
+	if len(updated.AuthUsers) > 0 && len(next.AuthUsers) > 0 {
+		updated.AuthUsers = next.AuthUsers
+	}
+
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	}
+	h.current.Store(&updated)
+	return &updated, nil
+}
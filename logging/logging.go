@@ -0,0 +1,217 @@
+// Package logging writes leveled log messages, dropping those below the
+// configured level
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int32
+
+// Levels from the most to the least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames are the level names used in configuration and output
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// String returns the level's name
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel converts a level name such as "warn" into a Level
+func ParseLevel(name string) (Level, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		return LevelWarn, true
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, true
+		}
+	}
+	return LevelInfo, false
+}
+
+// Format selects how messages are written
+type Format string
+
+// Supported formats
+const (
+	FormatText Format = "text" // Human readable lines, the default
+	FormatJSON Format = "json" // One JSON object per message
+)
+
+// ParseFormat converts a format name into a Format
+func ParseFormat(name string) (Format, bool) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(name))); format {
+	case FormatText, FormatJSON:
+		return format, true
+	}
+	return FormatText, false
+}
+
+// Fields are the attributes of a structured message
+type Fields map[string]any
+
+var (
+	minLevel   atomic.Int32
+	jsonFormat atomic.Bool
+	logger     = log.New(os.Stderr, "", log.LstdFlags)
+)
+
+func init() {
+	minLevel.Store(int32(LevelInfo))
+}
+
+// SetLevel drops messages below level from now on
+func SetLevel(level Level) {
+	minLevel.Store(int32(level))
+}
+
+// Enabled reports whether messages at level are written
+func Enabled(level Level) bool {
+	return int32(level) >= minLevel.Load()
+}
+
+// SetFormat writes messages in the given format from now on
+func SetFormat(format Format) {
+	jsonFormat.Store(format == FormatJSON)
+	if format == FormatJSON {
+		logger.SetFlags(0)
+	} else {
+		logger.SetFlags(log.LstdFlags)
+	}
+}
+
+// CurrentFormat returns the format messages are written in
+func CurrentFormat() Format {
+	if jsonFormat.Load() {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// SetOutput sends messages to w, along with those of the standard logger
+// so that nothing is left behind on stderr
+func SetOutput(w io.Writer) {
+	logger.SetOutput(w)
+	log.SetOutput(w)
+}
+
+// Configure applies the level and format names and opens file for output,
+// appending to it; with an empty file name messages keep going to stderr.
+// The returned closer releases the file once logging is done.
+func Configure(levelName, formatName, file string) (io.Closer, error) {
+	level, ok := ParseLevel(levelName)
+	if !ok {
+		return io.NopCloser(nil), fmt.Errorf("invalid log level: %q", levelName)
+	}
+	format, ok := ParseFormat(formatName)
+	if !ok {
+		return io.NopCloser(nil), fmt.Errorf("invalid log format: %q", formatName)
+	}
+	SetLevel(level)
+	SetFormat(format)
+
+	if file == "" {
+		return io.NopCloser(nil), nil
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return io.NopCloser(nil), fmt.Errorf("error opening log file: %w", err)
+	}
+	SetOutput(f)
+	return f, nil
+}
+
+// logf writes the message if its level is enabled
+func logf(level Level, format string, args ...any) {
+	if !Enabled(level) {
+		return
+	}
+	write(level, fmt.Sprintf(format, args...), nil)
+}
+
+// write formats a message with its fields and writes it
+func write(level Level, msg string, fields Fields) {
+	if jsonFormat.Load() {
+		entry := make(Fields, len(fields)+3)
+		for key, value := range fields {
+			entry[key] = value
+		}
+		entry["time"] = time.Now().Format(time.RFC3339Nano)
+		entry["level"] = level.String()
+		entry["msg"] = msg
+		data, err := json.Marshal(entry)
+		if err != nil {
+			data, _ = json.Marshal(Fields{"time": entry["time"], "level": entry["level"], "msg": msg, "error": err.Error()})
+		}
+		logger.Output(4, string(data))
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteString(" ")
+	line.WriteString(msg)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&line, " %s=%v", key, fields[key])
+	}
+	logger.Output(4, line.String())
+}
+
+// Info logs a structured message at info level; in text format the fields
+// follow the message as key=value pairs
+func Info(msg string, fields Fields) {
+	if Enabled(LevelInfo) {
+		write(LevelInfo, msg, fields)
+	}
+}
+
+// Debugf logs details only useful when troubleshooting, such as cache lookups
+func Debugf(format string, args ...any) {
+	logf(LevelDebug, format, args...)
+}
+
+// Infof logs the normal course of events
+func Infof(format string, args ...any) {
+	logf(LevelInfo, format, args...)
+}
+
+// Warnf logs unexpected situations the server recovers from
+func Warnf(format string, args ...any) {
+	logf(LevelWarn, format, args...)
+}
+
+// Errorf logs failures
+func Errorf(format string, args ...any) {
+	logf(LevelError, format, args...)
+}
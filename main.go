@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,28 +14,98 @@ import (
 
 	"github.com/Jovial-Kanwadia/proxy-server/cache"
 	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
 	"github.com/Jovial-Kanwadia/proxy-server/proxy"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.NewDefaultConfig()
-	cfg.ParseFlags()
+	if err := cfg.LoadFromEnv(); err != nil {
+		log.Fatalf("Invalid environment configuration: %v", err)
+	}
+	if err := cfg.ParseFlags(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	// Set up logging; messages stay on stderr if the log file can't be opened
+	logFile, err := logging.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogFile)
+	if err != nil {
+		logging.Errorf("Error setting up logging: %v", err)
+	}
+	defer logFile.Close()
+
 	// Print configuration for debugging
 	fmt.Println(cfg)
 
-	// Create LRU cache
-	lruCache := cache.NewLRUCache(cfg.CacheSize)
-	fmt.Printf("Initialized LRU cache with capacity: %d\n", lruCache.Capacity())
+	// Create cache; watermarks, byte limits, sweeping and sharding are LRU only
+	var responseCache cache.Cache
+	policy, _ := cache.ParseEvictionPolicy(cfg.CacheEvictionPolicy)
+	lruOptions := cache.LRUOptions{
+		Capacity:      cfg.CacheSize,
+		HighWatermark: cfg.CacheHighWatermark,
+		LowWatermark:  cfg.CacheLowWatermark,
+		MaxBytes:      cfg.CacheMaxBytes,
+		SweepInterval: time.Duration(cfg.CacheSweepInterval) * time.Second,
+	}
+	if cfg.CacheBackend != "redis" {
+		if policy == cache.PolicyLRU && cfg.CacheShards > 1 {
+			responseCache = cache.NewShardedLRUCacheWithOptions(lruOptions, cfg.CacheShards)
+		} else if policy == cache.PolicyLRU {
+			responseCache = cache.NewLRUCacheWithOptions(lruOptions)
+		} else {
+			responseCache = cache.NewCacheWithPolicy(cfg.CacheSize, policy)
+		}
+		fmt.Printf("Initialized %s cache with capacity: %d\n", policy, responseCache.Capacity())
+	}
+
+	// Redis shares entries between instances, on its own or behind the local cache
+	if cfg.CacheBackend == "redis" || cfg.CacheBackend == "tiered" {
+		redisCache := cache.NewRedisCache(cache.RedisOptions{
+			Addr:      cfg.RedisAddr,
+			Password:  cfg.RedisPassword,
+			DB:        cfg.RedisDB,
+			KeyPrefix: cfg.RedisKeyPrefix,
+			Capacity:  cfg.CacheSize,
+		})
+		defer redisCache.Close()
+
+		// An unreachable server only costs cache hits, so keep going
+		if err := redisCache.Ping(); err != nil {
+			logging.Errorf("Error connecting to redis at %s: %v", cfg.RedisAddr, err)
+		}
+		fmt.Printf("Initialized redis cache at %s\n", cfg.RedisAddr)
+
+		if responseCache != nil {
+			responseCache = cache.NewTieredCache(responseCache, redisCache)
+		} else {
+			responseCache = redisCache
+		}
+	}
+
+	// Warm the cache with the entries saved by the previous run
+	lruCache, persistable := responseCache.(*cache.LRUCache)
+	if cfg.CacheFile != "" && persistable {
+		err := lruCache.LoadFromFile(cfg.CacheFile)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			logging.Infof("No cache file at %s yet, starting with an empty cache", cfg.CacheFile)
+		case err != nil:
+			logging.Errorf("Error loading cache: %v", err)
+		default:
+			fmt.Printf("Loaded %d cache entries from %s\n", lruCache.Size(), cfg.CacheFile)
+		}
+	} else if cfg.CacheFile != "" {
+		logging.Warnf("Ignoring cache file, persistence requires an unsharded lru cache")
+	}
 
 	// Create proxy handler
-	proxyHandler := proxy.NewProxyHandler(lruCache, cfg)
+	proxyHandler := proxy.NewProxyHandler(responseCache, cfg)
 	
 	// Apply middleware chain
 	handler := proxy.CreateMiddlewareChain(proxyHandler, cfg)
@@ -47,15 +119,53 @@ func main() {
 		IdleTimeout:    time.Duration(cfg.IdleTimeout) * time.Second,
 		MaxHeaderBytes: cfg.MaxHeaderBytes,
 	}
+	if minVersion, ok := config.ParseTLSVersion(cfg.TLSMinVersion); ok {
+		server.TLSConfig = &tls.Config{MinVersion: minVersion}
+	}
 
 	// Start server in goroutine to not block
 	go func() {
-		fmt.Printf("Starting proxy server on %s:%d\n", cfg.Host, cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+			fmt.Printf("Starting proxy server on %s:%d with TLS\n", cfg.Host, cfg.Port)
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			fmt.Printf("Starting proxy server on %s:%d\n", cfg.Host, cfg.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Error starting server: %v", err)
 		}
 	}()
 
+	// Serve the proxy's own endpoints on a listener of their own, if configured
+	var adminServer *http.Server
+	if cfg.AdminPort > 0 {
+		adminServer = &http.Server{
+			Addr:           fmt.Sprintf("%s:%d", cfg.AdminHost, cfg.AdminPort),
+			Handler:        proxyHandler.AdminHandler(),
+			ReadTimeout:    time.Duration(cfg.ReadTimeout) * time.Second,
+			WriteTimeout:   time.Duration(cfg.WriteTimeout) * time.Second,
+			IdleTimeout:    time.Duration(cfg.IdleTimeout) * time.Second,
+			MaxHeaderBytes: cfg.MaxHeaderBytes,
+		}
+		go func() {
+			fmt.Printf("Starting admin server on %s:%d\n", cfg.AdminHost, cfg.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error starting admin server: %v", err)
+			}
+		}()
+	}
+
+	// Apply the reloadable settings of the config file on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadConfig(proxyHandler.Settings(), cfg.ConfigFile)
+		}
+	}()
+
 	// Set up graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -65,16 +175,68 @@ func main() {
 	fmt.Println("Shutting down server...")
 
 	// Create shutdown context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
 	defer cancel()
 
-	// Shutdown the proxy handler (which will stop the worker pool)
-	proxyHandler.Shutdown()
+	// Stop accepting connections, let in-flight requests finish and stop the
+	// worker pool; shutting down goes on even if requests are stuck
+	if err := proxyHandler.ShutdownServer(ctx, server, time.Duration(cfg.ShutdownProgressInterval)*time.Second); err != nil {
+		logging.Warnf("Server shutdown incomplete: %v", err)
+	}
+
+	// The admin listener outlives the proxy one, so the drain stays observable
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logging.Warnf("Admin server shutdown incomplete: %v", err)
+		}
+	}
 
-	// Shutdown server
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Error during server shutdown: %v", err)
+	// Persist the cache once nothing writes to it anymore. The file is
+	// replaced atomically, so giving up at the deadline leaves the old one.
+	if persistable {
+		lruCache.Close()
+		if cfg.CacheFile != "" {
+			saved := make(chan error, 1)
+			go func() {
+				saved <- lruCache.SaveToFile(cfg.CacheFile)
+			}()
+			select {
+			case err := <-saved:
+				if err != nil {
+					logging.Errorf("Error saving cache: %v", err)
+				} else {
+					fmt.Printf("Saved %d cache entries to %s\n", lruCache.Size(), cfg.CacheFile)
+				}
+			case <-ctx.Done():
+				logging.Errorf("Error saving cache: %v", ctx.Err())
+			}
+		}
 	}
 
 	fmt.Println("Server gracefully stopped")
-}
\ No newline at end of file
+}
+
+// reloadConfig re-reads the config file and applies the settings that can
+// change without a restart, keeping the current ones if the file is invalid.
+// The environment and command line still override the file, as at startup.
+func reloadConfig(settings *config.Holder, filename string) {
+	if filename == "" {
+		logging.Warnf("Ignoring SIGHUP: no config file to reload")
+		return
+	}
+
+	next, err := config.Load(os.Args[1:])
+	if err != nil {
+		logging.Errorf("Error reloading configuration: %v", err)
+		return
+	}
+	current, err := settings.Reload(next)
+	if err != nil {
+		logging.Errorf("Invalid configuration in %s, keeping the current one: %v", filename, err)
+		return
+	}
+	if level, ok := logging.ParseLevel(current.LogLevel); ok {
+		logging.SetLevel(level)
+	}
+	logging.Infof("Reloaded configuration from %s", filename)
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// isAdminRequest checks if the request is addressed to the proxy's admin endpoints
+func isAdminRequest(r *http.Request) bool {
+	return r.URL.Host == "" && strings.HasPrefix(r.URL.Path, "/admin/")
+}
+
+// adminHandler builds the mux serving the admin endpoints
+func (p *ProxyHandler) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/config", p.serveConfig)
+	mux.HandleFunc("GET /admin/stats", p.serveStats)
+	mux.HandleFunc("POST /admin/cache/clear", p.clearCache)
+	return p.requireAdmin(mux)
+}
+
+// requireAdmin only lets through requests carrying the admin token, or from
+// loopback clients when no token is configured
+func (p *ProxyHandler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := p.config.AdminToken; token != "" {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if ip := clientIP(r); ip == nil || !ip.IsLoopback() {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveConfig writes the effective configuration, including settings changed
+// by a reload, with sensitive settings redacted
+func (p *ProxyHandler) serveConfig(w http.ResponseWriter, r *http.Request) {
+	data, err := p.settings.Load().RedactedJSON()
+	if err != nil {
+		logging.Errorf("Error encoding config: %v", err)
+		http.Error(w, "Error encoding config", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// softClearer is implemented by caches that can spread the expiration of
+// their items over a window instead of dropping them at once
+type softClearer interface {
+	SoftClear(window time.Duration)
+}
+
+// clearCache empties the cache. With a soft clear window the entries expire at
+// random points within it, so the upstreams don't see every re-fetch at once.
+func (p *ProxyHandler) clearCache(w http.ResponseWriter, r *http.Request) {
+	window := time.Duration(p.config.CacheSoftClearWindow) * time.Second
+	if c, ok := p.cache.(softClearer); ok {
+		c.SoftClear(window)
+	} else {
+		p.cache.Clear()
+	}
+	logging.Infof("Cache cleared by %s (window %v)", r.RemoteAddr, window)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminHandler serves the proxy's own endpoints on a separate admin listener:
+// the health checks, /stats, /metrics when metrics are enabled, and the
+// /admin/ and profiling endpoints. Build it after the middleware chain, which
+// sets up the metrics.
+func (p *ProxyHandler) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", p.admin)
+	mux.Handle("GET /stats", p.requireAdmin(http.HandlerFunc(p.serveStats)))
+	if p.metrics != nil {
+		mux.Handle("GET "+metricsPath, p.metrics.Handler())
+	}
+	if p.pprof != nil {
+		mux.Handle(pprofPath, p.pprof)
+	}
+	for _, path := range []string{p.config.HealthPath, p.config.ReadyPath} {
+		if path != "" {
+			mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+				p.serveHealth(w, r)
+			})
+		}
+	}
+	return mux
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// verifiedCredentials is how many verified credentials Auth remembers
+const verifiedCredentials = 1024
+
+// AuthOptions configures the Auth middleware
+type AuthOptions struct {
+	Users       map[string]string // Username to bcrypt password hash
+	Realm       string            // Sent in the authentication challenge
+	ExemptPaths []string          // Paths on the proxy itself served without credentials, "/admin/" style entries match as prefixes
+
+	// Settings, when set, takes precedence over Users so that reloading the
+	// configuration changes the accepted credentials
+	Settings *config.Holder
+}
+
+// users returns the credentials accepted for the next request
+func (opts *AuthOptions) users() map[string]string {
+	if opts.Settings == nil {
+		return opts.Users
+	}
+	return opts.Settings.Load().AuthUsers
+}
+
+// dummyHash is compared against for unknown users, so that they take as long
+// to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// Auth middleware requires clients to authenticate with basic auth before
+// using the proxy. Requests in proxy form (absolute URL or CONNECT) present
+// credentials in Proxy-Authorization and are challenged with 407, requests
+// naming their target in the query use Authorization and get 401. The header
+// carrying the credentials is never forwarded upstream.
+func Auth(opts AuthOptions) Middleware {
+	// bcrypt is deliberately slow, remember the most recent credentials that
+	// were verified. They are keyed together with the hash they matched, so a
+	// changed password stops matching its remembered predecessor.
+	verified := cache.NewLRUCache(verifiedCredentials)
+
+	check := func(header string) bool {
+		user, password, ok := parseBasicAuth(header)
+		if !ok {
+			return false
+		}
+
+		hash, known := opts.users()[user]
+		if !known {
+			bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+			return false
+		}
+		sum := sha256.Sum256([]byte(header + "\x00" + hash))
+		key := string(sum[:])
+		if _, ok := verified.Get(key); ok {
+			return true
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false
+		}
+		verified.Set(key, nil, 0)
+		return true
+	}
+
+	challenge := `Basic realm="` + strings.ReplaceAll(opts.Realm, `"`, "") + `"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Host == "" && isExemptPath(r.URL.Path, opts.ExemptPaths) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.IsAbs() || r.Method == http.MethodConnect {
+				if !check(r.Header.Get("Proxy-Authorization")) {
+					w.Header().Set("Proxy-Authenticate", challenge)
+					http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+					return
+				}
+				r.Header.Del("Proxy-Authorization")
+			} else {
+				if !check(r.Header.Get("Authorization")) {
+					w.Header().Set("WWW-Authenticate", challenge)
+					http.Error(w, "Authentication required", http.StatusUnauthorized)
+					return
+				}
+				r.Header.Del("Authorization")
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseBasicAuth extracts the credentials of a Basic authorization header
+func parseBasicAuth(header string) (user, password string, ok bool) {
+	r := http.Request{Header: http.Header{"Authorization": {header}}}
+	return r.BasicAuth()
+}
+
+// isExemptPath checks if a path is one of the exempt paths or, for entries
+// ending in a slash, below it
+func isExemptPath(path string, exempt []string) bool {
+	for _, entry := range exempt {
+		if path == entry || (strings.HasSuffix(entry, "/") && strings.HasPrefix(path, entry)) {
+			return true
+		}
+	}
+	return false
+}
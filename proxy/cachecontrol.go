@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheControl holds the parsed directives of a Cache-Control header, keyed
+// by their lower case names; directives without a value map to ""
+type cacheControl map[string]string
+
+// parseCacheControl parses all Cache-Control headers of a message
+func parseCacheControl(header http.Header) cacheControl {
+	directives := make(cacheControl)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// has checks if the directive is present
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive, or 0 when it is
+// missing or malformed
+func (cc cacheControl) seconds(name string) int {
+	seconds, err := strconv.Atoi(cc[name])
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return seconds
+}
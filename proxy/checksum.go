@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// needsChecksum checks if the request body has to match its declared checksum
+func (p *ProxyHandler) needsChecksum(r *http.Request) bool {
+	if !p.config.VerifyBodyChecksum || r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+
+	// Without any scoping every request is verified
+	if len(p.config.ChecksumContentTypes) == 0 && len(p.config.ChecksumPaths) == 0 {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for _, contentType := range p.config.ChecksumContentTypes {
+		if strings.EqualFold(mediaType, contentType) {
+			return true
+		}
+	}
+	for _, prefix := range p.config.ChecksumPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredChecksums collects the base64 checksums declared through the
+// Content-MD5 and Digest headers, keyed by lowercase algorithm name
+func declaredChecksums(header http.Header) map[string]string {
+	checksums := make(map[string]string)
+	if value := header.Get("Content-MD5"); value != "" {
+		checksums["md5"] = strings.TrimSpace(value)
+	}
+	for _, value := range header.Values("Digest") {
+		for _, entry := range strings.Split(value, ",") {
+			algo, sum, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if ok {
+				checksums[strings.ToLower(algo)] = sum
+			}
+		}
+	}
+	return checksums
+}
+
+// errChecksumBodyTooLarge is returned for bodies too large to be buffered for verification
+var errChecksumBodyTooLarge = errors.New("request body too large to verify")
+
+// verifyChecksum buffers the request body and compares it with every declared
+// checksum of a supported algorithm; the body is restored for forwarding.
+// Bodies over maxBytes are rejected without being read in full, 0 means
+// unlimited.
+func verifyChecksum(r *http.Request, maxBytes int64) error {
+	checksums := declaredChecksums(r.Header)
+	if len(checksums) == 0 {
+		return nil
+	}
+	if maxBytes > 0 && r.ContentLength > maxBytes {
+		return errChecksumBodyTooLarge
+	}
+
+	// Hash the body while it is being buffered
+	var buf bytes.Buffer
+	hashes := make(map[string]hash.Hash)
+	writers := []io.Writer{&buf}
+	for algo := range checksums {
+		var h hash.Hash
+		switch algo {
+		case "md5":
+			h = md5.New()
+		case "sha-256":
+			h = sha256.New()
+		default:
+			continue
+		}
+		hashes[algo] = h
+		writers = append(writers, h)
+	}
+
+	var body io.Reader = r.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(r.Body, maxBytes+1)
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), body)
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("error reading request body: %w", err)
+	}
+	if maxBytes > 0 && n > maxBytes {
+		return errChecksumBodyTooLarge
+	}
+	r.Body = io.NopCloser(&buf)
+
+	for algo, h := range hashes {
+		if actual := base64.StdEncoding.EncodeToString(h.Sum(nil)); actual != checksums[algo] {
+			return fmt.Errorf("%s checksum mismatch", algo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// handleConnect opens a raw TCP tunnel to the requested host, which lets
+// clients use the proxy for HTTPS without it seeing the encrypted traffic
+func (p *ProxyHandler) handleConnect(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Host
+	if target == "" {
+		target = r.Host
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		// CONNECT targets usually carry a port, default to HTTPS otherwise
+		host, port = target, "443"
+	}
+	if host == "" {
+		http.Error(w, "Invalid CONNECT target", http.StatusBadRequest)
+		return
+	}
+
+	if p.isDomainBlocked(host) {
+		http.Error(w, "Domain blocked", http.StatusForbidden)
+		return
+	}
+	if !p.isDomainAllowed(host) {
+		http.Error(w, "Domain not allowed", http.StatusForbidden)
+		return
+	}
+
+	// Tunnels hold a goroutine pair and two connections until closed
+	ip := clientIP(r).String()
+	if !p.tunnels.Acquire(ip) {
+		logging.Warnf("Rejecting CONNECT from %s: tunnel limit reached", ip)
+		http.Error(w, "Too many open tunnels", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.tunnels.Release(ip)
+
+	address := net.JoinHostPort(host, port)
+	upstream, err := net.DialTimeout("tcp", address, time.Duration(p.config.ProxyTimeout)*time.Second)
+	if err != nil {
+		status, reason := classifyUpstreamError(err)
+		writeProxyError(w, status, reason, fmt.Sprintf("Error connecting to target: %v", err))
+		return
+	}
+	defer upstream.Close()
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error hijacking connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	buf.WriteString("HTTP/1.1 200 Connection Established\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		logging.Errorf("Error writing CONNECT response: %v", err)
+		return
+	}
+
+	logging.Infof("Tunneling CONNECT to %s", address)
+
+	// Copy in both directions until either side closes; the client side reads
+	// through buf in case the TLS handshake was sent along with the request
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(upstream, buf)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(conn, upstream)
+		errc <- err
+	}()
+	<-errc
+}
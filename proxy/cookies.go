@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// stripCookies removes the Set-Cookie headers selected by the first cookie
+// strip rule matching the request, which may make the response cacheable
+func (p *ProxyHandler) stripCookies(r *http.Request, resp *http.Response) {
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+
+	for _, rule := range p.config.CookieStripRules {
+		if !rule.Matches(r.URL.Hostname(), r.URL.Path) {
+			continue
+		}
+
+		var kept []string
+		for _, cookie := range cookies {
+			name, _, _ := strings.Cut(cookie, "=")
+			if !rule.Strips(strings.TrimSpace(name)) {
+				kept = append(kept, cookie)
+			}
+		}
+
+		if stripped := len(cookies) - len(kept); stripped > 0 {
+			logging.Debugf("Stripped %d Set-Cookie headers from %s", stripped, r.URL.String())
+		}
+		resp.Header.Del("Set-Cookie")
+		for _, cookie := range kept {
+			resp.Header.Add("Set-Cookie", cookie)
+		}
+		return
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DecompressRequests middleware decodes gzip-encoded request bodies, for
+// upstreams that don't accept them. The body is decoded in full so that the
+// forwarded request carries its real Content-Length; bodies decoding to more
+// than maxBytes are rejected with 413, 0 means unlimited. Malformed bodies are
+// rejected with 400.
+func DecompressRequests(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if r.Body == nil || (encoding != "gzip" && encoding != "x-gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := decodeGzipBody(r.Body, maxBytes)
+			if errors.Is(err, errRequestTooLarge) {
+				http.Error(w, "Decompressed request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+				return
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errRequestTooLarge is returned for request bodies that decode to more than allowed
+var errRequestTooLarge = errors.New("decompressed request body exceeds limit")
+
+// decodeGzipBody reads and decodes a gzip body of at most maxBytes decoded
+// bytes, 0 meaning unlimited
+func decodeGzipBody(body io.Reader, maxBytes int64) ([]byte, error) {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var reader io.Reader = zr
+	if maxBytes > 0 {
+		reader = io.LimitReader(zr, maxBytes+1)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && int64(len(decoded)) > maxBytes {
+		return nil, errRequestTooLarge
+	}
+	return decoded, nil
+}
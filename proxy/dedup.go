@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// inflightCall is an upstream request whose result can be shared with
+// identical requests arriving while it is still being processed
+type inflightCall struct {
+	done chan struct{}
+	once sync.Once
+	resp *CachedResponse // Shared response, nil if the call failed
+}
+
+// dedupKey returns the key identifying duplicates of an in-flight request, or
+// an empty string if the request must not be deduplicated. Requests carrying
+// an Idempotency-Key are marked by the client as safe to collapse into one
+// upstream call. Cache misses are collapsed as well when enabled, but their
+// duplicates may only share a response that is going into the cache, which is
+// what the second return value reports.
+func (p *ProxyHandler) dedupKey(r *http.Request, bypass bool) (string, bool) {
+	if p.config.DedupInFlight {
+		if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+			return fmt.Sprintf("%s:%s:%s", r.Method, r.URL.String(), idempotencyKey), false
+		}
+	}
+	if p.config.CollapseCacheMisses && p.isCacheable(r) && !bypass {
+		return "miss|" + p.createCacheKey(r), true
+	}
+	return "", false
+}
+
+// joinInflight returns the in-flight call for the key, registering a new one
+// if there is none; the second return value reports whether the caller leads it
+func (p *ProxyHandler) joinInflight(key string) (*inflightCall, bool) {
+	p.inflightMutex.Lock()
+	defer p.inflightMutex.Unlock()
+
+	if call, exists := p.inflight[key]; exists {
+		return call, false
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	p.inflight[key] = call
+	return call, true
+}
+
+// finishInflight publishes the leader's response and releases waiting
+// duplicates; only the first call for a given in-flight request has any effect
+func (p *ProxyHandler) finishInflight(key string, call *inflightCall, resp *CachedResponse) {
+	call.once.Do(func() {
+		p.inflightMutex.Lock()
+		delete(p.inflight, key)
+		p.inflightMutex.Unlock()
+
+		call.resp = resp
+		close(call.done)
+	})
+}
+
+// waitInflight waits for the in-flight call up to the configured timeout and
+// returns its shared response, or nil if it failed or took too long
+func (p *ProxyHandler) waitInflight(call *inflightCall) *CachedResponse {
+	timer := time.NewTimer(time.Duration(p.config.DedupWaitTimeout) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-call.done:
+		return call.resp
+	case <-timer.C:
+		return nil
+	}
+}
+
+// writeSharedResponse writes a response shared by an in-flight duplicate
+func (p *ProxyHandler) writeSharedResponse(w http.ResponseWriter, resp *CachedResponse) {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.Header().Set("X-Proxy-Server", "Go-Proxy-Server/1.0")
+	w.Header().Set("X-Cache", "MISS")
+	w.Header().Set("X-Deduplicated", "true")
+
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(resp.Body); err != nil {
+		logging.Errorf("Error writing shared response body: %v", err)
+	}
+}
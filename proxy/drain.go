@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// InFlight returns the number of requests currently being served, including
+// queued requests and upgraded connections
+func (p *ProxyHandler) InFlight() int64 {
+	return atomic.LoadInt64(&p.inFlight)
+}
+
+// Drain waits for in-flight requests to complete, logging progress every
+// interval, and returns an error if ctx ends before they all did
+func (p *ProxyHandler) Drain(ctx context.Context, interval time.Duration) error {
+	start := time.Now()
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	progress := time.NewTicker(interval)
+	defer progress.Stop()
+
+	for {
+		remaining := p.InFlight()
+		if remaining == 0 {
+			logging.Infof("Drain complete after %v", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+
+		select {
+		case <-poll.C:
+		case <-progress.C:
+			logging.Infof("Draining: %d requests in flight, %v elapsed", remaining, time.Since(start).Round(time.Millisecond))
+		case <-ctx.Done():
+			elapsed := time.Since(start).Round(time.Millisecond)
+			logging.Warnf("Drain incomplete: %d requests still in flight after %v", remaining, elapsed)
+			return fmt.Errorf("drain incomplete: %d requests still in flight after %v", remaining, elapsed)
+		}
+	}
+}
+
+// ShutdownServer stops server from accepting connections, waits for the
+// requests in flight to finish and then stops the worker pool, so no request
+// is cut off by the pool going away underneath it. Every step is bounded by
+// ctx; later steps still run when an earlier one times out, and the first
+// error is returned.
+func (p *ProxyHandler) ShutdownServer(ctx context.Context, server *http.Server, progressInterval time.Duration) error {
+	// Report drain progress while the server waits for its connections
+	drained := make(chan error, 1)
+	go func() {
+		drained <- p.Drain(ctx, progressInterval)
+	}()
+
+	err := server.Shutdown(ctx)
+	drainErr := <-drained
+
+	// Upgraded connections are no longer tracked by the server and may
+	// outlast its shutdown
+	if drainErr == nil && p.InFlight() > 0 {
+		drainErr = p.Drain(ctx, progressInterval)
+	}
+	if err == nil {
+		err = drainErr
+	}
+
+	if stopErr := p.ShutdownContext(ctx); err == nil {
+		err = stopErr
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// supportedEncodings lists the content encodings Compress produces, in
+// order of preference when the client weighs them equally
+var supportedEncodings = []string{"br", "gzip"}
+
+// negotiateEncoding picks the supported encoding the client weighs highest
+// in its Accept-Encoding header, or "" when the body should stay as it is
+func negotiateEncoding(accept string) string {
+	weights := make(map[string]float64)
+	wildcard := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		if token == "x-gzip" {
+			token = "gzip"
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || !strings.EqualFold(name, "q") {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if token == "*" {
+			wildcard = q
+		} else {
+			weights[token] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supportedEncodings {
+		q, listed := weights[encoding]
+		if !listed {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// newEncoder creates a writer compressing into w with the given encoding
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "br" {
+		// Level 4 is in gzip's speed range at a better ratio
+		return brotli.NewWriterLevel(w, 4)
+	}
+	gz, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	return gz
+}
+
+// gzipCachedBody returns a copy of the response with its body gzipped for
+// storage, or the response itself if the body is too small, already encoded
+// or not worth compressing
+func gzipCachedBody(resp *CachedResponse, minSize int) *CachedResponse {
+	if minSize <= 0 || resp.BodyGzipped || len(resp.Body) < minSize || !isCompressible(resp.StatusCode, resp.Header) {
+		return resp
+	}
+
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	gz.Write(resp.Body)
+	if err := gz.Close(); err != nil || buf.Len() >= len(resp.Body) {
+		return resp
+	}
+
+	stored := *resp
+	stored.Body = buf.Bytes()
+	stored.BodyGzipped = true
+	return &stored
+}
+
+// decodeBody decompresses a body stored by gzipCachedBody in place
+func (c *CachedResponse) decodeBody() error {
+	reader, err := gzip.NewReader(bytes.NewReader(c.Body))
+	if err != nil {
+		return fmt.Errorf("error decoding cached body: %w", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("error decoding cached body: %w", err)
+	}
+
+	c.Body = body
+	c.BodyGzipped = false
+	return nil
+}
+
+// acceptsStoredGzip checks if a body stored gzipped can be sent to the client
+// without decoding it: the client takes gzip and wants the whole body
+func acceptsStoredGzip(r *http.Request) bool {
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token != "gzip" && token != "x-gzip" {
+			continue
+		}
+		return negotiateEncoding(token+";"+params) == "gzip"
+	}
+	return false
+}
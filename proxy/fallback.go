@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// fallbackFor returns the first configured fallback rule matching an upstream response
+func (p *ProxyHandler) fallbackFor(host string, status int) *config.FallbackRule {
+	for i := range p.config.FallbackResponses {
+		if p.config.FallbackResponses[i].Matches(host, status) {
+			return &p.config.FallbackResponses[i]
+		}
+	}
+	return nil
+}
+
+// writeFallback writes a fallback response in place of the upstream one; it is
+// never cached or shared with deduplicated requests
+func (p *ProxyHandler) writeFallback(w http.ResponseWriter, rule *config.FallbackRule) {
+	contentType := rule.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(rule.Body)))
+	w.Header().Set("X-Proxy-Server", "Go-Proxy-Server/1.0")
+	w.Header().Set("X-Proxy-Fallback", "true")
+	w.WriteHeader(rule.StatusCode)
+	w.Write([]byte(rule.Body))
+}
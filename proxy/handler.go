@@ -2,40 +2,85 @@ package proxy
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Jovial-Kanwadia/proxy-server/cache"
 	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
 )
 
 // ProxyHandler handles HTTP requests by forwarding them to the target server
 type ProxyHandler struct {
 	cache      cache.Cache
+	varies     *cache.LRUCache // Headers the responses for each cache key vary on
 	client     *http.Client
 	config     *config.Config
+	settings   *config.Holder  // Current values of the settings that can be reloaded
 	cacheables map[string]bool // Map of cacheable HTTP methods
 	workerPool *WorkerPool     // Worker pool for concurrent request handling
+
+	upstreamTLS map[string]TLSDetails // TLS details last negotiated per upstream host
+	tlsMutex    sync.RWMutex
+
+	inflight      map[string]*inflightCall // Deduplicated requests currently in flight
+	inflightMutex sync.Mutex
+
+	refreshLimiter  *RefreshLimiter     // Bounds concurrent background cache refreshes
+	refreshing      map[string]struct{} // Keys with a background refresh running
+	refreshingMutex sync.Mutex
+
+	compression cache.Compression // Algorithm new cache entries are compressed with
+
+	serializationErrors   int64 // Accessed atomically
+	deserializationErrors int64 // Accessed atomically
+
+	shedder *LoadShedder // Rejects new requests while overloaded
+
+	admin http.Handler // Serves the /admin/ endpoints
+	pprof http.Handler // Serves the runtime profiles, nil unless enabled
+
+	inFlight int64 // Requests currently being served, accessed atomically
+
+	cacheBypassPeers []*net.IPNet // Clients whose requests never read from the cache
+	trustedProxies   []*net.IPNet // Peers whose forwarded client IP headers are believed
+
+	pathRewrites []pathRewrite // Applied to request paths before anything else
+
+	tunnels *TunnelLimiter // Caps concurrent upgraded connections
+
+	statuses statusCounters // Responses served per status code
+
+	startedAt time.Time // Reported as uptime by the health check
+
+	metrics *PrometheusMetrics // Fed with cache lookups when set, nil disables
+
+	random func() float64 // Source of TTL jitter, uniform in [0, 1)
+
+	ctx    context.Context // Cancelled on shutdown to stop background work
+	cancel context.CancelFunc
 }
 
 // NewProxyHandler creates a new ProxyHandler
 func NewProxyHandler(cache cache.Cache, cfg *config.Config) *ProxyHandler {
 	// Create HTTP client with timeouts
 	client := &http.Client{
-		Timeout: time.Duration(cfg.ProxyTimeout) * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Follow up to 10 redirects
-			if len(via) >= 10 {
-				return fmt.Errorf("stopped after 10 redirects")
-			}
-			return nil
-		},
+		Transport:     newTransport(cfg),
+		Timeout:       time.Duration(cfg.ProxyTimeout) * time.Second,
+		CheckRedirect: checkRedirect(cfg.MaxRedirects),
 	}
 
 	// Define cacheable HTTP methods
@@ -43,93 +88,255 @@ func NewProxyHandler(cache cache.Cache, cfg *config.Config) *ProxyHandler {
 		http.MethodGet:  true,
 		http.MethodHead: true,
 	}
+	if cfg.CacheablePOST {
+		cacheables[http.MethodPost] = true
+	}
 
 	// Create a new worker pool
-	workerPool := NewWorkerPool(cfg.MaxConnections)
+	workerPool := NewWorkerPoolWithOptions(WorkerPoolOptions{
+		MaxWorkers:  cfg.MaxConnections,
+		MinWorkers:  cfg.MinWorkers,
+		IdleTimeout: time.Duration(cfg.WorkerIdleTimeout) * time.Second,
+		FullTimeout: time.Duration(cfg.QueueFullTimeout) * time.Millisecond,
+	})
+
+	// Shed load based on how full the worker pool queue is, among other signals
+	shedder := NewLoadShedder(ShedOptions{
+		Threshold:        cfg.ShedThreshold,
+		Fraction:         cfg.ShedFraction,
+		MaxInflightBytes: cfg.ShedMaxInflightBytes,
+	}, func() float64 {
+		return float64(workerPool.QueueLength()) / float64(workerPool.QueueCapacity())
+	})
 
-	return &ProxyHandler{
+	p := &ProxyHandler{
 		cache:      cache,
+		varies:     newVaryIndex(cfg.CacheSize),
 		client:     client,
 		config:     cfg,
+		settings:   config.NewHolder(cfg),
 		cacheables: cacheables,
 		workerPool: workerPool,
+
+		upstreamTLS: make(map[string]TLSDetails),
+		inflight:    make(map[string]*inflightCall),
+
+		refreshLimiter: NewRefreshLimiter(cfg.MaxConcurrentRefreshes),
+		refreshing:     make(map[string]struct{}),
+		compression:    parseCacheCompression(cfg.CacheCompression),
+		shedder:        shedder,
+
+		cacheBypassPeers: parseNetworks(cfg.CacheBypassPeers),
+		trustedProxies:   parseNetworks(cfg.TrustedProxies),
+		pathRewrites:     compilePathRewrites(cfg.PathRewrites),
+		tunnels:          NewTunnelLimiter(cfg.MaxTunnels, cfg.MaxTunnelsPerIP),
+
+		startedAt: time.Now(),
+		random:    rand.Float64,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.admin = p.adminHandler()
+	if cfg.EnablePprof {
+		p.pprof = p.pprofHandler()
 	}
+
+	return p
 }
 
 // ServeHTTP implements the http.Handler interface
 func (p *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&p.inFlight, 1)
+	defer atomic.AddInt64(&p.inFlight, -1)
+
+	// Requests for the proxy itself rather than a target, unless those are
+	// served on a separate admin listener
+	if p.config.AdminPort == 0 {
+		if isAdminRequest(r) {
+			p.admin.ServeHTTP(w, r)
+			return
+		}
+		if p.pprof != nil && isPprofRequest(r) {
+			p.pprof.ServeHTTP(w, r)
+			return
+		}
+		if p.serveHealth(w, r) {
+			return
+		}
+	}
+
+	// Tunnels live far longer than a request, keep them off the worker pool
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+	if isUpgradeRequest(r) {
+		p.handleUpgrade(w, r)
+		return
+	}
+
+	// Count every proxied response by the status it was answered with
+	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	defer func() { p.statuses.record(rw.statusCode) }()
+	w = rw
+
+	// Turn requests away early rather than letting them time out in the queue
+	priority := p.requestPriority(r)
+	if p.shedder.Shed(priority) {
+		w.Header().Set("Retry-After", strconv.Itoa(p.config.ShedRetryAfter))
+		http.Error(w, "Server overloaded, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Create a handler for the request
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		p.handleRequest(w, r)
 	})
 
+	// Bound the time spent waiting for a worker, on top of the request's own deadline
+	ctx := r.Context()
+	if p.config.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.config.QueueTimeout)*time.Second)
+		defer cancel()
+	}
+
 	// Enqueue the request to be processed by a worker
-	p.workerPool.Enqueue(w, r, handler)
+	if err := p.workerPool.EnqueueWithPriority(ctx, w, r, handler, priority); err != nil {
+		if errors.Is(err, ErrQueueFull) {
+			p.metrics.recordQueueRejection()
+			w.Header().Set("Retry-After", strconv.Itoa(p.config.ShedRetryAfter))
+			http.Error(w, "Server busy, try again later", http.StatusServiceUnavailable)
+		} else if errors.Is(err, ErrPoolStopped) {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Timed out waiting for a worker", http.StatusGatewayTimeout)
+		} else {
+			http.Error(w, "Request canceled while queued", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// requestPriority determines the worker pool priority of a request based on configuration
+func (p *ProxyHandler) requestPriority(r *http.Request) Priority {
+	if p.config.PriorityHeader != "" {
+		switch strings.ToLower(r.Header.Get(p.config.PriorityHeader)) {
+		case "high":
+			return PriorityHigh
+		case "low":
+			return PriorityLow
+		}
+	}
+
+	for _, prefix := range p.config.HighPriorityPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return PriorityHigh
+		}
+	}
+
+	return PriorityNormal
 }
 
 // handleRequest processes a single HTTP request
 func (p *ProxyHandler) handleRequest(w http.ResponseWriter, r *http.Request) {
-	// Check if the URL is provided as a query parameter
-    targetURLStr := r.URL.Query().Get("url")
-    
-    if targetURLStr != "" {
-        // Parse the target URL from the query parameter
-        parsedURL, err := url.Parse(targetURLStr)
-        if err != nil {
-            http.Error(w, "Invalid URL format", http.StatusBadRequest)
-            return
-        }
-        
-        // Update the request URL
-        r.URL = parsedURL
-    } else if r.URL.Scheme == "" || r.URL.Host == "" {
-        // This is likely a direct request to the proxy without the target URL
-        http.Error(w, "Invalid proxy request. URL must include scheme and host.", http.StatusBadRequest)
-        return
-    }
+	// Consume whatever is left of the request body on every return path
+	// (cache hit, blocked domain, errors) so the connection can be reused
+	defer drainBody(r.Body)
 
-	// Check if the domain is allowed
-	if !p.isDomainAllowed(r.URL.Host) {
-		http.Error(w, "Domain not allowed", http.StatusForbidden)
+	// Point the request at its target, rejecting invalid or disallowed ones
+	if !p.resolveTarget(w, r) {
 		return
 	}
+	p.rewritePath(r)
+
+	// Reject corrupted uploads before the upstream sees them
+	if p.needsChecksum(r) {
+		err := verifyChecksum(r, p.config.ChecksumMaxBytes)
+		if errors.Is(err, errChecksumBodyTooLarge) {
+			http.Error(w, "Request body too large to verify", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Cached POST responses are keyed by the body, which has to be read first
+	if r.Method == http.MethodPost && p.cacheables[http.MethodPost] {
+		if err := bufferRequestBody(r); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Probes from allowlisted clients must measure the live upstream; behind a
+	// load balancer they are recognized by their forwarded address
+	bypass := containsIP(p.cacheBypassPeers, trustedClientIP(r, p.config.TrustProxyHeaders, p.trustedProxies))
+
+	// Stale cache entry that the upstream may confirm is still current
+	var (
+		stale     *CachedResponse
+		staleItem *cache.CacheItem
+	)
 
 	// Check if we can use the cache for this request
-	if p.isCacheable(r) {
+	if p.isCacheable(r) && bypass {
+		logging.Debugf("Cache bypass for %s from %s", p.createCacheKey(r), r.RemoteAddr)
+	} else if p.isCacheable(r) {
 		cacheKey := p.createCacheKey(r)
 		
 		// Try to get from cache
 		if item, found := p.cache.Get(cacheKey); found {
-			log.Printf("Cache hit for %s", cacheKey)
-			
 			// Parse the cached response
-			cachedResp, err := p.parseCachedResponse(item.Value)
+			cachedResp, err := p.parseCachedResponse(item.Value, acceptsStoredGzip(r))
 			if err != nil {
-				log.Printf("Error parsing cached response: %v", err)
-			} else {
-				// Write headers from cached response
-				for key, values := range cachedResp.Header {
-					for _, value := range values {
-						w.Header().Add(key, value)
-					}
-				}
-				
-				// Add cache header
-				w.Header().Set("X-Cache", "HIT")
-				
-				// Set status code
-				w.WriteHeader(cachedResp.StatusCode)
-				
-				// Write body
-				if _, err := w.Write(cachedResp.Body); err != nil {
-					log.Printf("Error writing cached response body: %v", err)
-				}
+				atomic.AddInt64(&p.deserializationErrors, 1)
+				p.metrics.recordCodecError(true)
+				logging.Errorf("Error parsing cached response: key=%q size=%d error=%v", cacheKey, len(item.Value), err)
+			} else if cachedResp.isFresh(time.Now()) {
+				logging.Debugf("Cache hit for %s", cacheKey)
+				p.metrics.recordCacheLookup(true)
 				
+				// Add cache header, marking cached failures distinctly
+				p.writeCachedRange(w, r, item, cachedResp, hitStatus(cachedResp))
 				return
+			} else if cachedResp.servableWhileRevalidating(time.Now()) {
+				logging.Debugf("Serving stale %s while revalidating", cacheKey)
+				p.metrics.recordCacheLookup(true)
+				p.refreshInBackground(cacheKey, r, cachedResp)
+				p.writeCachedRange(w, r, item, cachedResp, "STALE")
+				return
+			} else {
+				// Kept past its lifetime to be revalidated or to stand in
+				// for a failing upstream
+				logging.Debugf("Cache entry stale for %s", cacheKey)
+				stale, staleItem = cachedResp, item
 			}
 		}
 		
-		log.Printf("Cache miss for %s", cacheKey)
+		if stale == nil {
+			logging.Debugf("Cache miss for %s", cacheKey)
+		}
+		p.metrics.recordCacheLookup(false)
+	}
+
+	// Share the result of an identical request that is already in flight,
+	// e.g. when a client retries while its original request is still pending
+	// or when many clients miss the same popular entry at once
+	var inflight *inflightCall
+	dedupKey, cachedOnly := p.dedupKey(r, bypass)
+	if dedupKey != "" {
+		call, leading := p.joinInflight(dedupKey)
+		if leading {
+			// Release waiters on every return path; a failure leaves them
+			// to make their own upstream request rather than sharing it
+			inflight = call
+			defer p.finishInflight(dedupKey, call, nil)
+		} else if shared := p.waitInflight(call); shared != nil {
+			p.writeSharedResponse(w, shared)
+			return
+		}
 	}
 
 	// Clone the request for the target server
@@ -138,15 +345,148 @@ func (p *ProxyHandler) handleRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Error creating proxy request: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if stale != nil {
+		stale.setConditionalHeaders(proxyReq.Header)
+	}
 
 	// Forward the request to the target server
-	resp, err := p.client.Do(proxyReq)
+	resp, err := p.doWithRetry(proxyReq)
+	if err != nil && r.Context().Err() != nil {
+		// The client went away, which says nothing about the upstream
+		logging.Infof("Client disconnected before %s completed: %v", r.URL.String(), err)
+		return
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	p.shedder.RecordResult(failed)
+
+	// Fall back to the stale entry where stale-if-error allows it
+	if failed && stale != nil && stale.servableOnError(time.Now()) {
+		if err == nil {
+			resp.Body.Close()
+		}
+		logging.Warnf("Serving stale response for %s after upstream failure", r.URL.String())
+		p.writeCachedResponse(w, staleItem, stale, "STALE")
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error forwarding request: %v", err), http.StatusBadGateway)
+		status, reason := classifyUpstreamError(err)
+		writeProxyError(w, status, reason, fmt.Sprintf("Error forwarding request: %v", err))
 		return
 	}
 	defer resp.Body.Close()
 
+	p.prepareResponse(r, resp)
+
+	// The stale entry is still current, serve it for another lifetime
+	if stale != nil && resp.StatusCode == http.StatusNotModified {
+		cacheKey := p.createCacheKey(r)
+		logging.Debugf("Cache entry revalidated for %s", cacheKey)
+		p.writeCachedRange(w, r, p.revalidate(cacheKey, stale, resp), stale, "REVALIDATED")
+		return
+	}
+
+	// Replace configured upstream errors with a friendlier static response
+	if rule := p.fallbackFor(r.URL.Hostname(), resp.StatusCode); rule != nil {
+		logging.Infof("Serving fallback response for %s (upstream status %d)", r.URL.String(), resp.StatusCode)
+		p.writeFallback(w, rule)
+		return
+	}
+
+	// Drop configured cookies before they reach the client or the cache
+	p.stripCookies(r, resp)
+
+	// Check if we should cache this response; bypassing clients may be kept from storing too
+	store := p.isCacheable(r) && (!bypass || p.config.CacheBypassStore)
+	cacheable := store && p.isResponseCacheable(resp)
+	negativeTTL, negative := p.negativeCacheTTL(r.URL.Hostname(), resp)
+	negative = negative && store && !cacheable
+
+	// Collapsed misses must not hand out responses other clients wouldn't
+	// get from the cache, nor a variant chosen by someone else's headers
+	if inflight != nil && cachedOnly && (!cacheable || len(resp.Header.Values("Vary")) > 0) {
+		p.finishInflight(dedupKey, inflight, nil)
+		inflight = nil
+	}
+
+	// Decode gzip bodies that we asked not to get, that the client can't take
+	// or that other clients get as well
+	if p.needsGzipDecoding(r, resp, cacheable || negative || inflight != nil) {
+		if err := decodeGzipResponse(resp); err != nil {
+			http.Error(w, fmt.Sprintf("Error decoding upstream response: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+
+	// Only bodies that are stored or shared with duplicates need to be held
+	// in memory, everything else goes straight through to the client
+	if !cacheable && !negative && inflight == nil {
+		p.streamResponse(w, r, resp, bypass)
+		return
+	}
+
+	// Read response body before committing to a status, so oversized bodies
+	// can still be turned into an error
+	body, err := p.readResponseBody(resp)
+	if errors.Is(err, errResponseTooLarge) {
+		logging.Warnf("Rejecting response for %s: %v", r.URL.String(), err)
+		http.Error(w, "Upstream response too large", http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		logging.Errorf("Error reading response body: %v", err)
+		http.Error(w, fmt.Sprintf("Error reading upstream response: %v", err), http.StatusBadGateway)
+		return
+	}
+	p.shedder.TrackBytes(int64(len(body)))
+	defer p.shedder.TrackBytes(-int64(len(body)))
+
+	p.writeResponseHeader(w, resp, bypass)
+
+	// Hand successful responses over to duplicates waiting on this request
+	if inflight != nil && resp.StatusCode < http.StatusInternalServerError {
+		p.finishInflight(dedupKey, inflight, &CachedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       body,
+		})
+	}
+
+	if cacheable {
+		// Store response in cache
+		p.cacheFetchedResponse(r, resp, body)
+	} else if negative {
+		// Briefly remember the failure to spare the struggling upstream
+		p.recordVary(r, resp)
+		p.storeResponse(p.createCacheKey(r), resp, body, negativeTTL)
+	}
+
+	// Write response body to client
+	if _, err := w.Write(body); err != nil {
+		logging.Errorf("Error writing response body: %v", err)
+	}
+}
+
+// prepareResponse processes the headers of an upstream response before it
+// reaches the client or the cache, whether it was fetched for a client or by
+// a background refresh
+func (p *ProxyHandler) prepareResponse(r *http.Request, resp *http.Response) {
+	// Keep track of the security posture of HTTPS upstreams
+	p.recordUpstreamTLS(r.URL.Host, resp.TLS)
+
+	// Neither the client nor the cache get the upstream connection's headers
+	removeHopByHopHeaders(resp.Header)
+	p.rewriteResponseHeaders(r.URL.Hostname(), resp.Header)
+}
+
+// cacheFetchedResponse remembers what a response varies on and stores it
+// under the key of the variant the request asked for
+func (p *ProxyHandler) cacheFetchedResponse(r *http.Request, resp *http.Response, body []byte) {
+	p.recordVary(r, resp)
+	p.cacheResponse(p.createCacheKey(r), resp, body)
+}
+
+// writeResponseHeader copies the upstream headers and status to the client
+func (p *ProxyHandler) writeResponseHeader(w http.ResponseWriter, resp *http.Response, bypass bool) {
 	// Copy headers from target response to client response
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -156,49 +496,250 @@ func (p *ProxyHandler) handleRequest(w http.ResponseWriter, r *http.Request) {
 
 	// Add proxy headers
 	w.Header().Set("X-Proxy-Server", "Go-Proxy-Server/1.0")
-	w.Header().Set("X-Cache", "MISS")
+	if bypass {
+		w.Header().Set("X-Cache", "BYPASS")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
 
 	// Set status code
 	w.WriteHeader(resp.StatusCode)
+}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+// streamResponse relays a response that won't be cached to the client as it
+// arrives, flushing after every read so that nothing waits on the full body
+func (p *ProxyHandler) streamResponse(w http.ResponseWriter, r *http.Request, resp *http.Response, bypass bool) {
+	limit := p.config.MaxResponseBytes
+	if limit > 0 && resp.ContentLength > limit {
+		logging.Warnf("Rejecting response for %s: %v: declared %d bytes, limit %d", r.URL.String(), errResponseTooLarge, resp.ContentLength, limit)
+		http.Error(w, "Upstream response too large", http.StatusBadGateway)
+		return
+	}
+
+	p.writeResponseHeader(w, resp, bypass)
+
+	controller := http.NewResponseController(w)
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			if limit > 0 && written > limit {
+				// The status is already out, so cut the connection to keep
+				// the client from taking the truncated body as complete
+				logging.Warnf("Aborting response for %s: %v: more than %d bytes", r.URL.String(), errResponseTooLarge, limit)
+				abortResponse(controller)
+				return
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				logging.Errorf("Error writing response body: %v", err)
+				return
+			}
+			controller.Flush()
+		}
+		if readErr == io.EOF {
+			return
+		}
+		if readErr != nil {
+			logging.Errorf("Error reading response body: %v", readErr)
+			abortResponse(controller)
+			return
+		}
+	}
+}
+
+// abortResponse closes the client connection mid-response where the protocol
+// allows it
+func abortResponse(controller *http.ResponseController) {
+	conn, _, err := controller.Hijack()
 	if err != nil {
-		log.Printf("Error reading response body: %v", err)
 		return
 	}
+	conn.Close()
+}
 
-	// Check if we should cache this response
-	if p.isCacheable(r) && p.isResponseCacheable(resp) {
-		cacheKey := p.createCacheKey(r)
-		
-		// Store response in cache
-		p.cacheResponse(cacheKey, resp, body)
+// resolveTarget rewrites the request URL to the proxied target and checks it
+// against the allowed domains, writing an error response if it is rejected
+func (p *ProxyHandler) resolveTarget(w http.ResponseWriter, r *http.Request) bool {
+	// Check if the URL is provided as a query parameter
+	targetURLStr := targetURLParam(r.URL.RawQuery)
+
+	if targetURLStr != "" {
+		// Parse and validate the target URL from the query parameter
+		parsedURL, err := parseTargetURL(targetURLStr)
+		if err != nil {
+			writeProxyError(w, http.StatusBadRequest, reasonInvalidTarget, fmt.Sprintf("Invalid URL format: %v", err))
+			return false
+		}
+
+		// Update the request URL
+		r.URL = parsedURL
+	} else if r.URL.Scheme == "" || r.URL.Host == "" {
+		// This is likely a direct request to the proxy without the target URL
+		writeProxyError(w, http.StatusBadRequest, reasonInvalidTarget, "Invalid proxy request. URL must include scheme and host.")
+		return false
 	}
 
-	// Write response body to client
-	if _, err := w.Write(body); err != nil {
-		log.Printf("Error writing response body: %v", err)
+	// Blocked domains are rejected even when allowed
+	if p.isDomainBlocked(r.URL.Hostname()) {
+		http.Error(w, "Domain blocked", http.StatusForbidden)
+		return false
 	}
+
+	// Check if the domain is allowed
+	if !p.isDomainAllowed(r.URL.Hostname()) {
+		http.Error(w, "Domain not allowed", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// errResponseTooLarge is returned for upstream bodies over MaxResponseBytes
+var errResponseTooLarge = errors.New("response body exceeds limit")
+
+// readResponseBody reads the upstream body, failing early once it is known to
+// exceed the configured maximum response size
+func (p *ProxyHandler) readResponseBody(resp *http.Response) ([]byte, error) {
+	limit := p.config.MaxResponseBytes
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: declared %d bytes, limit %d", errResponseTooLarge, resp.ContentLength, limit)
+	}
+
+	// Read one byte past the limit to tell a full body from an oversized one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, limit)
+	}
+	return body, nil
+}
+
+// maxDrainBytes bounds how much of an unread request body is discarded before
+// giving up on the connection
+const maxDrainBytes = 1 << 20
+
+// drainBody discards the remainder of a request body and closes it
+func drainBody(body io.ReadCloser) {
+	if body == nil || body == http.NoBody {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
+
+// Settings returns the holder of the handler's reloadable configuration
+func (p *ProxyHandler) Settings() *config.Holder {
+	return p.settings
+}
+
+// SetMetrics makes the handler count its cache lookups and tunnels in the metrics
+func (p *ProxyHandler) SetMetrics(metrics *PrometheusMetrics) {
+	p.metrics = metrics
+	p.tunnels.SetMetrics(metrics)
+}
+
+// SetRandomSource replaces the source of TTL jitter, which must return
+// values in [0, 1); tests use it to make expirations predictable
+func (p *ProxyHandler) SetRandomSource(random func() float64) {
+	p.random = random
+}
+
+// DroppedRefreshes returns the number of background refreshes dropped because
+// the concurrent refresh limit was reached
+func (p *ProxyHandler) DroppedRefreshes() int64 {
+	return p.refreshLimiter.Dropped()
 }
 
-// Shutdown gracefully shuts down the proxy handler
+// CacheStats returns the statistics of the underlying cache together with the
+// proxy's own serialization error counters
+func (p *ProxyHandler) CacheStats() cache.CacheStats {
+	stats := p.cache.Stats()
+	stats.SerializationErrors = atomic.LoadInt64(&p.serializationErrors)
+	stats.DeserializationErrors = atomic.LoadInt64(&p.deserializationErrors)
+	return stats
+}
+
+// LoadPressure returns the most recently sampled load pressure between 0 and 1
+func (p *ProxyHandler) LoadPressure() float64 {
+	return p.shedder.Pressure()
+}
+
+// ShedRequests returns the number of requests rejected by load shedding
+func (p *ProxyHandler) ShedRequests() int64 {
+	return p.shedder.ShedCount()
+}
+
+// Workers returns the number of workers currently serving requests
+func (p *ProxyHandler) Workers() int {
+	return p.workerPool.Workers()
+}
+
+// RejectedRequests returns the number of requests turned away because the
+// worker pool queue was full
+func (p *ProxyHandler) RejectedRequests() int64 {
+	return p.workerPool.Rejected()
+}
+
+// Context returns a context that is cancelled once the handler shuts down,
+// for middleware whose background work should end along with it
+func (p *ProxyHandler) Context() context.Context {
+	return p.ctx
+}
+
+// Shutdown gracefully shuts down the proxy handler, waiting for all queued
+// requests to be served
 func (p *ProxyHandler) Shutdown() {
+	p.ShutdownContext(context.Background())
+}
+
+// ShutdownContext gracefully shuts down the proxy handler, waiting for queued
+// requests to be served and background refreshes to finish until ctx is done
+func (p *ProxyHandler) ShutdownContext(ctx context.Context) error {
+	p.cancel()
+	p.shedder.Stop()
+	var err error
 	if p.workerPool != nil {
-		p.workerPool.Stop()
+		err = p.workerPool.Stop(ctx)
+	}
+
+	// Background refreshes still write to the cache, which may be saved
+	// once this returns
+	if refreshErr := p.refreshLimiter.Stop(ctx); err == nil {
+		err = refreshErr
 	}
+	return err
 }
 
-// isDomainAllowed checks if the domain is allowed based on configuration
+// isDomainBlocked checks if the domain is on the configured denylist; host
+// must not carry a port
+func (p *ProxyHandler) isDomainBlocked(host string) bool {
+	for _, domain := range p.settings.Load().BlockedDomains {
+		if config.MatchDomain(domain, host, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDomainAllowed checks if the domain is allowed based on configuration;
+// host must not carry a port
 func (p *ProxyHandler) isDomainAllowed(host string) bool {
 	// If no allowed domains are specified, all domains are allowed
-	if len(p.config.AllowedDomains) == 0 {
+	settings := p.settings.Load()
+	if len(settings.AllowedDomains) == 0 {
 		return true
 	}
 
 	// Check if the host is in the allowed domains list
-	for _, domain := range p.config.AllowedDomains {
-		if strings.HasSuffix(host, domain) {
+	for _, domain := range settings.AllowedDomains {
+		if config.MatchDomain(domain, host, settings.AllowedDomainsExact) {
 			return true
 		}
 	}
@@ -213,6 +754,11 @@ func (p *ProxyHandler) isCacheable(r *http.Request) bool {
 		return false
 	}
 
+	// POST bodies too large to hash were never buffered
+	if r.Method == http.MethodPost && r.GetBody == nil {
+		return false
+	}
+
 	// Don't cache if there's an Authorization header
 	if r.Header.Get("Authorization") != "" {
 		return false
@@ -229,14 +775,30 @@ func (p *ProxyHandler) isCacheable(r *http.Request) bool {
 
 // isResponseCacheable checks if the response can be cached
 func (p *ProxyHandler) isResponseCacheable(resp *http.Response) bool {
-	// Only cache successful responses
+	// Only cache successful responses; a 206 holds just part of the resource
 	if resp.StatusCode != http.StatusOK {
 		return false
 	}
 
+	// Some upstreams are configured to never be cached
+	if override := p.domainOverride(resp); override != nil && override.NoCache {
+		return false
+	}
+
 	// Don't cache if there's a Cache-Control: no-store header
-	cacheControl := resp.Header.Get("Cache-Control")
-	if strings.Contains(cacheControl, "no-store") {
+	directives := parseCacheControl(resp.Header)
+	if directives.has("no-store") {
+		return false
+	}
+
+	// no-cache responses must be revalidated before every use, which takes
+	// a validator and a window to keep them in
+	if directives.has("no-cache") && (p.config.RevalidateWindow <= 0 || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "")) {
+		return false
+	}
+
+	// Vary: * depends on more than the request, no variant key can capture it
+	if _, wildcard := parseVary(resp.Header); wildcard {
 		return false
 	}
 
@@ -248,10 +810,142 @@ func (p *ProxyHandler) isResponseCacheable(resp *http.Response) bool {
 	return true
 }
 
-// createCacheKey creates a unique key for the request
+// writeCachedResponse serves a response from the cache with the given X-Cache status
+func (p *ProxyHandler) writeCachedResponse(w http.ResponseWriter, item *cache.CacheItem, cachedResp *CachedResponse, status string) {
+	// Report the response's own lifetime and age rather than how long and
+	// since when it is retained
+	view := *item
+	if !cachedResp.FreshUntil.IsZero() {
+		view.ExpiresAt = cachedResp.FreshUntil
+	}
+	if !cachedResp.CreatedAt.IsZero() {
+		view.CreatedAt = cachedResp.CreatedAt
+	}
+	item = &view
+
+	// Write headers from cached response
+	for key, values := range cachedResp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	// A body stored gzipped goes out as it is
+	if cachedResp.BodyGzipped {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(cachedResp.Body)))
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	// Reflect our own freshness so downstream caches don't over-cache
+	p.setFreshnessHeaders(w.Header(), item)
+
+	// Add configured diagnostic headers, which only ever appear on hits
+	p.addCacheHitHeaders(w.Header(), item)
+
+	w.Header().Set("X-Cache", status)
+
+	// Set status code
+	w.WriteHeader(cachedResp.StatusCode)
+
+	// Write body
+	if _, err := w.Write(cachedResp.Body); err != nil {
+		logging.Errorf("Error writing cached response body: %v", err)
+	}
+}
+
+// setFreshnessHeaders sets the Age of a cached item and rewrites the max-age
+// directives to the lifetime it has left
+func (p *ProxyHandler) setFreshnessHeaders(header http.Header, item *cache.CacheItem) {
+	age := int(time.Since(item.CreatedAt) / time.Second)
+	header.Set("Age", strconv.Itoa(age))
+
+	cacheControl := header.Get("Cache-Control")
+	if cacheControl == "" || item.ExpiresAt.IsZero() {
+		return
+	}
+
+	// Remaining lifetime is the original lifetime minus the age
+	lifetime := int(item.ExpiresAt.Sub(item.CreatedAt).Round(time.Second) / time.Second)
+	remaining := lifetime - age
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	directives := strings.Split(cacheControl, ",")
+	for i, directive := range directives {
+		directive = strings.TrimSpace(directive)
+		name, _, _ := strings.Cut(directive, "=")
+		switch strings.ToLower(name) {
+		case "max-age", "s-maxage":
+			directive = fmt.Sprintf("%s=%d", name, remaining)
+		}
+		directives[i] = directive
+	}
+	header.Set("Cache-Control", strings.Join(directives, ", "))
+}
+
+// addCacheHitHeaders adds the configured cache-hit headers, expanding entry metadata placeholders
+func (p *ProxyHandler) addCacheHitHeaders(header http.Header, item *cache.CacheItem) {
+	if len(p.config.CacheHitHeaders) == 0 {
+		return
+	}
+
+	expiresAt := ""
+	if !item.ExpiresAt.IsZero() {
+		expiresAt = item.ExpiresAt.UTC().Format(http.TimeFormat)
+	}
+	replacer := strings.NewReplacer(
+		"{age}", strconv.Itoa(int(time.Since(item.CreatedAt)/time.Second)),
+		"{created_at}", item.CreatedAt.UTC().Format(http.TimeFormat),
+		"{expires_at}", expiresAt,
+		"{size}", strconv.Itoa(item.Size),
+	)
+
+	for name, value := range p.config.CacheHitHeaders {
+		header.Set(name, replacer.Replace(value))
+	}
+}
+
+// createCacheKey creates a unique key for the request, selecting the variant
+// for its headers when the responses for its URL carry Vary
 func (p *ProxyHandler) createCacheKey(r *http.Request) string {
-	// Simple key format: METHOD:URL
-	return fmt.Sprintf("%s:%s", r.Method, r.URL.String())
+	key := p.baseCacheKey(r)
+	if names := p.varyNames(key); names != nil {
+		return variantKey(key, names, r)
+	}
+	return key
+}
+
+// baseCacheKey creates the key for the request regardless of Vary
+func (p *ProxyHandler) baseCacheKey(r *http.Request) string {
+	// Simple key format: METHOD:URL, prefixed by the salt when one is configured
+	// so that changing it leaves old entries to age out unreachable
+	target := p.cacheKeyURL(r.URL)
+	if r.Method == http.MethodPost {
+		// Different payloads to the same URL must not share an entry
+		target += "|sha256=" + requestBodyHash(r)
+	}
+	if salt := p.config.CacheKeySalt; salt != "" {
+		return fmt.Sprintf("%s|%s:%s", salt, r.Method, target)
+	}
+	return fmt.Sprintf("%s:%s", r.Method, target)
+}
+
+// cacheKeyURL returns the URL as used in cache keys, with the path normalized
+// by the first matching rule; the forwarded request is left untouched
+func (p *ProxyHandler) cacheKeyURL(u *url.URL) string {
+	for _, rule := range p.config.CacheKeyNormalization {
+		if rule.Host != "" && !strings.EqualFold(rule.Host, u.Hostname()) {
+			continue
+		}
+
+		normalized := *u
+		normalized.Path = rule.Normalize(u.Path)
+		normalized.RawPath = ""
+		return normalized.String()
+	}
+	return u.String()
 }
 
 // cloneRequest creates a new request for the target server
@@ -259,12 +953,21 @@ func (p *ProxyHandler) cloneRequest(r *http.Request) (*http.Request, error) {
 	// Create a new URL from the request URL
 	targetURL := *r.URL
 
-	// Create a new request
-	proxyReq, err := http.NewRequest(r.Method, targetURL.String(), r.Body)
+	// Create a new request, canceled along with the client's
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), r.Body)
 	if err != nil {
 		return nil, err
 	}
 
+	// A buffered body was already read for the cache key, forward a fresh copy
+	if r.GetBody != nil {
+		if proxyReq.Body, err = r.GetBody(); err != nil {
+			return nil, err
+		}
+		proxyReq.GetBody = r.GetBody
+		proxyReq.ContentLength = r.ContentLength
+	}
+
 	// Copy headers
 	proxyReq.Header = make(http.Header)
 	for key, values := range r.Header {
@@ -277,147 +980,325 @@ func (p *ProxyHandler) cloneRequest(r *http.Request) (*http.Request, error) {
 	proxyReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
 	proxyReq.Header.Set("X-Forwarded-Host", r.Host)
 
-	// Don't pass the Connection header
-	proxyReq.Header.Del("Connection")
+	// Don't pass headers meant for the connection to us
+	removeHopByHopHeaders(proxyReq.Header)
+
+	// Negotiate our own encoding with the upstream when configured
+	if encoding := p.config.UpstreamAcceptEncoding; encoding != "" {
+		proxyReq.Header.Set("Accept-Encoding", encoding)
+	}
+
+	// Configured rewrites come last so they can override anything above
+	p.rewriteRequestHeaders(r.URL.Hostname(), proxyReq.Header)
 
 	return proxyReq, nil
 }
 
+// needsGzipDecoding checks if a gzip-encoded upstream response has to be
+// decoded, either because we requested identity or the client doesn't accept
+// gzip. Shared responses are cached or handed to duplicate requests, whose
+// clients may not accept gzip either; the cache key ignores Accept-Encoding,
+// and storage compresses large bodies again on its own.
+func (p *ProxyHandler) needsGzipDecoding(r *http.Request, resp *http.Response, shared bool) bool {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return false
+	}
+	if shared {
+		return true
+	}
+
+	switch p.config.UpstreamAcceptEncoding {
+	case "identity":
+		return true
+	case "gzip":
+		return !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+	}
+	return false
+}
+
+// decodeGzipResponse replaces a gzip-encoded response body with its decoded form
+func decodeGzipResponse(resp *http.Response) error {
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = reader
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
 // CachedResponse represents a cached HTTP response
 type CachedResponse struct {
 	StatusCode int
 	Header     http.Header
 	Body       []byte
+
+	// BodyGzipped is set when Body is stored gzip-compressed; Header always
+	// describes the decoded body
+	BodyGzipped bool
+
+	// Validators the upstream can check a stale copy against
+	ETag         string
+	LastModified string
+
+	// CreatedAt is when the upstream generated the response, which is
+	// earlier than when it was cached if it passed through other caches
+	CreatedAt time.Time
+
+	// FreshUntil is when the response goes stale; zero means it is fresh for
+	// as long as it is cached
+	FreshUntil time.Time
+
+	// Cache-Control directives that govern serving the response once stale
+	NoCache        bool // Revalidate before every use
+	MustRevalidate bool // Never serve stale, not even when the upstream fails
+	StaleIfError   int  // Seconds past FreshUntil it may be served when the upstream fails
+
+	// StaleWhileRevalidate is the number of seconds past FreshUntil the
+	// response may be served while it is refreshed in the background
+	StaleWhileRevalidate int
 }
 
 // cacheResponse stores a response in the cache
 func (p *ProxyHandler) cacheResponse(key string, resp *http.Response, body []byte) {
+	ttl := p.responseTTL(resp)
+	if ttl <= 0 {
+		logging.Debugf("Not caching %s: stale on arrival", key)
+		return
+	}
+	p.storeResponse(key, resp, body, ttl)
+}
+
+// responseTTL determines how long a response stays fresh
+func (p *ProxyHandler) responseTTL(resp *http.Response) time.Duration {
 	// Determine cache TTL from Cache-Control header
 	ttl := p.calculateTTL(resp)
 	if ttl <= 0 {
 		// Use default TTL from config
-		ttl = time.Duration(p.config.CacheTTL) * time.Second
+		ttl = p.defaultTTL(resp)
+	}
+
+	// Time spent in upstream caches counts against the lifetime
+	return ttl - responseAge(resp.Header)
+}
+
+// responseAge returns the Age the upstream reported for a response
+func responseAge(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header.Get("Age")))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// jitterTTL spreads ttl by up to the configured jitter fraction in either
+// direction, so entries cached in one burst don't all expire at once
+func (p *ProxyHandler) jitterTTL(ttl time.Duration) time.Duration {
+	jitter := p.config.CacheTTLJitter
+	if jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(float64(ttl)*jitter*(2*p.random()-1))
+}
+
+// storeResponse serializes a response and stores it in the cache for ttl
+func (p *ProxyHandler) storeResponse(key string, resp *http.Response, body []byte, ttl time.Duration) {
+	// A few huge entries would push out many useful small ones
+	if limit := p.maxCacheableBytes(resp); limit > 0 && int64(len(body)) > limit {
+		logging.Debugf("Not caching %s: body of %d bytes exceeds %d", key, len(body), limit)
+		return
 	}
 
-	// Serialize the response
 	cachedResp := &CachedResponse{
-		StatusCode: resp.StatusCode,
-		Header:     resp.Header.Clone(),
-		Body:       body,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		CreatedAt:    time.Now().Add(-responseAge(resp.Header)),
 	}
+	cachedResp.applyDirectives()
+	p.storeCachedResponse(key, cachedResp, ttl)
+}
 
-	serialized, err := p.serializeResponse(cachedResp)
+// storeCachedResponse serializes a response and stores it in the cache for
+// ttl. Entries that can be revalidated or served stale on errors are kept
+// beyond that and marked stale once ttl has passed.
+func (p *ProxyHandler) storeCachedResponse(key string, cachedResp *CachedResponse, ttl time.Duration) *cache.CacheItem {
+	ttl = p.jitterTTL(ttl)
+
+	var retain time.Duration
+	if window := time.Duration(p.config.RevalidateWindow) * time.Second; window > 0 && cachedResp.hasValidators() {
+		retain = window
+	}
+	if staleIfError := time.Duration(cachedResp.StaleIfError) * time.Second; staleIfError > retain {
+		retain = staleIfError
+	}
+	if staleWhileRevalidate := time.Duration(cachedResp.StaleWhileRevalidate) * time.Second; staleWhileRevalidate > retain {
+		retain = staleWhileRevalidate
+	}
+
+	cachedResp.FreshUntil = time.Time{}
+	storeTTL := ttl
+	if retain > 0 {
+		// no-cache responses are stale from the start
+		freshFor := ttl
+		if cachedResp.NoCache {
+			freshFor = 0
+		}
+		cachedResp.FreshUntil = time.Now().Add(freshFor)
+		storeTTL += retain
+	}
+
+	serialized, err := p.serializeResponse(gzipCachedBody(cachedResp, p.config.CacheGzipMinSize))
 	if err != nil {
-		log.Printf("Error serializing response: %v", err)
-		return
+		atomic.AddInt64(&p.serializationErrors, 1)
+		p.metrics.recordCodecError(false)
+		logging.Errorf("Error serializing response: key=%q status=%d error=%v", key, cachedResp.StatusCode, err)
+		return nil
 	}
 
 	// Store in cache
-	p.cache.Set(key, serialized, ttl)
-	log.Printf("Cached response for %s (%d bytes) with TTL %v", key, len(serialized), ttl)
+	p.cache.Set(key, serialized, storeTTL)
+	logging.Debugf("Cached response for %s (%d bytes) with TTL %v", key, len(serialized), ttl)
+
+	// Describe the entry rather than reading it back, which for a remote
+	// cache would transfer the body once more
+	return cache.NewCacheItem(key, serialized, storeTTL)
 }
 
-// calculateTTL calculates the TTL from Cache-Control header
+// calculateTTL calculates the TTL from the response headers, clamped to the configured bounds
 func (p *ProxyHandler) calculateTTL(resp *http.Response) time.Duration {
-    // Check for Cache-Control: max-age
-    cacheControl := resp.Header.Get("Cache-Control")
-    if cacheControl != "" {
-        directives := strings.Split(cacheControl, ",")
-        for _, directive := range directives {
-            directive = strings.TrimSpace(directive)
-            if strings.HasPrefix(directive, "max-age=") {
-                value := strings.TrimPrefix(directive, "max-age=")
-                if seconds, err := strconv.Atoi(value); err == nil {
-                    return time.Duration(seconds) * time.Second
-                }
-            }
-        }
-    }
-
-    // Check for Expires header
-    if expires := resp.Header.Get("Expires"); expires != "" {
-        // Try multiple time formats that might be used in HTTP headers
-        formats := []string{
-            time.RFC1123,
-            time.RFC1123Z,
-            "Mon, 02-Jan-2006 15:04:05 MST",
-            "Monday, 02-Jan-2006 15:04:05 MST",
-        }
-        
-        for _, format := range formats {
-            if expiresTime, err := time.Parse(format, expires); err == nil {
-                return time.Until(expiresTime)
-            }
-        }
-    }
-
-    // Return default TTL from config
-    return time.Duration(p.config.CacheTTL) * time.Second
-}
-// serializeResponse serializes a CachedResponse to a byte array
-func (p *ProxyHandler) serializeResponse(resp *CachedResponse) ([]byte, error) {
-	// For simplicity, we'll use a simple format:
-	// - First line: Status code
-	// - Headers (one per line, key: value)
-	// - Empty line
-	// - Body
-	var buf bytes.Buffer
+	ttl := p.headerTTL(resp)
 
-	// Write status code
-	fmt.Fprintf(&buf, "%d\r\n", resp.StatusCode)
+	if maxTTL := time.Duration(p.config.MaxCacheTTL) * time.Second; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+	if minTTL := time.Duration(p.config.MinCacheTTL) * time.Second; minTTL > 0 && ttl > 0 && ttl < minTTL {
+		ttl = minTTL
+	}
 
-	// Write headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	return ttl
+}
+
+// headerTTL determines the TTL from the Cache-Control, Expires and Last-Modified headers
+func (p *ProxyHandler) headerTTL(resp *http.Response) time.Duration {
+	// Check for Cache-Control: max-age
+	cacheControl := resp.Header.Get("Cache-Control")
+	if cacheControl != "" {
+		directives := strings.Split(cacheControl, ",")
+		for _, directive := range directives {
+			directive = strings.TrimSpace(directive)
+			if strings.HasPrefix(directive, "max-age=") {
+				value := strings.TrimPrefix(directive, "max-age=")
+				if seconds, err := strconv.Atoi(value); err == nil {
+					return time.Duration(seconds) * time.Second
+				}
+			}
 		}
 	}
 
-	// Empty line to separate headers from body
-	buf.WriteString("\r\n")
+	// Check for Expires header
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		// Try multiple time formats that might be used in HTTP headers
+		formats := []string{
+			time.RFC1123,
+			time.RFC1123Z,
+			"Mon, 02-Jan-2006 15:04:05 MST",
+			"Monday, 02-Jan-2006 15:04:05 MST",
+		}
 
-	// Write body
-	buf.Write(resp.Body)
+		for _, format := range formats {
+			if expiresTime, err := time.Parse(format, expires); err == nil {
+				return time.Until(expiresTime)
+			}
+		}
+	}
 
-	return buf.Bytes(), nil
+	// Heuristic freshness: a fraction of the time since the last modification,
+	// as content that hasn't changed for long is unlikely to change soon
+	if fraction := p.config.LastModifiedFraction; fraction > 0 {
+		if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			if age := time.Since(lastModified); age > 0 {
+				return time.Duration(float64(age) * fraction)
+			}
+		}
+	}
+
+	// Return default TTL from config
+	return p.defaultTTL(resp)
 }
 
-// parseCachedResponse deserializes a byte array to a CachedResponse
-func (p *ProxyHandler) parseCachedResponse(data []byte) (*CachedResponse, error) {
-	// Split data into headers and body
-	parts := bytes.SplitN(data, []byte("\r\n\r\n"), 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid cached response format")
+// parseCacheCompression resolves the configured cache compression algorithm,
+// falling back to uncompressed entries for unknown names
+func parseCacheCompression(name string) cache.Compression {
+	compression, err := cache.ParseCompression(name)
+	if err != nil {
+		logging.Errorf("Error parsing cache compression: %v", err)
 	}
+	return compression
+}
 
-	// Parse headers
-	headerLines := bytes.Split(parts[0], []byte("\r\n"))
-	if len(headerLines) < 1 {
-		return nil, fmt.Errorf("invalid cached response headers")
+// serializeResponse serializes a CachedResponse to a byte array
+func (p *ProxyHandler) serializeResponse(resp *CachedResponse) ([]byte, error) {
+	data, err := EncodeCachedResponse(resp)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse status code
-	statusCode := 0
-	if _, err := fmt.Sscanf(string(headerLines[0]), "%d", &statusCode); err != nil {
-		return nil, fmt.Errorf("invalid status code: %v", err)
+	// Compress the entry; the algorithm is recorded alongside the data
+	return cache.Compress(data, p.compression)
+}
+
+// parseCachedResponse deserializes a byte array to a CachedResponse. A body
+// stored gzipped is decoded unless keepGzip is set.
+func (p *ProxyHandler) parseCachedResponse(data []byte, keepGzip bool) (*CachedResponse, error) {
+	// Entries carry their own compression marker, so this works for entries
+	// written under a previously configured algorithm as well
+	data, err := cache.Decompress(data)
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse headers
-	headers := make(http.Header)
-	for _, line := range headerLines[1:] {
-		headerParts := bytes.SplitN(line, []byte(": "), 2)
-		if len(headerParts) == 2 {
-			key := string(headerParts[0])
-			value := string(headerParts[1])
-			headers.Add(key, value)
+	resp, err := DecodeCachedResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	if resp.BodyGzipped && !keepGzip {
+		if err := resp.decodeBody(); err != nil {
+			return nil, err
 		}
 	}
+	return resp, nil
+}
 
-	// Create response
-	resp := &CachedResponse{
-		StatusCode: statusCode,
-		Header:     headers,
-		Body:       parts[1],
+// EncodeCachedResponse encodes a response for storage in the cache. The
+// encoding is self-delimiting, so header values and bodies of any content
+// round-trip unchanged.
+func EncodeCachedResponse(resp *CachedResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(resp); err != nil {
+		return nil, fmt.Errorf("error encoding cached response: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeCachedResponse decodes a response encoded by EncodeCachedResponse
+func DecodeCachedResponse(data []byte) (*CachedResponse, error) {
+	resp := &CachedResponse{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(resp); err != nil {
+		return nil, fmt.Errorf("error decoding cached response: %w", err)
+	}
+
+	if resp.StatusCode < 100 || resp.StatusCode > 999 {
+		return nil, fmt.Errorf("invalid status code: %d", resp.StatusCode)
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
 	}
 
 	return resp, nil
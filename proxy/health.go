@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// healthStatus is the body of the health check responses
+type healthStatus struct {
+	Status string `json:"status"`
+	Uptime *int64 `json:"uptime,omitempty"` // In seconds, liveness only
+}
+
+// serveHealth answers liveness and readiness probes addressed to the proxy
+// itself, reporting whether the request was one
+func (p *ProxyHandler) serveHealth(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Host != "" {
+		return false
+	}
+
+	switch r.URL.Path {
+	case p.config.HealthPath:
+		uptime := int64(time.Since(p.startedAt) / time.Second)
+		writeHealth(w, http.StatusOK, healthStatus{Status: "ok", Uptime: &uptime})
+	case p.config.ReadyPath:
+		if p.workerPool.Accepting() {
+			writeHealth(w, http.StatusOK, healthStatus{Status: "ready"})
+		} else {
+			writeHealth(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable"})
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// writeHealth writes a health check response
+func writeHealth(w http.ResponseWriter, status int, health healthStatus) {
+	data, err := json.Marshal(health)
+	if err != nil {
+		logging.Errorf("Error encoding health status: %v", err)
+		http.Error(w, "Error encoding health status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// IdleMap is a concurrency-safe map of per-client state whose entries are
+// reclaimed once unused for longer than the idle timeout
+type IdleMap[V any] struct {
+	mutex       sync.Mutex
+	entries     map[string]*idleEntry[V]
+	idleTimeout time.Duration
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// idleEntry is a value along with the time it was last used
+type idleEntry[V any] struct {
+	value    V
+	lastUsed time.Time
+}
+
+// NewIdleMap creates an IdleMap sweeping idle entries every cleanupInterval
+func NewIdleMap[V any](idleTimeout, cleanupInterval time.Duration) *IdleMap[V] {
+	m := &IdleMap[V]{
+		entries:     make(map[string]*idleEntry[V]),
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Sweep()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+// Update runs fn on the value for key while holding the map's lock; new keys
+// start from the zero value with isNew set
+func (m *IdleMap[V]) Update(key string, fn func(value *V, isNew bool)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, exists := m.entries[key]
+	if !exists {
+		entry = &idleEntry[V]{}
+		m.entries[key] = entry
+	}
+	entry.lastUsed = time.Now()
+	fn(&entry.value, !exists)
+}
+
+// Sweep removes the entries that have been idle for longer than the timeout
+func (m *IdleMap[V]) Sweep() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, entry := range m.entries {
+		if time.Since(entry.lastUsed) > m.idleTimeout {
+			delete(m.entries, key)
+		}
+	}
+}
+
+// Len returns the number of entries
+func (m *IdleMap[V]) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.entries)
+}
+
+// Stop ends the periodic sweeping
+func (m *IdleMap[V]) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// forwardedClientIP returns the client IP a fronting proxy reported in the
+// left-most X-Forwarded-For entry or in X-Real-IP, nil if neither is valid
+func forwardedClientIP(r *http.Request) net.IP {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+			return ip
+		}
+	}
+	return net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+}
+
+// trustedClientIP returns the IP of the client behind the request: the
+// forwarded one when proxy headers are trusted for the sending peer, else the
+// peer's own. An empty trusted list trusts every peer.
+func trustedClientIP(r *http.Request, trustHeaders bool, trusted []*net.IPNet) net.IP {
+	peer := clientIP(r)
+	if trustHeaders && (len(trusted) == 0 || containsIP(trusted, peer)) {
+		if forwarded := forwardedClientIP(r); forwarded != nil {
+			return forwarded
+		}
+	}
+	return peer
+}
+
+// parseNetworks converts a list of IP addresses and CIDR ranges into networks
+// Single addresses become /32 (IPv4) or /128 (IPv6) networks; invalid entries are skipped
+func parseNetworks(entries []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return networks
+}
+
+// containsIP checks if the IP falls within any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
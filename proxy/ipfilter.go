@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// IPFilterOptions configures the IPFilter middleware
+type IPFilterOptions struct {
+	Allow             []string     // IPs/CIDRs of the clients that may use the proxy, empty allows all
+	Deny              []string     // IPs/CIDRs always rejected, even when allowed
+	TrustProxyHeaders bool         // Filter by the IP in X-Forwarded-For or X-Real-IP
+	TrustedProxies    []*net.IPNet // Peers whose proxy headers are trusted, empty trusts all
+}
+
+// IPFilter middleware rejects clients outside the allowed networks or inside
+// the denied ones with 403
+func IPFilter(opts IPFilterOptions) Middleware {
+	allow := parseNetworks(opts.Allow)
+	deny := parseNetworks(opts.Deny)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := trustedClientIP(r, opts.TrustProxyHeaders, opts.TrustedProxies)
+			if containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				logging.Infof("Rejecting request from client %s", ip)
+				http.Error(w, "Client not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsPath is where the Metrics middleware exposes the collected metrics
+const metricsPath = "/metrics"
+
+// PrometheusMetrics holds the collectors shared by the Metrics middleware and
+// the proxy handler, registered with a registry of their own
+type PrometheusMetrics struct {
+	registry *prometheus.Registry
+
+	requests    *prometheus.CounterVec
+	inFlight    prometheus.Gauge
+	duration    *prometheus.HistogramVec
+	cacheHits   prometheus.Counter
+	cacheMisses prometheus.Counter
+
+	serializationErrors   prometheus.Counter
+	deserializationErrors prometheus.Counter
+
+	queueRejections prometheus.Counter
+
+	activeTunnels    prometheus.Gauge
+	tunnelRejections prometheus.Counter
+}
+
+// NewPrometheusMetrics creates and registers the proxy's collectors
+func NewPrometheusMetrics() *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "proxy_requests_total",
+			Help: "Requests served, by status code and method.",
+		}, []string{"code", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "proxy_requests_in_flight",
+			Help: "Requests currently being served.",
+		}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "proxy_request_duration_seconds",
+			Help:    "Time taken to serve requests, by status code and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"code", "method"}),
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_cache_hits_total",
+			Help: "Cache lookups answered from the cache.",
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_cache_misses_total",
+			Help: "Cache lookups that had to go to the upstream.",
+		}),
+		serializationErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_cache_serialization_errors_total",
+			Help: "Responses that could not be encoded for storage in the cache.",
+		}),
+		deserializationErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_cache_deserialization_errors_total",
+			Help: "Cache entries that could not be decoded and were refetched.",
+		}),
+		queueRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_queue_rejections_total",
+			Help: "Requests turned away because the worker pool queue was full.",
+		}),
+		activeTunnels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "proxy_active_tunnels",
+			Help: "CONNECT and upgrade tunnels currently open.",
+		}),
+		tunnelRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "proxy_tunnel_rejections_total",
+			Help: "Tunnels turned away because a tunnel limit was reached.",
+		}),
+	}
+	m.registry.MustRegister(m.requests, m.inFlight, m.duration, m.cacheHits, m.cacheMisses,
+		m.serializationErrors, m.deserializationErrors, m.queueRejections, m.activeTunnels, m.tunnelRejections)
+	return m
+}
+
+// Handler serves the collected metrics in the Prometheus exposition format
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// recordCacheLookup counts a cache lookup; a nil receiver records nothing
+func (m *PrometheusMetrics) recordCacheLookup(hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.cacheHits.Inc()
+	} else {
+		m.cacheMisses.Inc()
+	}
+}
+
+// recordCodecError counts a response that could not be encoded for the cache,
+// or a cache entry that could not be decoded; a nil receiver records nothing
+func (m *PrometheusMetrics) recordCodecError(decoding bool) {
+	if m == nil {
+		return
+	}
+	if decoding {
+		m.deserializationErrors.Inc()
+	} else {
+		m.serializationErrors.Inc()
+	}
+}
+
+// recordQueueRejection counts a request turned away by a full queue; a nil
+// receiver records nothing
+func (m *PrometheusMetrics) recordQueueRejection() {
+	if m == nil {
+		return
+	}
+	m.queueRejections.Inc()
+}
+
+// recordTunnel tracks a tunnel being opened (+1) or closed (-1); a nil
+// receiver records nothing
+func (m *PrometheusMetrics) recordTunnel(delta float64) {
+	if m == nil {
+		return
+	}
+	m.activeTunnels.Add(delta)
+}
+
+// recordTunnelRejection counts a tunnel turned away by a limit; a nil receiver
+// records nothing
+func (m *PrometheusMetrics) recordTunnelRejection() {
+	if m == nil {
+		return
+	}
+	m.tunnelRejections.Inc()
+}
+
+// Metrics middleware records request metrics and serves them at /metrics
+func Metrics(m *PrometheusMetrics) Middleware {
+	return metrics(m, true)
+}
+
+// RecordMetrics middleware records request metrics without serving them, for
+// when they are served on the admin listener
+func RecordMetrics(m *PrometheusMetrics) Middleware {
+	return metrics(m, false)
+}
+
+// metrics builds the metrics middleware, serving the collected metrics at
+// /metrics if serve is set
+func metrics(m *PrometheusMetrics, serve bool) Middleware {
+	exposition := m.Handler()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if serve && r.URL.Host == "" && r.URL.Path == metricsPath {
+				exposition.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			// Create a response writer wrapper to capture status code
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(rw, r)
+
+			labels := prometheus.Labels{"code": strconv.Itoa(rw.statusCode), "method": r.Method}
+			m.requests.With(labels).Inc()
+			m.duration.With(labels).Observe(time.Since(start).Seconds())
+		})
+	}
+}
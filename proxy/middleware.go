@@ -1,17 +1,21 @@
 package proxy
 
 import (
-	"compress/gzip"
+	"bufio"
 	"context"
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"io"
-	"log"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
 )
 
 // Middleware is a function that wraps an http.Handler
@@ -42,8 +46,26 @@ func Logger() Middleware {
 			
 			// Log the request details
 			duration := time.Since(start)
-			log.Printf(
-				"%s %s %s %d %s %s",
+			requestID := RequestIDFromContext(r.Context())
+			if logging.CurrentFormat() == logging.FormatJSON {
+				logging.Info("request", logging.Fields{
+					"remote_addr": r.RemoteAddr,
+					"method":      r.Method,
+					"path":        r.URL.Path,
+					"status":      rw.statusCode,
+					"duration_ms": float64(duration.Microseconds()) / 1000,
+					"bytes":       rw.bytesWritten,
+					"user_agent":  r.UserAgent(),
+					"request_id":  requestID,
+				})
+				return
+			}
+			if requestID == "" {
+				requestID = "-"
+			}
+			logging.Infof(
+				"%s %s %s %s %d %s %s",
+				requestID,
 				r.RemoteAddr,
 				r.Method,
 				r.URL.Path,
@@ -76,91 +98,229 @@ func CORS() Middleware {
 	}
 }
 
-// Compress middleware compresses responses using gzip
-func Compress() Middleware {
+// CompressOptions controls when the Compress middleware skips compression
+type CompressOptions struct {
+	// BypassHeader skips compression when the request carries this header,
+	// e.g. one set by a fronting proxy that compresses on its own
+	BypassHeader string
+
+	// TrustedPeers lists networks whose requests are never compressed
+	TrustedPeers []*net.IPNet
+
+	// MinSize is the smallest body worth compressing; smaller ones are sent
+	// uncompressed with their headers intact. 0 compresses every body.
+	MinSize int
+}
+
+// Compress middleware compresses responses with the encoding the client
+// prefers, brotli or gzip
+func Compress(opts CompressOptions) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Check if the client accepts gzip encoding
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			// Check which encoding the client accepts, if any
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" {
 				next.ServeHTTP(w, r)
 				return
 			}
 			
-			// Create a gzip writer
-			gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
-			if err != nil {
+			// Upgraded connections carry their own protocol
+			if r.Header.Get("Upgrade") != "" {
 				next.ServeHTTP(w, r)
 				return
 			}
-			defer gz.Close()
 			
-			// Set the Content-Encoding header
-			w.Header().Set("Content-Encoding", "gzip")
-			w.Header().Del("Content-Length")
+			// Leave compression to the peer when it asked us to
+			if opts.BypassHeader != "" && r.Header.Get(opts.BypassHeader) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if containsIP(opts.TrustedPeers, clientIP(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			
-			// Create a gzip response writer
-			gzw := &gzipResponseWriter{
+			// Whether to compress depends on the response headers, which the
+			// wrapper inspects once the handler writes its status
+			cw := &compressionResponseWriter{
 				ResponseWriter: w,
-				Writer:         gz,
+				encoder:        newEncoder(encoding, w),
+				encoding:       encoding,
+				head:           r.Method == http.MethodHead,
+				minSize:        opts.MinSize,
 			}
+			defer cw.Close()
 			
-			// Call the next handler with the gzip writer
-			next.ServeHTTP(gzw, r)
+			// Call the next handler with the compressing writer
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// Rate limit modes
+const (
+	RateLimitReject = "reject" // Reject requests over the limit right away
+	RateLimitDelay  = "delay"  // Hold requests over the limit until a token frees up
+)
+
+// RateLimitOptions configures the RateLimit middleware
+type RateLimitOptions struct {
+	// RequestsPerMinute is the sustained rate per client, also the burst size
+	RequestsPerMinute int
+
+	// Mode is RateLimitReject or RateLimitDelay
+	Mode string
+
+	// MaxDelay is the longest a request is held in delay mode before being rejected
+	MaxDelay time.Duration
+
+	// IdleTimeout is how long an idle client's bucket is kept, a minute by default;
+	// shorter timeouts let clients regain a full burst early
+	IdleTimeout time.Duration
+
+	// CleanupInterval is how often idle clients are swept, a minute by default
+	CleanupInterval time.Duration
+
+	// TrustProxyHeaders identifies clients by X-Forwarded-For or X-Real-IP
+	// instead of the peer address, for peers within TrustedProxies (all
+	// peers when empty); without it everyone behind a load balancer shares
+	// one bucket
+	TrustProxyHeaders bool
+	TrustedProxies    []*net.IPNet
+
+	// Settings, when set, takes precedence over RequestsPerMinute, Mode and
+	// MaxDelay so that reloading the configuration changes the limit
+	Settings *config.Holder
+
+	// Context stops the sweeping of idle clients once done; without one the
+	// sweeper runs for the life of the process
+	Context context.Context
+}
+
+// limits returns the rate limit in effect for the next request
+func (opts *RateLimitOptions) limits() (int, string, time.Duration) {
+	if opts.Settings == nil {
+		return opts.RequestsPerMinute, opts.Mode, opts.MaxDelay
+	}
+	cfg := opts.Settings.Load()
+	return requestsPerMinute(cfg), cfg.RateLimitMode, time.Duration(cfg.RateLimitMaxDelay) * time.Millisecond
+}
+
+// requestsPerMinute derives the per client rate limit from the configuration
+func requestsPerMinute(cfg *config.Config) int {
+	// This is a simplistic approach - adjust as needed
+	return cfg.MaxConnections * 60
+}
+
+// BufferResponses middleware buffers response bodies so that many small writes
+// reach the connection as fewer, larger ones
+func BufferResponses(size int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferedResponseWriter{ResponseWriter: w}
+			bw.buf = bufio.NewWriterSize(w, size)
+			defer bw.buf.Flush()
+			
+			next.ServeHTTP(bw, r)
 		})
 	}
 }
 
 // RateLimit middleware limits the number of requests from a single IP address (for production)
-func RateLimit(requestsPerMinute int) Middleware {
+func RateLimit(opts RateLimitOptions) Middleware {
+	// Each client gets a token bucket refilled at the configured rate
 	type client struct {
-		count      int
+		tokens     float64
 		lastAccess time.Time
 	}
 	
-	var (
-		clients = make(map[string]*client)
-		mu      sync.Mutex
-	)
-	
-	// Start a goroutine to clean up expired clients
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastAccess) > time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
-		}
-	}()
+	idleTimeout, cleanupInterval := opts.IdleTimeout, opts.CleanupInterval
+	if idleTimeout <= 0 {
+		idleTimeout = time.Minute
+	}
+	if cleanupInterval <= 0 {
+		cleanupInterval = time.Minute
+	}
+	clients := NewIdleMap[client](idleTimeout, cleanupInterval)
+	if opts.Context != nil {
+		context.AfterFunc(opts.Context, clients.Stop)
+	}
 	
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get the client IP address
+			// Get the client IP address, keeping unparsable peers apart by address
 			ip := r.RemoteAddr
-			if idx := strings.LastIndex(ip, ":"); idx != -1 {
-				ip = ip[:idx]
+			if addr := trustedClientIP(r, opts.TrustProxyHeaders, opts.TrustedProxies); addr != nil {
+				ip = addr.String()
 			}
 			
-			// Check if the client has exceeded the rate limit
-			mu.Lock()
-			c, exists := clients[ip]
-			if !exists {
-				c = &client{count: 0, lastAccess: time.Now()}
-				clients[ip] = c
+			limit, mode, maxDelay := opts.limits()
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
 			}
+			var (
+				burst = float64(limit)
+				rate  = float64(limit) / 60 // Tokens per second
+			)
+			
+			var (
+				wait      time.Duration
+				admitted  bool
+				remaining int
+				reset     time.Time
+			)
+			clients.Update(ip, func(c *client, isNew bool) {
+				// Refill the client's bucket for the time since its last request
+				now := time.Now()
+				if isNew {
+					c.tokens = burst
+				} else {
+					c.tokens = min(burst, c.tokens+now.Sub(c.lastAccess).Seconds()*rate)
+				}
+				c.lastAccess = now
+				
+				// Time until a token is available; in delay mode the token is taken
+				// up front so that waiting requests are admitted in arrival order
+				if c.tokens < 1 {
+					wait = time.Duration((1 - c.tokens) / rate * float64(time.Second))
+				}
+				if wait == 0 || (mode == RateLimitDelay && wait <= maxDelay) {
+					c.tokens--
+					admitted = true
+				}
+				
+				// The bucket is full again once the missing tokens are refilled
+				remaining = max(int(c.tokens), 0)
+				reset = now.Add(time.Duration((burst - c.tokens) / rate * float64(time.Second)))
+			})
 			
-			c.count++
-			c.lastAccess = time.Now()
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
 			
-			if c.count > requestsPerMinute {
-				mu.Unlock()
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			if !admitted {
+				retryAfter := int(wait.Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeRateLimitError(w, rateLimitError{
+					Error:      "rate limit exceeded",
+					Limit:      limit,
+					Window:     "1m",
+					RetryAfter: retryAfter,
+					Reset:      reset.Unix(),
+				})
 				return
 			}
-			mu.Unlock()
+			
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					return
+				}
+			}
 			
 			// Call the next handler
 			next.ServeHTTP(w, r)
@@ -168,54 +328,401 @@ func RateLimit(requestsPerMinute int) Middleware {
 	}
 }
 
+// rateLimitError is the body of responses rejected by RateLimit
+type rateLimitError struct {
+	Error      string `json:"error"`
+	Limit      int    `json:"limit"`       // Requests allowed per window
+	Window     string `json:"window"`      // Window the limit applies to
+	RetryAfter int    `json:"retry_after"` // Seconds until the next request is admitted
+	Reset      int64  `json:"reset"`       // Unix time the client's full allowance is back
+}
+
+// writeRateLimitError answers a rejected request with a 429 describing the limit
+func writeRateLimitError(w http.ResponseWriter, body rateLimitError) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(data)
+}
 
-// responseWriter is a wrapper for http.ResponseWriter that captures the status code
+// responseWriter is a wrapper for http.ResponseWriter that captures the status
+// code and counts the body bytes written
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
+	wroteHeader  bool
+}
+
+// Write counts the bytes and calls the underlying ResponseWriter's Write
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(data)
+	rw.bytesWritten += int64(n)
+	return n, err
 }
 
 // WriteHeader captures the status code and calls the underlying ResponseWriter's WriteHeader
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
+	rw.wroteHeader = true
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// gzipResponseWriter is a wrapper for http.ResponseWriter that writes to a gzip writer
-type gzipResponseWriter struct {
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// compressionResponseWriter is a wrapper for http.ResponseWriter that
+// compresses the body of compressible responses with the given encoder
+type compressionResponseWriter struct {
+	http.ResponseWriter
+	encoder     io.WriteCloser // Compresses into the ResponseWriter
+	encoding    string         // Content-Encoding token of the encoder
+	active      bool           // Set once the response is being compressed
+	head        bool           // HEAD responses have no body to compress
+	minSize     int            // Bodies smaller than this are sent as they are
+	wroteHeader bool
+
+	// A compressible response is held back until its body reaches minSize
+	pending bool
+	status  int
+	buf     []byte
+}
+
+// compressibleTypes are the media types worth compressing, besides text/*
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"image/svg+xml":            true,
+}
+
+// isCompressible checks if a response with the given status and headers
+// benefits from compression; encoded bodies and binary formats are left alone
+func isCompressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := strings.Cut(header.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || compressibleTypes[mediaType]
+}
+
+// WriteHeader decides whether to compress from the final response headers,
+// deferring the decision while the body size is still unknown
+func (cw *compressionResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader || code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	if cw.head || !isCompressible(code, header) {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// A declared length settles the question right away
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		if length < cw.minSize {
+			cw.ResponseWriter.WriteHeader(code)
+		} else {
+			cw.startEncoding(code)
+		}
+		return
+	}
+	if cw.minSize <= 0 {
+		cw.startEncoding(code)
+		return
+	}
+	cw.pending = true
+	cw.status = code
+}
+
+// startEncoding sends the headers of a compressed response and compresses
+// whatever body was held back so far
+func (cw *compressionResponseWriter) startEncoding(code int) error {
+	header := cw.Header()
+	header.Set("Content-Encoding", cw.encoding)
+	header.Del("Content-Length")
+	header.Add("Vary", "Accept-Encoding")
+	cw.active = true
+	cw.ResponseWriter.WriteHeader(code)
+
+	cw.pending = false
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.encoder.Write(buf)
+	return err
+}
+
+// Write writes the data, compressed if the response is compressible
+func (cw *compressionResponseWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		// Sniff the type like net/http would, it decides about compression
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) < cw.minSize {
+			return len(data), nil
+		}
+		if err := cw.startEncoding(cw.status); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if cw.active {
+		return cw.encoder.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+// Close sends a held back body that stayed below the minimum size as it is,
+// or finishes the compressed stream
+func (cw *compressionResponseWriter) Close() error {
+	if cw.pending {
+		cw.pending = false
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+	if !cw.active {
+		return nil
+	}
+	return cw.encoder.Close()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (cw *compressionResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Flush flushes the compressed stream and the underlying ResponseWriter; a
+// streaming handler doesn't wait for the minimum size to be reached
+func (cw *compressionResponseWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		cw.startEncoding(cw.status)
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok && cw.active {
+		flusher.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// bufferedResponseWriter is a wrapper for http.ResponseWriter that buffers the body
+type bufferedResponseWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	buf *bufio.Writer
 }
 
-// Write writes the data to the gzip writer
-func (gzw *gzipResponseWriter) Write(data []byte) (int, error) {
-	return gzw.Writer.Write(data)
+// Write writes the data to the buffer
+func (bw *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return bw.buf.Write(data)
 }
 
-// CreateMiddlewareChain creates a chain of middleware based on the configuration
+// Flush sends buffered data on to the client
+func (bw *bufferedResponseWriter) Flush() {
+	bw.buf.Flush()
+	http.NewResponseController(bw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (bw *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// CreateMiddlewareChain creates a chain of middleware based on the
+// configuration: the middleware named in cfg.Middleware, outermost first, or
+// config.DefaultMiddleware when the list is empty. Middleware whose settings
+// disable it is left out wherever it is listed.
 func CreateMiddlewareChain(handler http.Handler, cfg *config.Config) http.Handler {
-	middlewares := []Middleware{
-		Logger(), // Always include logger middleware
+	names := cfg.Middleware
+	if len(names) == 0 {
+		names = config.DefaultMiddleware
 	}
 	
-	// Add compression middleware
-	middlewares = append(middlewares, Compress())
-	
-	// Add CORS middleware
-	middlewares = append(middlewares, CORS())
-	
-	// Add rate limiting middleware if max connections is configured
-	if cfg.MaxConnections > 0 {
-		// Calculate requests per minute based on MaxConnections
-		// This is a simplistic approach - adjust as needed
-		requestsPerMinute := cfg.MaxConnections * 60
-		middlewares = append(middlewares, RateLimit(requestsPerMinute))
+	var middlewares []Middleware
+	for _, name := range names {
+		if middleware := newMiddleware(name, handler, cfg); middleware != nil {
+			middlewares = append(middlewares, middleware)
+		}
 	}
 	
 	// Apply all middlewares to the handler
 	return Chain(handler, middlewares...)
 }
 
+// newMiddleware creates the named middleware, nil if it is disabled or unknown
+func newMiddleware(name string, handler http.Handler, cfg *config.Config) Middleware {
+	proxyHandler, _ := handler.(*ProxyHandler)
+	
+	switch name {
+	case "recover":
+		return Recover()
+		
+	case "request_id":
+		// Ahead of the logger so that it can log the ID
+		return RequestID()
+		
+	case "logger":
+		return Logger()
+		
+	case "request_timer":
+		return RequestTimer()
+		
+	case "ip_filter":
+		// Turn away clients by IP before anything else happens
+		if len(cfg.AllowedClientIPs) == 0 && len(cfg.BlockedClientIPs) == 0 {
+			return nil
+		}
+		return IPFilter(IPFilterOptions{
+			Allow:             cfg.AllowedClientIPs,
+			Deny:              cfg.BlockedClientIPs,
+			TrustProxyHeaders: cfg.TrustProxyHeaders,
+			TrustedProxies:    parseNetworks(cfg.TrustedProxies),
+		})
+		
+	case "auth":
+		// Turn away unauthenticated clients before proxying
+		if len(cfg.AuthUsers) == 0 {
+			return nil
+		}
+		var settings *config.Holder
+		if proxyHandler != nil {
+			settings = proxyHandler.Settings()
+		}
+		return Auth(AuthOptions{
+			Users:       cfg.AuthUsers,
+			Realm:       cfg.AuthRealm,
+			ExemptPaths: []string{"/admin/", pprofPath, cfg.HealthPath, cfg.ReadyPath},
+			Settings:    settings,
+		})
+		
+	case "metrics":
+		// Record request metrics; the proxy handler adds its cache lookups
+		if !cfg.MetricsEnabled {
+			return nil
+		}
+		metrics := NewPrometheusMetrics()
+		if proxyHandler != nil {
+			proxyHandler.SetMetrics(metrics)
+		}
+		if cfg.AdminPort > 0 {
+			return RecordMetrics(metrics)
+		}
+		return Metrics(metrics)
+		
+	case "buffer":
+		// Coalesce small body writes, including compressed output, into larger ones
+		if cfg.WriteBufferSize <= 0 {
+			return nil
+		}
+		return BufferResponses(cfg.WriteBufferSize)
+		
+	case "compress":
+		return Compress(CompressOptions{
+			BypassHeader: cfg.CompressBypassHeader,
+			TrustedPeers: parseNetworks(cfg.CompressTrustedPeers),
+			MinSize:      cfg.GzipMinSize,
+		})
+		
+	case "cors":
+		return CORS()
+		
+	case "security_headers":
+		return SecurityHeaders()
+		
+	case "rate_limit":
+		// Rate limit if max connections is configured; the proxy handler's
+		// settings let reloads adjust the limit
+		if cfg.MaxConnections <= 0 {
+			return nil
+		}
+		var (
+			settings *config.Holder
+			ctx      context.Context
+		)
+		if proxyHandler != nil {
+			settings, ctx = proxyHandler.Settings(), proxyHandler.Context()
+		}
+		return RateLimit(RateLimitOptions{
+			RequestsPerMinute: requestsPerMinute(cfg),
+			Mode:              cfg.RateLimitMode,
+			MaxDelay:          time.Duration(cfg.RateLimitMaxDelay) * time.Millisecond,
+			IdleTimeout:       time.Duration(cfg.ClientIdleTimeout) * time.Second,
+			CleanupInterval:   time.Duration(cfg.ClientCleanupInterval) * time.Second,
+			TrustProxyHeaders: cfg.TrustProxyHeaders,
+			TrustedProxies:    parseNetworks(cfg.TrustedProxies),
+			Settings:          settings,
+			Context:           ctx,
+		})
+		
+	case "decompress_requests":
+		if !cfg.DecompressRequests {
+			return nil
+		}
+		return DecompressRequests(cfg.MaxDecompressedBytes)
+		
+	case "timeout":
+		// Best innermost, so only the time spent on the request counts
+		if cfg.RequestTimeout <= 0 {
+			return nil
+		}
+		return Timeout(time.Duration(cfg.RequestTimeout) * time.Second)
+	}
+	
+	return nil
+}
+
+// Recover middleware answers requests whose handler panicked with a 500
+// instead of dropping the connection, logging the panic and its stack
+func Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// Aborting a response on purpose is not an error
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				logging.Errorf("Panic serving %s %s: %v\n%s", r.Method, r.URL.String(), p, debug.Stack())
+				if !rw.wroteHeader {
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+			}()
+			
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
 // SecurityHeaders adds security-related headers to responses
 func SecurityHeaders() Middleware {
 	return func(next http.Handler) http.Handler {
@@ -232,24 +739,28 @@ func SecurityHeaders() Middleware {
 	}
 }
 
-// RequestID adds a unique ID to each request for tracing
+// requestIDContextKey is the context key RequestID stores the ID under
+const requestIDContextKey contextKey = "requestID"
+
+// maxRequestIDLength bounds incoming request IDs that are reused
+const maxRequestIDLength = 128
+
+// RequestID adds a unique ID to each request for tracing, reusing a valid
+// X-Request-ID set by an upstream proxy
 func RequestID() Middleware {
-	var requestID int64 = 0
-	var mu sync.Mutex
-	
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Generate a unique request ID
-			mu.Lock()
-			requestID++
-			id := requestID
-			mu.Unlock()
+			id := r.Header.Get("X-Request-ID")
+			if !isValidRequestID(id) {
+				id = newRequestID()
+				r.Header.Set("X-Request-ID", id)
+			}
 			
 			// Add the request ID as a header
-			w.Header().Set("X-Request-ID", fmt.Sprintf("%d", id))
+			w.Header().Set("X-Request-ID", id)
 			
 			// Store the request ID in the context
-			ctx := context.WithValue(r.Context(), "requestID", id)
+			ctx := context.WithValue(r.Context(), requestIDContextKey, id)
 			r = r.WithContext(ctx)
 			
 			// Call the next handler
@@ -258,6 +769,34 @@ func RequestID() Middleware {
 	}
 }
 
+// RequestIDFromContext returns the ID RequestID assigned to the request, or
+// an empty string if it didn't run
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// newRequestID generates a random 128-bit request ID in hex
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// isValidRequestID checks if an incoming ID is safe to reuse in headers and
+// log lines: non-empty, bounded, and printable ASCII without spaces
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
 // RequestTimer measures and logs the time taken to process a request
 func RequestTimer() Middleware {
 	return func(next http.Handler) http.Handler {
@@ -269,7 +808,7 @@ func RequestTimer() Middleware {
 			
 			// Calculate and log the duration
 			duration := time.Since(start)
-			log.Printf("Request %s %s took %s", r.Method, r.URL.Path, duration)
+			logging.Infof("Request %s %s took %s", r.Method, r.URL.Path, duration)
 		})
 	}
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// negativeCacheTTL returns how long an upstream failure may be cached, if a
+// configured negative cache rule matches it or it reports a missing resource
+func (p *ProxyHandler) negativeCacheTTL(host string, resp *http.Response) (time.Duration, bool) {
+	// Failures are subject to the same opt-outs as successful responses
+	if strings.Contains(resp.Header.Get("Cache-Control"), "no-store") || resp.Header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	if override := p.domainOverride(resp); override != nil && override.NoCache {
+		return 0, false
+	}
+
+	for _, rule := range p.config.NegativeCache {
+		if rule.Matches(host, resp.StatusCode) {
+			return time.Duration(rule.TTL) * time.Second, true
+		}
+	}
+
+	// A missing resource tends to stay missing, whatever the host
+	if ttl := p.config.NegativeCacheTTL; ttl > 0 {
+		switch resp.StatusCode {
+		case http.StatusNotFound, http.StatusGone:
+			return time.Duration(ttl) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// hitStatus returns the X-Cache value for a cached response, telling cached
+// failures apart from good responses
+func hitStatus(resp *CachedResponse) string {
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "HIT-NEGATIVE"
+	}
+	return "HIT"
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// domainOverride returns the first configured override for the upstream a
+// response came from, or nil if none applies
+func (p *ProxyHandler) domainOverride(resp *http.Response) *config.DomainOverride {
+	if len(p.config.DomainOverrides) == 0 || resp.Request == nil {
+		return nil
+	}
+	host := resp.Request.URL.Hostname()
+	for i := range p.config.DomainOverrides {
+		if p.config.DomainOverrides[i].Matches(host) {
+			return &p.config.DomainOverrides[i]
+		}
+	}
+	return nil
+}
+
+// defaultTTL returns the TTL of a response that doesn't specify its freshness
+func (p *ProxyHandler) defaultTTL(resp *http.Response) time.Duration {
+	if override := p.domainOverride(resp); override != nil && override.TTL > 0 {
+		return time.Duration(override.TTL) * time.Second
+	}
+	return time.Duration(p.settings.Load().CacheTTL) * time.Second
+}
+
+// maxCacheableBytes returns the largest body of the response that is cached, 0 if unlimited
+func (p *ProxyHandler) maxCacheableBytes(resp *http.Response) int64 {
+	if override := p.domainOverride(resp); override != nil && override.MaxBodyBytes > 0 {
+		return override.MaxBodyBytes
+	}
+	return p.config.MaxCacheableBytes
+}
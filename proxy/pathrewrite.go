@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// pathRewrite is a path rewrite rule with its expression compiled
+type pathRewrite struct {
+	config.PathRewriteRule
+	match *regexp.Regexp // nil when the rule has no expression
+}
+
+// compilePathRewrites compiles the rules' expressions; invalid rules are
+// skipped as Validate reports them
+func compilePathRewrites(rules []config.PathRewriteRule) []pathRewrite {
+	var rewrites []pathRewrite
+	for _, rule := range rules {
+		rewrite := pathRewrite{PathRewriteRule: rule}
+		if rule.Match != "" {
+			match, err := regexp.Compile(rule.Match)
+			if err != nil {
+				continue
+			}
+			rewrite.match = match
+		}
+		rewrites = append(rewrites, rewrite)
+	}
+	return rewrites
+}
+
+// apply returns the rewritten path and whether the rule applies to it
+func (rw pathRewrite) apply(path string) (string, bool) {
+	if prefix := strings.TrimSuffix(rw.StripPrefix, "/"); prefix != "" {
+		rest, found := strings.CutPrefix(path, prefix)
+		if !found || (rest != "" && rest[0] != '/') {
+			return path, false
+		}
+		path = rest
+	}
+	if rw.match != nil {
+		if !rw.match.MatchString(path) {
+			return path, false
+		}
+		path = rw.match.ReplaceAllString(path, rw.Replace)
+	}
+	path = strings.TrimSuffix(rw.AddPrefix, "/") + path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path, true
+}
+
+// rewritePath applies the first path rewrite matching the request. It runs
+// before the cache lookup so that entries are keyed by the path actually fetched.
+func (p *ProxyHandler) rewritePath(r *http.Request) {
+	host := r.URL.Hostname()
+	for _, rw := range p.pathRewrites {
+		if rw.Domain != "" && !config.MatchDomain(rw.Domain, host, false) {
+			continue
+		}
+		if path, ok := rw.apply(r.URL.Path); ok {
+			logging.Debugf("Rewrote path %s to %s for %s", r.URL.Path, path, host)
+			r.URL.Path = path
+			r.URL.RawPath = ""
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxHashedBodyBytes bounds the POST bodies buffered for the cache key;
+// larger requests are forwarded as they are and never cached
+const maxHashedBodyBytes = 1 << 20
+
+// bufferRequestBody reads the request body into memory so it can be hashed
+// into the cache key and still be forwarded in full. Bodies over the limit
+// are left unbuffered, which keeps the request out of the cache.
+func bufferRequestBody(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		r.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHashedBodyBytes+1))
+	if err != nil {
+		return fmt.Errorf("error reading request body: %w", err)
+	}
+	if len(body) > maxHashedBodyBytes {
+		// Put back what was read in front of the rest of the body
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil
+	}
+
+	r.Body.Close()
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return nil
+}
+
+// requestBodyHash returns the hex SHA-256 of a buffered request body
+func requestBodyHash(r *http.Request) string {
+	h := sha256.New()
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			io.Copy(h, body)
+			body.Close()
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// pprofPath is where the runtime profiles are served when enabled
+const pprofPath = "/debug/pprof/"
+
+// isPprofRequest checks if the request is addressed to the proxy's runtime profiles
+func isPprofRequest(r *http.Request) bool {
+	return r.URL.Host == "" && (r.URL.Path == strings.TrimSuffix(pprofPath, "/") || strings.HasPrefix(r.URL.Path, pprofPath))
+}
+
+// pprofHandler builds the mux serving the runtime profiles, restricted to the
+// clients allowed on the admin endpoints
+func (p *ProxyHandler) pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPath, pprof.Index)
+	mux.HandleFunc(pprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPath+"trace", pprof.Trace)
+	return p.requireAdmin(mux)
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Reasons reported in the X-Proxy-Error header
+const (
+	reasonInvalidTarget     = "invalid_target"
+	reasonUpstreamTimeout   = "upstream_timeout"
+	reasonDNSFailure        = "dns_failure"
+	reasonConnectionRefused = "connection_refused"
+	reasonConnectionFailed  = "connection_failed"
+	reasonUpstreamError     = "upstream_error"
+)
+
+// writeProxyError answers with an error the proxy itself produced, naming
+// the reason in a machine-readable header so monitoring can tell them apart
+func writeProxyError(w http.ResponseWriter, status int, reason, message string) {
+	w.Header().Set("X-Proxy-Error", reason)
+	http.Error(w, message, status)
+}
+
+// classifyUpstreamError determines the status and reason for a failed
+// upstream request: 504 when the upstream was too slow, 502 otherwise
+func classifyUpstreamError(err error) (int, string) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout, reasonUpstreamTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return http.StatusBadGateway, reasonDNSFailure
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return http.StatusBadGateway, reasonConnectionRefused
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return http.StatusBadGateway, reasonConnectionFailed
+	}
+	return http.StatusBadGateway, reasonUpstreamError
+}
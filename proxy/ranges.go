@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+// errUnsatisfiableRange is returned for ranges lying entirely past the body
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// byteRange is an inclusive range of body offsets
+type byteRange struct {
+	start, end int
+}
+
+// parseRange parses a Range header asking for a single byte range of a body
+// of the given size. Multiple ranges and other units are reported as errors
+// too, those requests are answered with the whole body.
+func parseRange(header string, size int) (byteRange, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, fmt.Errorf("unsupported range: %q", header)
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, fmt.Errorf("invalid range: %q", header)
+	}
+
+	// A suffix range asks for the last bytes of the body
+	if first == "" {
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 0 {
+			return byteRange{}, fmt.Errorf("invalid range: %q", header)
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, errUnsatisfiableRange
+		}
+		return byteRange{start: max(size-n, 0), end: size - 1}, nil
+	}
+
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 {
+		return byteRange{}, fmt.Errorf("invalid range: %q", header)
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.Atoi(last); err != nil || end < start {
+			return byteRange{}, fmt.Errorf("invalid range: %q", header)
+		}
+	}
+	if start >= size {
+		return byteRange{}, errUnsatisfiableRange
+	}
+	return byteRange{start: start, end: min(end, size-1)}, nil
+}
+
+// ifRangeMatches checks if the If-Range condition of the request, if any,
+// holds for the cached response; only strong ETags and exact dates match
+func (c *CachedResponse) ifRangeMatches(r *http.Request) bool {
+	condition := r.Header.Get("If-Range")
+	if condition == "" {
+		return true
+	}
+	if strings.HasPrefix(condition, `"`) {
+		return c.ETag == condition
+	}
+	return c.LastModified != "" && c.LastModified == condition
+}
+
+// writeCachedRange serves the part of a cached response the request's Range
+// header asks for, and the whole response when there is no usable range
+func (p *ProxyHandler) writeCachedRange(w http.ResponseWriter, r *http.Request, item *cache.CacheItem, cachedResp *CachedResponse, status string) {
+	header := r.Header.Get("Range")
+	if header == "" || cachedResp.StatusCode != http.StatusOK || !cachedResp.ifRangeMatches(r) {
+		p.writeCachedResponse(w, item, cachedResp, status)
+		return
+	}
+
+	size := len(cachedResp.Body)
+	rng, err := parseRange(header, size)
+	if errors.Is(err, errUnsatisfiableRange) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.Header().Set("X-Cache", status)
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil {
+		p.writeCachedResponse(w, item, cachedResp, status)
+		return
+	}
+
+	partial := *cachedResp
+	partial.StatusCode = http.StatusPartialContent
+	partial.Header = cachedResp.Header.Clone()
+	partial.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.end, size))
+	partial.Header.Set("Content-Length", strconv.Itoa(rng.end-rng.start+1))
+	partial.Body = cachedResp.Body[rng.start : rng.end+1]
+	p.writeCachedResponse(w, item, &partial, status)
+}
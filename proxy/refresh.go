@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// RefreshLimiter bounds the number of background cache refreshes running at
+// once. Refreshes beyond the limit are dropped rather than queued; the stale
+// entry keeps being served until a later hit manages to refresh it.
+type RefreshLimiter struct {
+	slots   chan struct{}
+	dropped int64
+
+	mutex   sync.Mutex // Orders starting refreshes against Stop
+	stopped bool
+	running sync.WaitGroup
+}
+
+// NewRefreshLimiter creates a limiter allowing up to limit concurrent refreshes
+func NewRefreshLimiter(limit int) *RefreshLimiter {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &RefreshLimiter{
+		slots: make(chan struct{}, limit),
+	}
+}
+
+// Go runs the refresh in a new goroutine if a slot is free and reports whether
+// it was started; otherwise the attempt is counted as dropped. Nothing is
+// started once the limiter is stopped.
+func (l *RefreshLimiter) Go(refresh func()) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.stopped {
+		return false
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+		return false
+	}
+
+	l.running.Add(1)
+	go func() {
+		defer l.running.Done()
+		defer func() { <-l.slots }()
+		refresh()
+	}()
+	return true
+}
+
+// Stop turns away new refreshes and waits for the running ones to finish
+// writing to the cache, or until ctx is done
+func (l *RefreshLimiter) Stop(ctx context.Context) error {
+	l.mutex.Lock()
+	l.stopped = true
+	l.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Active returns the number of refreshes currently running
+func (l *RefreshLimiter) Active() int {
+	return len(l.slots)
+}
+
+// Dropped returns the number of refresh attempts dropped at the limit
+func (l *RefreshLimiter) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
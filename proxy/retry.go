@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// isRetryable checks if a failed attempt is worth repeating: timeouts and
+// gateway errors tend to be transient
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryBackoff returns the delay before the given retry, doubling with every
+// attempt and jittered so that clients don't retry in lockstep
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base << attempt
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// cancelOnClose releases the context of the attempt a response body belongs
+// to once the body has been closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// releaseOnClose ties the cancel func to the response body, or calls it right
+// away if there is no response to read
+func releaseOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil {
+		cancel()
+		return nil
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+// doWithRetry sends the request upstream, retrying GET and HEAD requests on
+// transient failures with exponential backoff. The proxy timeout bounds all
+// attempts together, and retries stop once the next attempt would start past it.
+func (p *ProxyHandler) doWithRetry(proxyReq *http.Request) (*http.Response, error) {
+	maxRetries := p.config.MaxRetries
+	if proxyReq.Method != http.MethodGet && proxyReq.Method != http.MethodHead {
+		maxRetries = 0
+	}
+	if maxRetries == 0 {
+		return p.client.Do(proxyReq)
+	}
+
+	// Every attempt needs the body from the start
+	if proxyReq.Body != nil && proxyReq.Body != http.NoBody && proxyReq.GetBody == nil {
+		body, err := io.ReadAll(proxyReq.Body)
+		if err != nil {
+			return nil, err
+		}
+		proxyReq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		proxyReq.Body, _ = proxyReq.GetBody()
+	}
+
+	// The client timeout applies to every attempt on its own, the deadline
+	// keeps their total within the proxy timeout as well
+	deadline := time.Now().Add(time.Duration(p.config.ProxyTimeout) * time.Second)
+	ctx, cancel := context.WithDeadline(proxyReq.Context(), deadline)
+	proxyReq = proxyReq.WithContext(ctx)
+
+	base := time.Duration(p.config.RetryBackoff) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		resp, err := p.client.Do(proxyReq)
+		if attempt >= maxRetries || !isRetryable(resp, err) {
+			return releaseOnClose(resp, cancel), err
+		}
+
+		backoff := retryBackoff(base, attempt)
+		if time.Now().Add(backoff).After(deadline) {
+			return releaseOnClose(resp, cancel), err
+		}
+
+		if err != nil {
+			logging.Warnf("Retrying %s after error: %v (attempt %d of %d)", proxyReq.URL.String(), err, attempt+1, maxRetries)
+		} else {
+			logging.Warnf("Retrying %s after status %d (attempt %d of %d)", proxyReq.URL.String(), resp.StatusCode, attempt+1, maxRetries)
+			drainBody(resp.Body)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-proxyReq.Context().Done():
+			timer.Stop()
+			cancel()
+			return nil, proxyReq.Context().Err()
+		}
+
+		if proxyReq.GetBody != nil {
+			body, err := proxyReq.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			proxyReq.Body = body
+		}
+	}
+}
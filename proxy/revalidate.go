@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+// isFresh checks if the response can be served without asking the upstream
+func (c *CachedResponse) isFresh(now time.Time) bool {
+	return c.FreshUntil.IsZero() || now.Before(c.FreshUntil)
+}
+
+// applyDirectives records the Cache-Control directives of the response's
+// headers that decide how it may be served once stale
+func (c *CachedResponse) applyDirectives() {
+	directives := parseCacheControl(c.Header)
+	c.NoCache = directives.has("no-cache")
+	c.MustRevalidate = directives.has("must-revalidate")
+	c.StaleIfError = directives.seconds("stale-if-error")
+	c.StaleWhileRevalidate = directives.seconds("stale-while-revalidate")
+}
+
+// servableOnError checks if the stale response may stand in for a failed
+// upstream request, as allowed by stale-if-error
+func (c *CachedResponse) servableOnError(now time.Time) bool {
+	if c.MustRevalidate || c.StaleIfError <= 0 || c.FreshUntil.IsZero() {
+		return false
+	}
+	return now.Before(c.FreshUntil.Add(time.Duration(c.StaleIfError) * time.Second))
+}
+
+// hasValidators checks if the upstream can confirm a copy of the response is current
+func (c *CachedResponse) hasValidators() bool {
+	return c.ETag != "" || c.LastModified != ""
+}
+
+// setConditionalHeaders asks the upstream to answer 304 if the cached copy is
+// still current; the client's own validators are replaced, since a 304 is
+// only useful to us when it refers to our copy
+func (c *CachedResponse) setConditionalHeaders(header http.Header) {
+	header.Del("If-None-Match")
+	header.Del("If-Modified-Since")
+	if c.ETag != "" {
+		header.Set("If-None-Match", c.ETag)
+	}
+	if c.LastModified != "" {
+		header.Set("If-Modified-Since", c.LastModified)
+	}
+}
+
+// revalidate refreshes a stale entry with the headers of the upstream's 304
+// and stores it for another lifetime, returning the new cache item
+func (p *ProxyHandler) revalidate(key string, stale *CachedResponse, notModified *http.Response) *cache.CacheItem {
+	// A 304 carries updated metadata but never a body; the copy is as old
+	// as the upstream's confirmation of it
+	stale.Header.Del("Age")
+	stale.CreatedAt = time.Now().Add(-responseAge(notModified.Header))
+	for name, values := range notModified.Header {
+		if name == "Content-Length" {
+			continue
+		}
+		stale.Header[name] = values
+	}
+	if etag := notModified.Header.Get("ETag"); etag != "" {
+		stale.ETag = etag
+	}
+	if lastModified := notModified.Header.Get("Last-Modified"); lastModified != "" {
+		stale.LastModified = lastModified
+	}
+	stale.applyDirectives()
+
+	ttl := p.responseTTL(&http.Response{StatusCode: stale.StatusCode, Header: stale.Header, Request: notModified.Request})
+	if ttl > 0 {
+		if item := p.storeCachedResponse(key, stale, ttl); item != nil {
+			return item
+		}
+	}
+
+	// The entry couldn't be stored again, describe the response served now
+	now := time.Now()
+	return &cache.CacheItem{Key: key, Size: len(stale.Body), CreatedAt: now, ExpiresAt: now.Add(max(ttl, 0))}
+}
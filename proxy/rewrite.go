@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// rewriteRequestHeaders applies the header rules matching host to an
+// upstream request
+func (p *ProxyHandler) rewriteRequestHeaders(host string, header http.Header) {
+	for _, rule := range p.config.HeaderRules {
+		if rule.Matches(host) {
+			rewriteHeaders(header, rule.RemoveRequestHeaders, rule.AddRequestHeaders)
+		}
+	}
+}
+
+// rewriteResponseHeaders applies the header rules matching host to an
+// upstream response. It runs before the response is cached, so cache hits
+// carry the rewritten headers as well.
+func (p *ProxyHandler) rewriteResponseHeaders(host string, header http.Header) {
+	for _, rule := range p.config.HeaderRules {
+		if rule.Matches(host) {
+			rewriteHeaders(header, rule.RemoveResponseHeaders, rule.AddResponseHeaders)
+		}
+	}
+}
+
+// rewriteHeaders deletes the removed headers, then sets the added ones
+func rewriteHeaders(header http.Header, remove []string, add map[string]string) {
+	for _, name := range remove {
+		header.Del(name)
+	}
+	for name, value := range add {
+		header.Set(name, value)
+	}
+}
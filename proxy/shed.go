@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// shedSampleInterval is how often the pressure signal is re-evaluated
+	shedSampleInterval = 100 * time.Millisecond
+
+	// shedMinErrorSample is the number of upstream results a sampling window
+	// needs before its error rate counts towards the pressure
+	shedMinErrorSample = 20
+)
+
+// ShedOptions configures a LoadShedder
+type ShedOptions struct {
+	// Threshold is the pressure between 0 and 1 at which requests are shed, 0 disables shedding
+	Threshold float64
+
+	// Fraction of normal priority requests shed under pressure; low priority
+	// requests are always shed and high priority ones never
+	Fraction float64
+
+	// MaxInflightBytes is the amount of buffered response data counted as full pressure, 0 ignores it
+	MaxInflightBytes int64
+}
+
+// LoadShedder rejects a share of new requests while the proxy is overloaded.
+// The pressure is the highest of the queue fill ratio, the buffered response
+// bytes relative to their limit and the recent upstream error rate; it is
+// sampled periodically so that the per-request check is a single atomic load.
+type LoadShedder struct {
+	opts      ShedOptions
+	queueFill func() float64
+
+	inflightBytes atomic.Int64
+	requests      atomic.Int64 // Upstream results in the current sampling window
+	failures      atomic.Int64 // Failed upstream results in the current sampling window
+	pressure      atomic.Uint64
+	shed          atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewLoadShedder creates a load shedder; queueFill reports how full the request
+// queue is between 0 and 1. Sampling only runs when a threshold is set.
+func NewLoadShedder(opts ShedOptions, queueFill func() float64) *LoadShedder {
+	s := &LoadShedder{
+		opts:      opts,
+		queueFill: queueFill,
+		stop:      make(chan struct{}),
+	}
+
+	if opts.Threshold > 0 {
+		go s.run()
+	}
+	return s
+}
+
+// run samples the pressure until the shedder is stopped
+func (s *LoadShedder) run() {
+	ticker := time.NewTicker(shedSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sample()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// sample recomputes the pressure from the current signals
+func (s *LoadShedder) sample() {
+	pressure := s.queueFill()
+
+	if s.opts.MaxInflightBytes > 0 {
+		pressure = math.Max(pressure, float64(s.inflightBytes.Load())/float64(s.opts.MaxInflightBytes))
+	}
+
+	requests := s.requests.Swap(0)
+	failures := s.failures.Swap(0)
+	if requests >= shedMinErrorSample {
+		pressure = math.Max(pressure, float64(failures)/float64(requests))
+	}
+
+	s.pressure.Store(math.Float64bits(pressure))
+}
+
+// Shed decides whether a new request with the given priority is rejected
+func (s *LoadShedder) Shed(priority Priority) bool {
+	if s.opts.Threshold <= 0 || s.Pressure() < s.opts.Threshold {
+		return false
+	}
+
+	shed := false
+	switch priority {
+	case PriorityLow:
+		shed = true
+	case PriorityNormal:
+		shed = rand.Float64() < s.opts.Fraction
+	}
+
+	if shed {
+		s.shed.Add(1)
+	}
+	return shed
+}
+
+// TrackBytes adjusts the amount of buffered response data, negative n releases it
+func (s *LoadShedder) TrackBytes(n int64) {
+	s.inflightBytes.Add(n)
+}
+
+// RecordResult counts an upstream result towards the error rate
+func (s *LoadShedder) RecordResult(failed bool) {
+	s.requests.Add(1)
+	if failed {
+		s.failures.Add(1)
+	}
+}
+
+// Pressure returns the most recently sampled pressure
+func (s *LoadShedder) Pressure() float64 {
+	return math.Float64frombits(s.pressure.Load())
+}
+
+// ShedCount returns the number of requests shed so far
+func (s *LoadShedder) ShedCount() int64 {
+	return s.shed.Load()
+}
+
+// Stop ends pressure sampling; calling it again has no effect
+func (s *LoadShedder) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// statusCounters counts responses by status code without locking
+type statusCounters struct {
+	codes [600]atomic.Int64 // Indexed by status code
+}
+
+// record counts a response with the given status code
+func (s *statusCounters) record(code int) {
+	if code >= 100 && code < len(s.codes) {
+		s.codes[code].Add(1)
+	}
+}
+
+// snapshot returns the counts per status class ("2xx") and per individual code
+func (s *statusCounters) snapshot() (classes, codes map[string]int64) {
+	classes = map[string]int64{"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0}
+	codes = make(map[string]int64)
+	for code := 100; code < len(s.codes); code++ {
+		if n := s.codes[code].Load(); n > 0 {
+			classes[strconv.Itoa(code/100)+"xx"] += n
+			codes[strconv.Itoa(code)] = n
+		}
+	}
+	return classes, codes
+}
+
+// ProxyStats is a snapshot of the proxy's counters
+type ProxyStats struct {
+	Cache            cache.CacheStats `json:"cache"`
+	StatusClasses    map[string]int64 `json:"status_classes"` // Responses per status class
+	StatusCodes      map[string]int64 `json:"status_codes"`   // Responses per individual status code
+	InFlight         int64            `json:"in_flight"`
+	Workers          int              `json:"workers"` // Currently running, varies when min_workers is set
+	ActiveTunnels    int              `json:"active_tunnels"`
+	ShedRequests     int64            `json:"shed_requests"`
+	RejectedRequests int64            `json:"rejected_requests"` // Turned away by a full worker pool queue
+	DroppedRefreshes int64            `json:"dropped_refreshes"`
+	LoadPressure     float64          `json:"load_pressure"`
+}
+
+// Stats returns a snapshot of the proxy's counters
+func (p *ProxyHandler) Stats() ProxyStats {
+	classes, codes := p.statuses.snapshot()
+	return ProxyStats{
+		Cache:            p.CacheStats(),
+		StatusClasses:    classes,
+		StatusCodes:      codes,
+		InFlight:         p.InFlight(),
+		Workers:          p.Workers(),
+		ActiveTunnels:    p.ActiveTunnels(),
+		ShedRequests:     p.ShedRequests(),
+		RejectedRequests: p.RejectedRequests(),
+		DroppedRefreshes: p.DroppedRefreshes(),
+		LoadPressure:     p.LoadPressure(),
+	}
+}
+
+// serveStats writes the proxy's counters as JSON
+func (p *ProxyHandler) serveStats(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(p.Stats(), "", "  ")
+	if err != nil {
+		logging.Errorf("Error encoding stats: %v", err)
+		http.Error(w, "Error encoding stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
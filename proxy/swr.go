@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// servableWhileRevalidating checks if the stale response may be served while
+// a fresh copy is fetched in the background, as allowed by stale-while-revalidate
+func (c *CachedResponse) servableWhileRevalidating(now time.Time) bool {
+	if c.MustRevalidate || c.NoCache || c.StaleWhileRevalidate <= 0 || c.FreshUntil.IsZero() {
+		return false
+	}
+	return now.Before(c.FreshUntil.Add(time.Duration(c.StaleWhileRevalidate) * time.Second))
+}
+
+// refreshInBackground re-fetches a stale entry while it keeps being served.
+// Only one refresh runs per key; further hits in the meantime serve the
+// stale entry without starting another one.
+func (p *ProxyHandler) refreshInBackground(key string, r *http.Request, stale *CachedResponse) {
+	p.refreshingMutex.Lock()
+	if _, running := p.refreshing[key]; running {
+		p.refreshingMutex.Unlock()
+		return
+	}
+	p.refreshing[key] = struct{}{}
+	p.refreshingMutex.Unlock()
+
+	// The request must not be touched once its handler returns, and the
+	// stale response is still being written while the refresh updates it
+	req := r.Clone(context.Background())
+	req.Body = http.NoBody
+	entry := *stale
+	entry.Header = stale.Header.Clone()
+
+	started := p.refreshLimiter.Go(func() {
+		defer p.finishRefresh(key)
+		p.refresh(key, req, &entry)
+	})
+	if !started {
+		logging.Warnf("Dropped background refresh for %s: limit reached or shutting down", key)
+		p.finishRefresh(key)
+	}
+}
+
+// finishRefresh allows a new background refresh for the key
+func (p *ProxyHandler) finishRefresh(key string) {
+	p.refreshingMutex.Lock()
+	delete(p.refreshing, key)
+	p.refreshingMutex.Unlock()
+}
+
+// refresh fetches the response for a stale entry and updates the cache
+func (p *ProxyHandler) refresh(key string, r *http.Request, stale *CachedResponse) {
+	proxyReq, err := p.cloneRequest(r)
+	if err != nil {
+		logging.Errorf("Error creating refresh request for %s: %v", key, err)
+		return
+	}
+	stale.setConditionalHeaders(proxyReq.Header)
+
+	resp, err := p.client.Do(proxyReq)
+	if err != nil {
+		logging.Errorf("Error refreshing %s: %v", key, err)
+		return
+	}
+	defer resp.Body.Close()
+	p.prepareResponse(r, resp)
+
+	if resp.StatusCode == http.StatusNotModified {
+		p.revalidate(key, stale, resp)
+		logging.Debugf("Background refresh revalidated %s", key)
+		return
+	}
+
+	// Store the new response the same way a miss would
+	if p.needsGzipDecoding(r, resp, true) {
+		if err := decodeGzipResponse(resp); err != nil {
+			logging.Errorf("Error decoding refreshed response for %s: %v", key, err)
+			return
+		}
+	}
+	p.stripCookies(r, resp)
+	if !p.isResponseCacheable(resp) {
+		logging.Debugf("Background refresh for %s returned an uncacheable response (status %d)", key, resp.StatusCode)
+		return
+	}
+
+	body, err := p.readResponseBody(resp)
+	if err != nil {
+		logging.Errorf("Error reading refreshed response for %s: %v", key, err)
+		return
+	}
+	p.cacheFetchedResponse(r, resp, body)
+	logging.Debugf("Background refresh updated %s", key)
+}
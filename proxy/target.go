@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// validHostname matches DNS hostnames made of letters, digits, hyphens, underscores and dots
+var validHostname = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_.-]*[a-z0-9_])?\.?$`)
+
+// targetURLParam extracts the target URL from the url query parameter. A target
+// passed unencoded keeps everything after "url=" so that its own query string
+// survives intact; an encoded one is decoded, twice if the client double-encoded
+// it, and the parameters following it are added to its query string as they are
+func targetURLParam(rawQuery string) string {
+	var value string
+	switch {
+	case strings.HasPrefix(rawQuery, "url="):
+		value = rawQuery[len("url="):]
+	case strings.Contains(rawQuery, "&url="):
+		value = rawQuery[strings.Index(rawQuery, "&url=")+len("&url="):]
+	default:
+		return ""
+	}
+
+	// A literal scheme separator means the target was not encoded
+	if hasScheme(value) {
+		return value
+	}
+
+	// Otherwise the value ends at the next parameter
+	value, extra, _ := strings.Cut(value, "&")
+
+	decoded, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+	if !hasScheme(decoded) {
+		if twice, err := url.QueryUnescape(decoded); err == nil && hasScheme(twice) {
+			decoded = twice
+		}
+	}
+	return appendRawQuery(decoded, extra)
+}
+
+// appendRawQuery adds already encoded parameters to the query string of a
+// URL, ahead of its fragment
+func appendRawQuery(target, extra string) string {
+	if extra == "" {
+		return target
+	}
+	target, fragment, hasFragment := strings.Cut(target, "#")
+	if strings.Contains(target, "?") {
+		target += "&" + extra
+	} else {
+		target += "?" + extra
+	}
+	if hasFragment {
+		target += "#" + fragment
+	}
+	return target
+}
+
+// hasScheme checks if the value starts with a literal URL scheme such as "http://"
+func hasScheme(value string) bool {
+	scheme, rest, found := strings.Cut(value, "://")
+	if !found || scheme == "" || strings.ContainsAny(scheme, "/?&=%") {
+		return false
+	}
+	return rest != ""
+}
+
+// parseTargetURL parses and validates a target URL supplied by the client,
+// rejecting anything that could be abused to reach unintended resources,
+// and returns it in normalized form
+func parseTargetURL(raw string) (*url.URL, error) {
+	if strings.IndexFunc(raw, func(r rune) bool { return unicode.IsControl(r) || unicode.IsSpace(r) }) >= 0 {
+		return nil, errors.New("URL contains whitespace or control characters")
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("malformed URL: %w", err)
+	}
+
+	// Only plain web schemes may be proxied
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Opaque != "" {
+		return nil, errors.New("URL must include a host")
+	}
+	if parsed.User != nil {
+		return nil, errors.New("URL must not contain credentials")
+	}
+
+	hostname := strings.ToLower(parsed.Hostname())
+	if hostname == "" {
+		return nil, errors.New("URL must include a host")
+	}
+	if net.ParseIP(hostname) == nil && !validHostname.MatchString(hostname) {
+		return nil, fmt.Errorf("invalid host %q", hostname)
+	}
+
+	// Normalize the host and drop default ports
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	}
+	parsed.Host = hostname
+	if port != "" {
+		parsed.Host = hostname + ":" + port
+	}
+
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	// Fragments are never sent to the server
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	return parsed, nil
+}
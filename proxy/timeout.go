@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout middleware bounds the time a request may take: its context is
+// canceled after d, which aborts the upstream request, and the client gets a
+// 503 unless the response already started. Tunnels are left alone.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if d <= 0 || r.Method == http.MethodConnect || isUpgradeRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer close(done)
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) && tw.timeout() {
+					// The handler notices the canceled context on its own,
+					// anything it still writes is discarded
+					return
+				}
+				<-done
+			}
+
+			// Re-raise handler panics where the server can recover them
+			select {
+			case p := <-panicked:
+				panic(p)
+			default:
+			}
+		})
+	}
+}
+
+// timeoutWriter is a wrapper for http.ResponseWriter that lets the Timeout
+// middleware answer in place of a handler that is still running
+type timeoutWriter struct {
+	http.ResponseWriter
+	header http.Header // The handler's own, copied over when it writes its header
+
+	mutex       sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Header returns the handler's header map
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader sends the handler's header unless the request timed out
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+// writeHeaderLocked copies the handler's header and sends it
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	header := tw.ResponseWriter.Header()
+	for name, values := range tw.header {
+		header[name] = values
+	}
+	if code >= http.StatusOK {
+		tw.wroteHeader = true
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the handler's body unless the request timed out
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Flush sends what the handler wrote so far unless the request timed out
+func (tw *timeoutWriter) Flush() {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// timeout answers with 503 if the handler hasn't started its response yet,
+// reporting whether it did
+func (tw *timeoutWriter) timeout() bool {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.wroteHeader {
+		return false
+	}
+	tw.timedOut = true
+	http.Error(tw.ResponseWriter, "Request timed out", http.StatusServiceUnavailable)
+	return true
+}
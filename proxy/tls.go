@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// TLSDetails describes the TLS connection negotiated with an upstream
+type TLSDetails struct {
+	Version     string
+	CipherSuite string
+	CertExpiry  time.Time
+}
+
+// loadCertPool returns the system roots extended with the certificates in a PEM file
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", filename)
+	}
+	return pool, nil
+}
+
+// recordUpstreamTLS captures the TLS details of an upstream connection and
+// warns when the upstream uses a deprecated version or an expiring certificate
+func (p *ProxyHandler) recordUpstreamTLS(host string, state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+
+	details := TLSDetails{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		details.CertExpiry = state.PeerCertificates[0].NotAfter
+	}
+
+	p.tlsMutex.Lock()
+	previous, seen := p.upstreamTLS[host]
+	p.upstreamTLS[host] = details
+	p.tlsMutex.Unlock()
+
+	// Only report when a host is first seen or its setup changes
+	if seen && previous == details {
+		return
+	}
+
+	logging.Debugf("Upstream %s TLS: version=%s cipher=%s cert_expiry=%s",
+		host, details.Version, details.CipherSuite, details.CertExpiry.Format(time.RFC3339))
+
+	if minVersion, ok := config.ParseTLSVersion(p.config.TLSWarnMinVersion); ok && state.Version < minVersion {
+		logging.Warnf("Upstream %s uses deprecated %s", host, details.Version)
+	}
+
+	warnWindow := time.Duration(p.config.TLSCertExpiryWarnDays) * 24 * time.Hour
+	if warnWindow > 0 && !details.CertExpiry.IsZero() && time.Until(details.CertExpiry) < warnWindow {
+		logging.Warnf("Upstream %s certificate expires on %s", host, details.CertExpiry.Format(time.RFC3339))
+	}
+}
+
+// UpstreamTLS returns the TLS details last negotiated with an upstream host
+func (p *ProxyHandler) UpstreamTLS(host string) (TLSDetails, bool) {
+	p.tlsMutex.RLock()
+	defer p.tlsMutex.RUnlock()
+	details, ok := p.upstreamTLS[host]
+	return details, ok
+}
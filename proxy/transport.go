@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// newTransport builds the transport shared by all upstream requests. Its pool
+// limits are sized for a proxy talking to many hosts at once: the default of
+// two idle connections per host forces a fresh dial for most concurrent
+// requests to the same upstream.
+func newTransport(cfg *config.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout:   time.Duration(cfg.TLSHandshakeTimeout) * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	// Trust additional upstream CAs when configured
+	if cfg.UpstreamCAFile != "" {
+		if pool, err := loadCertPool(cfg.UpstreamCAFile); err != nil {
+			logging.Errorf("Error loading upstream CA file: %v", err)
+		} else {
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		}
+	}
+
+	// Chain through another proxy when configured
+	if cfg.UpstreamProxyURL != "" {
+		if proxyURL, err := config.ParseUpstreamProxyURL(cfg.UpstreamProxyURL); err != nil {
+			logging.Errorf("Error parsing upstream proxy URL: %v", err)
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	return transport
+}
+
+// checkRedirect returns the redirect policy of the upstream client: follow up
+// to limit redirects, hand them to the client when limit is 0, and follow up to
+// config.RedirectCap when limit is negative
+func checkRedirect(limit int) func(req *http.Request, via []*http.Request) error {
+	if limit == 0 {
+		return func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	if limit < 0 || limit > config.RedirectCap {
+		limit = config.RedirectCap
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+		return nil
+	}
+}
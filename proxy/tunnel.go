@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"sync"
+)
+
+// TunnelLimiter caps the number of concurrent long-lived tunnels, both overall
+// and per client IP, since they are not bounded by the worker pool.
+//
+// Unlike the rate limiter it doesn't keep its per-IP counts in an IdleMap: a
+// count belongs to tunnels that may stay open for hours without the limiter
+// hearing from them, so sweeping it by idle time would lift the cap for
+// clients that are still holding their tunnels. Counts are instead removed as
+// soon as the last tunnel of an IP closes, which keeps the map no larger than
+// the number of clients with an open tunnel.
+type TunnelLimiter struct {
+	mutex    sync.Mutex
+	max      int // 0 means unlimited
+	maxPerIP int // 0 means unlimited
+	active   int
+	perIP    map[string]int
+	metrics  *PrometheusMetrics
+}
+
+// NewTunnelLimiter creates a limiter; a limit of 0 disables that cap
+func NewTunnelLimiter(max, maxPerIP int) *TunnelLimiter {
+	return &TunnelLimiter{
+		max:      max,
+		maxPerIP: maxPerIP,
+		perIP:    make(map[string]int),
+	}
+}
+
+// Acquire reserves a tunnel for the client IP, reporting false if a cap is reached
+func (l *TunnelLimiter) Acquire(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if (l.max > 0 && l.active >= l.max) || (l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP) {
+		l.metrics.recordTunnelRejection()
+		return false
+	}
+
+	l.active++
+	l.perIP[ip]++
+	l.metrics.recordTunnel(1)
+	return true
+}
+
+// Release frees a tunnel reserved by Acquire once it has closed
+func (l *TunnelLimiter) Release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.active--
+	l.metrics.recordTunnel(-1)
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
+
+// SetMetrics makes the limiter report open and rejected tunnels in the metrics
+func (l *TunnelLimiter) SetMetrics(metrics *PrometheusMetrics) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.metrics = metrics
+}
+
+// Active returns the number of open tunnels
+func (l *TunnelLimiter) Active() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.active
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// isUpgradeRequest checks if the client asks to switch protocols
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && headerHasToken(r.Header, "Connection", "upgrade")
+}
+
+// headerHasToken checks if a comma separated header contains the token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ActiveTunnels returns the number of currently open tunnels
+func (p *ProxyHandler) ActiveTunnels() int {
+	return p.tunnels.Active()
+}
+
+// handleUpgrade tunnels a protocol upgrade to the target server. WebSocket
+// upgrades are always tunneled; other protocols only when configured to.
+func (p *ProxyHandler) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	defer drainBody(r.Body)
+
+	protocol := r.Header.Get("Upgrade")
+	if !headerHasToken(r.Header, "Upgrade", "websocket") && !p.config.TunnelAllUpgrades {
+		http.Error(w, fmt.Sprintf("Upgrade to %s not supported", protocol), http.StatusNotImplemented)
+		return
+	}
+
+	if !p.resolveTarget(w, r) {
+		return
+	}
+
+	// Tunnels hold a goroutine pair and two connections until closed
+	ip := clientIP(r).String()
+	if !p.tunnels.Acquire(ip) {
+		logging.Warnf("Rejecting %s upgrade from %s: tunnel limit reached", protocol, ip)
+		http.Error(w, "Too many open tunnels", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.tunnels.Release(ip)
+
+	// cloneRequest drops the hop-by-hop headers, which the upgrade relies on
+	proxyReq, err := p.cloneRequest(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating proxy request: %v", err), http.StatusInternalServerError)
+		return
+	}
+	proxyReq.Header.Set("Connection", "Upgrade")
+	proxyReq.Header.Set("Upgrade", protocol)
+
+	// Bypass the client so its timeout doesn't cut the tunnel short
+	resp, err := p.client.Transport.RoundTrip(proxyReq)
+	if err != nil {
+		status, reason := classifyUpstreamError(err)
+		writeProxyError(w, status, reason, fmt.Sprintf("Error forwarding request: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	// The upstream declined to switch, relay its answer as a regular response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		removeHopByHopHeaders(resp.Header)
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.Header().Set("X-Proxy-Server", "Go-Proxy-Server/1.0")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, "Upstream connection can't be upgraded", http.StatusBadGateway)
+		return
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error upgrading connection: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// Hand the upstream's handshake response to the client
+	fmt.Fprintf(buf, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(buf)
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		logging.Errorf("Error writing upgrade response: %v", err)
+		return
+	}
+
+	logging.Infof("Tunneling %s upgrade to %s", protocol, r.URL.Host)
+
+	// Copy in both directions until either side closes; the client side reads
+	// through buf so that bytes buffered after the request aren't lost
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(upstream, buf)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(conn, upstream)
+		errc <- err
+	}()
+	<-errc
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+// newVaryIndex creates the store of Vary header lists, one per cache key. It
+// holds as many keys as the response cache holds entries, so a list only gets
+// evicted once its variants are likely gone as well.
+func newVaryIndex(size int) *cache.LRUCache {
+	return cache.NewLRUCache(size)
+}
+
+// parseVary returns the canonical, sorted header names listed in Vary, and
+// whether the response varies on something other than request headers
+func parseVary(header http.Header) ([]string, bool) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, true
+			}
+			name = http.CanonicalHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, false
+}
+
+// variantKey extends a cache key with the request's values for the given headers
+func variantKey(key string, names []string, r *http.Request) string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = name + "=" + url.QueryEscape(strings.Join(r.Header.Values(name), ","))
+	}
+	return key + "|" + strings.Join(values, "&")
+}
+
+// varyNames returns the headers recorded for a cache key, if any
+func (p *ProxyHandler) varyNames(key string) []string {
+	item, found := p.varies.Peek(key)
+	if !found || len(item.Value) == 0 {
+		return nil
+	}
+	return strings.Split(string(item.Value), ",")
+}
+
+// recordVary remembers the headers a response varies on, so that lookups for
+// its URL go to the variant matching the request; it has to happen before the
+// response is stored. The lists are kept apart from the response cache, where
+// they would count against its capacity and could be evicted before the
+// variants that depend on them.
+func (p *ProxyHandler) recordVary(r *http.Request, resp *http.Response) {
+	key := p.baseCacheKey(r)
+	names, _ := parseVary(resp.Header)
+	if len(names) == 0 {
+		p.varies.Remove(key)
+		return
+	}
+	p.varies.Set(key, []byte(strings.Join(names, ",")), 0)
+}
@@ -1,35 +1,144 @@
 package proxy
 
 import (
+	"container/heap"
 	"context"
-	"log"
+	"errors"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+)
+
+// Priority determines the order in which queued requests are processed
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
 )
 
+// ErrQueueFull is returned for jobs turned away because no queue slot freed
+// up within the pool's full timeout
+var ErrQueueFull = errors.New("worker pool queue is full")
+
+// ErrPoolStopped is returned for jobs enqueued once the pool has been stopped
+var ErrPoolStopped = errors.New("worker pool is stopped")
+
 // WorkerPool manages a pool of workers for handling HTTP requests
 type WorkerPool struct {
-	jobQueue   chan *job
+	queue      jobQueue      // Pending jobs ordered by priority
+	mutex      sync.Mutex    // Guards queue and seq
+	seq        uint64        // Insertion counter keeping FIFO order within a priority
+	slots      chan struct{} // Free queue slots, blocks Enqueue while the queue is full
+	ready      chan struct{} // One token per queued job, wakes up a worker
 	wg         sync.WaitGroup
+	minWorkers int
 	maxWorkers int
+	stopped    atomic.Bool
+
+	workers     atomic.Int32  // Workers currently running
+	active      atomic.Int32  // Jobs currently being processed
+	lastID      atomic.Int32  // Last worker ID handed out
+	spawnMutex  sync.Mutex    // Keeps workers from being added once the pool stops
+	stopScaler  chan struct{} // Closed by Stop to end the scaler
+	stopOnce    sync.Once
+	idleTimeout time.Duration // Idle time after which workers above the minimum retire
+	scaleDepth  int           // Queue depth that has to persist for workers to be added
+
+	fullTimeout time.Duration // Max wait for a queue slot, 0 waits as long as the enqueuer's context allows
+	rejected    atomic.Int64  // Jobs turned away with ErrQueueFull
+}
+
+// WorkerPoolOptions configures a worker pool
+type WorkerPoolOptions struct {
+	// MaxWorkers bounds the number of workers, 10 if not positive; the queue
+	// holds twice as many jobs
+	MaxWorkers int
+
+	// MinWorkers below MaxWorkers makes the pool scale: it starts with
+	// MinWorkers, adds workers while ScaleUpQueueDepth jobs keep waiting and
+	// retires them again after IdleTimeout without work. Otherwise the pool
+	// runs MaxWorkers throughout.
+	MinWorkers        int
+	ScaleUpQueueDepth int           // 1 by default
+	IdleTimeout       time.Duration // 30 seconds by default
+
+	// FullTimeout is how long Enqueue waits for room in a full queue before
+	// giving up with ErrQueueFull, 0 waits as long as its context allows
+	FullTimeout time.Duration
 }
 
+// scaleInterval is how often a scaling pool samples its queue depth
+const scaleInterval = 50 * time.Millisecond
+
+// Job states; a queued job is either started by a worker or canceled by its
+// enqueuer, whichever happens first
+const (
+	jobQueued int32 = iota
+	jobStarted
+	jobCanceled
+)
+
 // job represents a request to be processed
 type job struct {
-	w    http.ResponseWriter
-	r    *http.Request
-	done chan struct{}
+	w        http.ResponseWriter
+	r        *http.Request
+	done     chan struct{}
+	priority Priority
+	seq      uint64
+	state    atomic.Int32
 }
 
 // NewWorkerPool creates a new worker pool with the specified number of workers
 func NewWorkerPool(maxWorkers int) *WorkerPool {
+	return NewWorkerPoolWithOptions(WorkerPoolOptions{MaxWorkers: maxWorkers})
+}
+
+// NewWorkerPoolWithTimeout creates a new worker pool whose Enqueue gives up
+// with ErrQueueFull after waiting fullTimeout for room in a full queue
+func NewWorkerPoolWithTimeout(maxWorkers int, fullTimeout time.Duration) *WorkerPool {
+	return NewWorkerPoolWithOptions(WorkerPoolOptions{MaxWorkers: maxWorkers, FullTimeout: fullTimeout})
+}
+
+// NewAutoScalingWorkerPool creates a worker pool running between min and max
+// workers depending on how many jobs are waiting
+func NewAutoScalingWorkerPool(min, max int) *WorkerPool {
+	return NewWorkerPoolWithOptions(WorkerPoolOptions{MinWorkers: min, MaxWorkers: max})
+}
+
+// NewWorkerPoolWithOptions creates a new worker pool configured by opts
+func NewWorkerPoolWithOptions(opts WorkerPoolOptions) *WorkerPool {
+	maxWorkers := opts.MaxWorkers
 	if maxWorkers <= 0 {
 		maxWorkers = 10 // Default to 10 workers if invalid number provided
 	}
+	minWorkers := opts.MinWorkers
+	if minWorkers <= 0 || minWorkers > maxWorkers {
+		minWorkers = maxWorkers
+	}
 
+	queueSize := maxWorkers * 2 // Buffer size twice the number of workers
 	pool := &WorkerPool{
-		jobQueue:   make(chan *job, maxWorkers*2), // Buffer size twice the number of workers
+		slots:      make(chan struct{}, queueSize),
+		ready:      make(chan struct{}, queueSize),
+		minWorkers: minWorkers,
 		maxWorkers: maxWorkers,
+
+		stopScaler:  make(chan struct{}),
+		idleTimeout: opts.IdleTimeout,
+		scaleDepth:  opts.ScaleUpQueueDepth,
+
+		fullTimeout: opts.FullTimeout,
+	}
+	if pool.idleTimeout <= 0 {
+		pool.idleTimeout = 30 * time.Second
+	}
+	if pool.scaleDepth <= 0 {
+		pool.scaleDepth = 1
 	}
 
 	// Start the workers
@@ -37,59 +146,325 @@ func NewWorkerPool(maxWorkers int) *WorkerPool {
 	return pool
 }
 
-// start launches the worker goroutines
+// start launches the minimum number of workers, and the scaler if the pool may grow
 func (wp *WorkerPool) start() {
-	for i := 0; i < wp.maxWorkers; i++ {
+	wp.spawn(wp.minWorkers)
+	if wp.scales() {
+		wp.wg.Add(1)
+		go wp.scale()
+		logging.Infof("Started %d workers in the pool, scaling up to %d", wp.minWorkers, wp.maxWorkers)
+		return
+	}
+	logging.Infof("Started %d workers in the pool", wp.maxWorkers)
+}
+
+// scales reports whether the number of workers adapts to the load
+func (wp *WorkerPool) scales() bool {
+	return wp.minWorkers < wp.maxWorkers
+}
+
+// spawn starts up to n more workers without exceeding the maximum, unless the
+// pool is stopped
+func (wp *WorkerPool) spawn(n int) {
+	wp.spawnMutex.Lock()
+	defer wp.spawnMutex.Unlock()
+	if wp.stopped.Load() {
+		return
+	}
+
+	n = min(n, wp.maxWorkers-int(wp.workers.Load()))
+	for i := 0; i < n; i++ {
+		wp.workers.Add(1)
 		wp.wg.Add(1)
-		go wp.worker(i)
+		go wp.worker(int(wp.lastID.Add(1)))
 	}
-	log.Printf("Started %d workers in the pool", wp.maxWorkers)
 }
 
-// worker processes jobs from the job queue
+// retire lets a worker exit if there are more than the minimum
+func (wp *WorkerPool) retire() bool {
+	for {
+		n := wp.workers.Load()
+		if int(n) <= wp.minWorkers {
+			return false
+		}
+		if wp.workers.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// scale adds workers while the queue stays at least scaleDepth deep for two
+// samples in a row, enough to cover the waiting jobs
+func (wp *WorkerPool) scale() {
+	defer wp.wg.Done()
+
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	backlogged := false
+	for {
+		select {
+		case <-wp.stopScaler:
+			return
+		case <-ticker.C:
+		}
+
+		depth := wp.QueueLength()
+		if depth < wp.scaleDepth {
+			backlogged = false
+			continue
+		}
+		if backlogged {
+			before := wp.Workers()
+			wp.spawn(depth)
+			if added := wp.Workers() - before; added > 0 {
+				logging.Debugf("Added %d workers for %d queued jobs, %d running", added, depth, before+added)
+			}
+		}
+		backlogged = true
+	}
+}
+
+// worker processes jobs from the job queue; in a scaling pool workers above
+// the minimum exit once they idle for idleTimeout
 func (wp *WorkerPool) worker(id int) {
 	defer wp.wg.Done()
 
-	for job := range wp.jobQueue {
-		// Process the request
-		handler := job.r.Context().Value(handlerContextKey).(http.Handler)
-		handler.ServeHTTP(job.w, job.r)
+	var (
+		timer *time.Timer
+		idle  <-chan time.Time
+	)
+	if wp.scales() {
+		timer = time.NewTimer(wp.idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
 
-		// Signal that the job is done
+	for {
+		select {
+		case _, ok := <-wp.ready:
+			if !ok {
+				wp.workers.Add(-1)
+				return
+			}
+			wp.process(id)
+		case <-idle:
+			if wp.retire() {
+				logging.Debugf("Worker %d retired after idling for %v", id, wp.idleTimeout)
+				return
+			}
+		}
+		if timer != nil {
+			timer.Reset(wp.idleTimeout)
+		}
+	}
+}
+
+// process runs the most important queued job
+func (wp *WorkerPool) process(id int) {
+	// Take the most important job and free its queue slot
+	job := wp.pop()
+	<-wp.slots
+
+	// Skip jobs whose enqueuer gave up while they were queued
+	if !job.state.CompareAndSwap(jobQueued, jobStarted) {
+		return
+	}
+
+	// The client may have gone away while the job was queued
+	if err := job.r.Context().Err(); err != nil {
+		logging.Debugf("Worker %d skipping abandoned request for %s: %v", id, job.r.URL.String(), err)
 		close(job.done)
+		return
 	}
+
+	// Process the request
+	wp.active.Add(1)
+	defer wp.active.Add(-1)
+	handler := job.r.Context().Value(handlerContextKey).(http.Handler)
+	handler.ServeHTTP(job.w, job.r)
+
+	// Signal that the job is done
+	close(job.done)
 }
 
-// Enqueue adds a new job to the queue
-func (wp *WorkerPool) Enqueue(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+// Enqueue adds a new job to the queue with normal priority
+func (wp *WorkerPool) Enqueue(ctx context.Context, w http.ResponseWriter, r *http.Request, handler http.Handler) error {
+	return wp.EnqueueWithPriority(ctx, w, r, handler, PriorityNormal)
+}
+
+// EnqueueWithPriority adds a new job to the queue and waits for it to complete;
+// higher priority jobs are dequeued first, jobs of equal priority in arrival
+// order. If ctx or the request's context is done before a worker picks the
+// job up, the job is dropped and the context's error returned, or
+// ErrQueueFull if the queue stayed full; ErrPoolStopped once Stop was called;
+// once started, the job runs to completion, which a canceled request context
+// cuts short.
+func (wp *WorkerPool) EnqueueWithPriority(ctx context.Context, w http.ResponseWriter, r *http.Request, handler http.Handler, priority Priority) error {
 	// Create a done channel for synchronization
 	done := make(chan struct{})
 
+	// The client leaving abandons the job just like ctx, which may be a
+	// different context
+	client := r.Context()
+
 	// Store the handler in the request context
-	ctx := context.WithValue(r.Context(), handlerContextKey, handler)
-	r = r.WithContext(ctx)
+	r = r.WithContext(context.WithValue(r.Context(), handlerContextKey, handler))
 
 	// Create a new job
 	job := &job{
-		w:    w,
-		r:    r,
-		done: done,
+		w:        w,
+		r:        r,
+		done:     done,
+		priority: priority,
 	}
 
-	// Add the job to the queue
-	wp.jobQueue <- job
+	// Wait for a free slot, then add the job to the queue; rather than
+	// piling up behind a full queue, jobs are turned away after fullTimeout
+	var full <-chan time.Time
+	if wp.fullTimeout > 0 {
+		timer := time.NewTimer(wp.fullTimeout)
+		defer timer.Stop()
+		full = timer.C
+	}
+	select {
+	case wp.slots <- struct{}{}:
+	case <-full:
+		wp.rejected.Add(1)
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-client.Done():
+		return client.Err()
+	}
+
+	// Stop closes ready under spawnMutex, so the job is either queued before
+	// that or turned away
+	wp.spawnMutex.Lock()
+	if wp.stopped.Load() {
+		wp.spawnMutex.Unlock()
+		<-wp.slots
+		return ErrPoolStopped
+	}
+	wp.push(job)
+	wp.ready <- struct{}{}
+	wp.spawnMutex.Unlock()
 
 	// Wait for the job to complete
+	var err error
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-client.Done():
+		err = client.Err()
+	}
+	if job.state.CompareAndSwap(jobQueued, jobCanceled) {
+		return err
+	}
+	// A worker already owns the response writer, let it finish
 	<-done
+	return nil
+}
+
+// QueueLength returns the number of jobs waiting for a worker
+func (wp *WorkerPool) QueueLength() int {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	return wp.queue.Len()
+}
+
+// Rejected returns the number of jobs turned away because the queue was full
+func (wp *WorkerPool) Rejected() int64 {
+	return wp.rejected.Load()
+}
+
+// QueueCapacity returns the number of jobs that can wait for a worker at once
+func (wp *WorkerPool) QueueCapacity() int {
+	return cap(wp.slots)
+}
+
+// Accepting reports whether new jobs are taken without waiting for a queue slot
+func (wp *WorkerPool) Accepting() bool {
+	return !wp.stopped.Load() && len(wp.slots) < cap(wp.slots)
+}
+
+// Workers returns the number of workers currently running
+func (wp *WorkerPool) Workers() int {
+	return int(wp.workers.Load())
+}
+
+// Stop gracefully shuts down the worker pool; queued jobs are still
+// processed unless ctx is done first, in which case Stop stops waiting for
+// them and returns the context's error. Calling it again only waits again.
+func (wp *WorkerPool) Stop(ctx context.Context) error {
+	wp.stopOnce.Do(func() {
+		wp.spawnMutex.Lock()
+		wp.stopped.Store(true)
+		close(wp.ready)
+		wp.spawnMutex.Unlock()
+
+		close(wp.stopScaler)
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logging.Infof("Worker pool stopped")
+		return nil
+	case <-ctx.Done():
+		logging.Warnf("Worker pool stop gave up: abandoned %d running and %d queued jobs", wp.active.Load(), wp.QueueLength())
+		return ctx.Err()
+	}
 }
 
-// Stop gracefully shuts down the worker pool
-func (wp *WorkerPool) Stop() {
-	close(wp.jobQueue)
-	wp.wg.Wait()
-	log.Printf("Worker pool stopped")
+// push adds a job to the priority queue
+func (wp *WorkerPool) push(j *job) {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	wp.seq++
+	j.seq = wp.seq
+	heap.Push(&wp.queue, j)
+}
+
+// pop removes the highest priority job from the queue
+func (wp *WorkerPool) pop() *job {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	return heap.Pop(&wp.queue).(*job)
+}
+
+// jobQueue is a priority queue of jobs implementing heap.Interface
+type jobQueue []*job
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x any) { *q = append(*q, x.(*job)) }
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return j
 }
 
 // handlerContextKey is a key for storing the http.Handler in the request context
 type contextKey string
-const handlerContextKey contextKey = "handler"
\ No newline at end of file
+const handlerContextKey contextKey = "handler"
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestAdminListener_ServesOwnEndpoints(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.AdminPort = 9091
+	cfg.MetricsEnabled = true
+	handler := newTestProxy(t, cfg)
+	chain := proxy.CreateMiddlewareChain(handler, cfg)
+	admin := handler.AdminHandler()
+
+	proxyGet(chain, upstream.URL)
+
+	for _, path := range []string{"/healthz", "/readyz", "/stats", "/metrics", "/admin/config"} {
+		if rec := adminGet(admin, path, "127.0.0.1:1234", ""); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s on the admin listener, got %d", path, rec.Code)
+		}
+	}
+
+	rec := adminGet(admin, "/metrics", "127.0.0.1:1234", "")
+	if !strings.Contains(rec.Body.String(), "proxy_requests_total") {
+		t.Errorf("Expected the proxy's request metrics on the admin listener")
+	}
+	rec = adminGet(admin, "/stats", "127.0.0.1:1234", "")
+	if !strings.Contains(rec.Body.String(), `"cache"`) {
+		t.Errorf("Expected the proxy's stats on the admin listener, got %s", rec.Body.String())
+	}
+}
+
+func TestAdminListener_ProxyPortOnlyProxies(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.AdminPort = 9091
+	cfg.MetricsEnabled = true
+	cfg.EnablePprof = true
+	chain := proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg)
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics", "/admin/config", "/debug/pprof/"} {
+		if rec := adminGet(chain, path, "127.0.0.1:1234", ""); rec.Code == http.StatusOK {
+			t.Errorf("Expected %s not to be served on the proxy port", path)
+		}
+	}
+}
+
+func TestAdminListener_StatsRequireAdmin(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.AdminPort = 9091
+	admin := newTestProxy(t, cfg).AdminHandler()
+
+	if rec := adminGet(admin, "/stats", "192.0.2.1:1234", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for remote client, got %d", rec.Code)
+	}
+	if rec := adminGet(admin, "/healthz", "192.0.2.1:1234", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected health checks open to every client, got %d", rec.Code)
+	}
+}
+
+func TestConfig_AdminPortValidation(t *testing.T) {
+	for _, port := range []int{-1, 65536, 8080} {
+		cfg := config.NewDefaultConfig()
+		cfg.AdminPort = port
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for admin port %d", port)
+		}
+	}
+}
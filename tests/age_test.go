@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// ageOf returns the Age header of a response in seconds
+func ageOf(t *testing.T, rec *httptest.ResponseRecorder) int {
+	t.Helper()
+	age, err := strconv.Atoi(rec.Header().Get("Age"))
+	if err != nil {
+		t.Fatalf("Expected a numeric Age header, got %q", rec.Header().Get("Age"))
+	}
+	return age
+}
+
+func TestProxy_CacheHitReportsAgeFromCreatedAt(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the response to be served from cache")
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+
+	// The entry was cached 5 seconds ago
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": {"max-age=60"}},
+		Body:       []byte("cached"),
+		CreatedAt:  time.Now().Add(-5 * time.Second),
+		FreshUntil: time.Now().Add(55 * time.Second),
+	})
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected X-Cache HIT, got %s", rec.Header().Get("X-Cache"))
+	}
+	if age := ageOf(t, rec); age < 4 || age > 6 {
+		t.Errorf("Expected Age 5 (±1), got %d", age)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "max-age=55" {
+		t.Errorf("Expected Cache-Control max-age=55, got %s", cc)
+	}
+}
+
+func TestProxy_UpstreamAgeCountsAgainstLifetime(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Age", "30")
+		w.Write([]byte("fresh"))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected X-Cache HIT, got %s", rec.Header().Get("X-Cache"))
+	}
+	if age := ageOf(t, rec); age < 30 || age > 31 {
+		t.Errorf("Expected Age 30 (±1), got %d", age)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "max-age=30" && cc != "max-age=29" {
+		t.Errorf("Expected Cache-Control max-age=30, got %s", cc)
+	}
+}
+
+func TestProxy_StaleOnArrivalIsNotCached(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Age", "90")
+		w.Write([]byte("fresh"))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected X-Cache MISS, got %s", rec.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		exact   bool
+		want    bool
+	}{
+		{"example.com", "example.com", false, true},
+		{"example.com", "api.example.com", false, true},
+		{"example.com", "API.Example.COM.", false, true},
+		{"example.com", "notexample.com", false, false},
+		{"example.com", "evilexample.com", false, false},
+		{"example.com", "example.com.evil.org", false, false},
+		{"example.com", "example.com", true, true},
+		{"example.com", "api.example.com", true, false},
+		{"*.internal", "db.internal", false, true},
+		{"*.internal", "a.b.internal", true, true},
+		{"*.internal", "internal", false, false},
+		{"*.internal", "notinternal", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := config.MatchDomain(tt.pattern, tt.host, tt.exact); got != tt.want {
+			t.Errorf("MatchDomain(%q, %q, %v): Expected %v, got %v", tt.pattern, tt.host, tt.exact, tt.want, got)
+		}
+	}
+}
+
+func TestProxy_AllowedDomainsRejectsSuffixBypass(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.AllowedDomains = []string{"example.com"}
+	handler := newTestProxy(t, cfg)
+
+	for _, target := range []string{"http://notexample.com/", "http://evilexample.com/"} {
+		if rec := proxyGet(handler, target); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: Expected status 403, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestProxy_AllowedDomainsIgnoresPort(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.AllowedDomains = []string{"127.0.0.1"}
+	cfg.AllowedDomainsExact = true
+	handler := newTestProxy(t, cfg)
+
+	if rec := proxyGet(handler, upstream.URL); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestConfig_AllowedDomainsValidation(t *testing.T) {
+	for _, domain := range []string{"", "*", "*.", "api.*.example.com"} {
+		cfg := config.NewDefaultConfig()
+		cfg.AllowedDomains = []string{domain}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%q: Expected validation error", domain)
+		}
+	}
+}
+
+func TestProxy_BlockedDomainWinsOverAllowed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.AllowedDomains = []string{"127.0.0.1"}
+	cfg.BlockedDomains = []string{"127.0.0.1"}
+	handler := newTestProxy(t, cfg)
+
+	if rec := proxyGet(handler, upstream.URL); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestProxy_BlockedDomainsWithoutAllowlist(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.BlockedDomains = []string{"*.tracker.test", "ads.example"}
+	handler := newTestProxy(t, cfg)
+
+	for _, target := range []string{"http://pixel.tracker.test/", "http://cdn.ads.example/x"} {
+		if rec := proxyGet(handler, target); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: Expected status 403, got %d", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAuthProxy creates a middleware chain requiring the user alice with
+// password secret
+func newAuthProxy(t *testing.T) http.Handler {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+
+	cfg := config.NewDefaultConfig()
+	cfg.AuthUsers = map[string]string{"alice": string(hash)}
+	return proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg)
+}
+
+func TestAuth_QueryFormRequiresAuthorization(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+	handler := newAuthProxy(t)
+	target := "/?url=" + url.QueryEscape(upstream.URL)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without credentials, got %d", rec.Code)
+	}
+	if rec.Header().Get("WWW-Authenticate") != `Basic realm="proxy"` {
+		t.Errorf("Expected WWW-Authenticate challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetBasicAuth("alice", "wrong")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with a wrong password, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetBasicAuth("alice", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with credentials, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Seen-Authorization"); got != "" {
+		t.Errorf("Expected credentials not to reach the upstream, got %q", got)
+	}
+}
+
+func TestAuth_ProxyFormRequiresProxyAuthorization(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+	handler := newAuthProxy(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, upstream.URL+"/", nil))
+	if rec.Code != http.StatusProxyAuthRequired {
+		t.Errorf("Expected status 407 without credentials, got %d", rec.Code)
+	}
+	if rec.Header().Get("Proxy-Authenticate") != `Basic realm="proxy"` {
+		t.Errorf("Expected Proxy-Authenticate challenge, got %q", rec.Header().Get("Proxy-Authenticate"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, upstream.URL+"/", nil)
+	req.Header.Set("Proxy-Authorization", "Basic YWxpY2U6c2VjcmV0") // alice:secret
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with credentials, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Seen-Proxy-Authorization"); got != "" {
+		t.Errorf("Expected credentials not to reach the upstream, got %q", got)
+	}
+}
+
+func TestAuth_HealthCheckExempt(t *testing.T) {
+	handler := newAuthProxy(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for the health check, got %d", rec.Code)
+	}
+}
+
+func TestConfig_AuthUsersValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.AuthUsers = map[string]string{"alice": "secret"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for a plaintext password")
+	}
+}
+
+func TestAuth_ReloadedPasswordReplacesVerifiedOne(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+	oldHash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	newHash, _ := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+
+	cfg := config.NewDefaultConfig()
+	cfg.AuthUsers = map[string]string{"alice": string(oldHash)}
+	proxyHandler := newTestProxy(t, cfg)
+	handler := proxy.CreateMiddlewareChain(proxyHandler, cfg)
+	target := "/?url=" + url.QueryEscape(upstream.URL)
+
+	status := func(password string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.SetBasicAuth("alice", password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The old password is verified and remembered
+	if code := status("secret"); code != http.StatusOK {
+		t.Fatalf("Expected status 200 before the reload, got %d", code)
+	}
+
+	next := *cfg
+	next.AuthUsers = map[string]string{"alice": string(newHash)}
+	if _, err := proxyHandler.Settings().Reload(&next); err != nil {
+		t.Fatalf("Expected reload to succeed: %v", err)
+	}
+
+	if code := status("secret"); code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to be rejected after the reload, got %d", code)
+	}
+	if code := status("changed"); code != http.StatusOK {
+		t.Errorf("Expected the new password to be accepted, got %d", code)
+	}
+}
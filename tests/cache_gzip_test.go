@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// textServer returns a cacheable upstream serving body as plain text
+func textServer(body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(body))
+	}))
+}
+
+// storedResponse decodes the only entry in the cache
+func storedResponse(t *testing.T, c cache.Cache) *proxy.CachedResponse {
+	t.Helper()
+	keys := c.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 cache entry, got %d", len(keys))
+	}
+	item, _ := c.Peek(keys[0])
+	data, err := cache.Decompress(item.Value)
+	if err != nil {
+		t.Fatalf("Expected entry to decompress, got %v", err)
+	}
+	stored, err := proxy.DecodeCachedResponse(data)
+	if err != nil {
+		t.Fatalf("Expected entry to decode, got %v", err)
+	}
+	return stored
+}
+
+func TestProxy_CacheGzipRoundTrip(t *testing.T) {
+	body := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 200)
+	upstream := textServer(body)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheGzipMinSize = 1024
+	c := cache.NewLRUCache(cfg.CacheSize)
+	handler := newTestProxyWithCache(t, cfg, c)
+
+	if rec := proxyGet(handler, upstream.URL); rec.Body.String() != body {
+		t.Errorf("Expected the miss to serve the upstream body, got %d bytes", rec.Body.Len())
+	}
+
+	stored := storedResponse(t, c)
+	if !stored.BodyGzipped {
+		t.Errorf("Expected the body to be stored gzipped")
+	}
+	if len(stored.Body) >= len(body) {
+		t.Errorf("Expected stored body smaller than %d bytes, got %d", len(body), len(stored.Body))
+	}
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected cache hit, got %s", rec.Header().Get("X-Cache"))
+	}
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding without Accept-Encoding, got %s", rec.Header().Get("Content-Encoding"))
+	}
+	if !bytes.Equal(rec.Body.Bytes(), []byte(body)) {
+		t.Errorf("Expected the cached body to round-trip byte for byte")
+	}
+}
+
+func TestProxy_CacheGzipServedAsIsToGzipClients(t *testing.T) {
+	body := strings.Repeat("<p>hello</p>\n", 500)
+	upstream := textServer(body)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheGzipMinSize = 1024
+	handler := newTestProxy(t, cfg)
+
+	proxyGet(handler, upstream.URL)
+	rec := proxyGetWithHeader(handler, upstream.URL, "Accept-Encoding", "gzip")
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	if rec.Header().Get("Content-Length") != strconv.Itoa(rec.Body.Len()) {
+		t.Errorf("Expected Content-Length %d, got %s", rec.Body.Len(), rec.Header().Get("Content-Length"))
+	}
+	if !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Accept-Encoding") {
+		t.Errorf("Expected Vary to include Accept-Encoding, got %v", rec.Header().Values("Vary"))
+	}
+
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Expected a gzip body, got %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != body {
+		t.Errorf("Expected decoded body to match the upstream body")
+	}
+
+	// Clients refusing gzip get the decoded body
+	rec = proxyGetWithHeader(handler, upstream.URL, "Accept-Encoding", "gzip;q=0")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+		t.Errorf("Expected decoded body for a client refusing gzip, got encoding %q", rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestProxy_CacheGzipRangeServedDecoded(t *testing.T) {
+	body := strings.Repeat("0123456789", 200)
+	upstream := textServer(body)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheGzipMinSize = 1024
+	handler := newTestProxy(t, cfg)
+
+	proxyGet(handler, upstream.URL)
+
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=5-14")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status 206, got %d", rec.Code)
+	}
+	if rec.Body.String() != "5678901234" {
+		t.Errorf("Expected range 5678901234, got %q", rec.Body.String())
+	}
+}
+
+func TestProxy_CacheGzipSkipsSmallBodies(t *testing.T) {
+	upstream := textServer("short")
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheGzipMinSize = 1024
+	c := cache.NewLRUCache(cfg.CacheSize)
+	handler := newTestProxyWithCache(t, cfg, c)
+
+	proxyGet(handler, upstream.URL)
+	if storedResponse(t, c).BodyGzipped {
+		t.Errorf("Expected a body below the minimum size to be stored as is")
+	}
+}
@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"fmt"
+	"strings"
 	"github.com/Jovial-Kanwadia/proxy-server/cache"
 )
 
@@ -413,4 +417,488 @@ func BenchmarkLRUCache_MixedOperations(b *testing.B) {
 			c.Remove(key)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestLRUCache_SoftClear(t *testing.T) {
+	c := cache.NewLRUCache(200)
+	window := 10 * time.Second
+
+	for i := 0; i < 200; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+	}
+
+	start := time.Now()
+	c.SoftClear(window)
+
+	// Items should still be served but now expire within the window, spread
+	// across all of it rather than synchronized
+	buckets := make([]int, 10)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		item, found := c.Peek(key)
+		if !found {
+			// Drew an offset shorter than the time taken to get here
+			if elapsed := time.Since(start); elapsed > window/10 {
+				t.Fatalf("Expected to find %s after soft clear", key)
+			}
+			buckets[0]++
+			continue
+		}
+		offset := item.ExpiresAt.Sub(start)
+		if offset < 0 || offset > window+time.Second {
+			t.Errorf("Expected %s to expire within the window, got %v", key, offset)
+			continue
+		}
+		buckets[min(int(offset*time.Duration(len(buckets))/window), len(buckets)-1)]++
+	}
+
+	for i, count := range buckets {
+		if count == 0 {
+			t.Errorf("Expected expirations in every tenth of the window, none in %v-%v", window*time.Duration(i)/10, window*time.Duration(i+1)/10)
+		}
+	}
+}
+
+func TestLRUCache_Watermarks(t *testing.T) {
+	c := cache.NewLRUCacheWithOptions(cache.LRUOptions{Capacity: 10, HighWatermark: 1, LowWatermark: 0.5})
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+	}
+	if c.Size() != 10 {
+		t.Errorf("Expected size 10 at the high watermark, got %d", c.Size())
+	}
+
+	// Crossing the high watermark evicts down to the low watermark in one pass
+	c.Set("key10", []byte("value"), 0)
+	if c.Size() != 5 {
+		t.Errorf("Expected size 5 after batch eviction, got %d", c.Size())
+	}
+	stats := c.Stats()
+	if stats.EvictionRuns != 1 {
+		t.Errorf("Expected 1 eviction run, got %d", stats.EvictionRuns)
+	}
+	if stats.Evictions != 6 {
+		t.Errorf("Expected 6 evictions, got %d", stats.Evictions)
+	}
+
+	// The most recently used items survive
+	for i := 6; i <= 10; i++ {
+		if _, found := c.Get(fmt.Sprintf("key%d", i)); !found {
+			t.Errorf("Expected to find key%d", i)
+		}
+	}
+}
+
+func TestLRUCache_WatermarksOnSmallCache(t *testing.T) {
+	// 20% of 3 items would truncate to an empty cache
+	c := cache.NewLRUCacheWithOptions(cache.LRUOptions{Capacity: 3, HighWatermark: 1, LowWatermark: 0.2})
+
+	for i := 0; i < 4; i++ {
+		if !c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0) {
+			t.Errorf("Expected key%d to be added", i)
+		}
+	}
+	if c.Size() != 1 {
+		t.Errorf("Expected size 1 after batch eviction, got %d", c.Size())
+	}
+	if _, found := c.Get("key3"); !found {
+		t.Errorf("Expected the item just inserted to survive batch eviction")
+	}
+
+	// 90% of 3 items rounds up to the full capacity
+	c = cache.NewLRUCacheWithOptions(cache.LRUOptions{Capacity: 3, HighWatermark: 0.9, LowWatermark: 0.9})
+	for i := 0; i < 3; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+	}
+	if c.Size() != 3 {
+		t.Errorf("Expected size 3 at a rounded high watermark, got %d", c.Size())
+	}
+}
+
+func benchmarkLRUCacheChurn(b *testing.B, high, low float64) {
+	c := cache.NewLRUCacheWithOptions(cache.LRUOptions{Capacity: 1000, HighWatermark: high, LowWatermark: low})
+	value := []byte("value")
+
+	b.ResetTimer()
+
+	// Steady insert pressure right at the capacity boundary
+	for i := 0; i < b.N; i++ {
+		c.Set(fmt.Sprintf("key%d", i), value, 0)
+	}
+
+	b.ReportMetric(float64(c.Stats().EvictionRuns)/float64(b.N), "eviction-runs/op")
+}
+
+func BenchmarkLRUCache_ChurnSingleEviction(b *testing.B) {
+	benchmarkLRUCacheChurn(b, 1, 1)
+}
+
+func BenchmarkLRUCache_ChurnWatermarks(b *testing.B) {
+	benchmarkLRUCacheChurn(b, 1, 0.9)
+}
+
+func TestLRUCache_MaxBytes(t *testing.T) {
+	c := cache.NewLRUCacheWithBytes(10, 10)
+
+	c.Set("key1", []byte("aaaa"), 0)
+	c.Set("key2", []byte("bbbb"), 0)
+
+	// The third value pushes the total past 10 bytes, evicting the oldest
+	c.Set("key3", []byte("cccc"), 0)
+	if _, found := c.Get("key1"); found {
+		t.Error("Expected key1 to be evicted by the byte limit")
+	}
+	if c.Size() != 2 {
+		t.Errorf("Expected size 2, got %d", c.Size())
+	}
+
+	// Growing an existing value evicts others to make room
+	c.Set("key3", []byte("cccccccc"), 0)
+	if _, found := c.Get("key2"); found {
+		t.Error("Expected key2 to be evicted when key3 grew")
+	}
+	if _, found := c.Get("key3"); !found {
+		t.Error("Expected to find key3")
+	}
+
+	if stats := c.Stats(); stats.MaxBytes != 10 {
+		t.Errorf("Expected max bytes 10, got %d", stats.MaxBytes)
+	}
+}
+
+func TestLRUCache_MaxBytesRejectsOversizedValue(t *testing.T) {
+	c := cache.NewLRUCacheWithBytes(10, 10)
+	c.Set("small", []byte("tiny"), 0)
+	c.Set("big", []byte("tiny"), 0)
+
+	if c.Set("big", []byte("way too large"), 0) {
+		t.Error("Expected oversized value to be rejected")
+	}
+	if _, found := c.Get("big"); found {
+		t.Error("Expected stale value for an oversized update to be dropped")
+	}
+	if _, found := c.Get("small"); !found {
+		t.Error("Expected other items to survive an oversized value")
+	}
+}
+
+func TestLRUCache_Sweep(t *testing.T) {
+	c := cache.NewLRUCacheWithSweep(10, 10*time.Millisecond)
+	defer c.Close()
+
+	c.Set("short", []byte("value"), 20*time.Millisecond)
+	c.Set("long", []byte("value"), time.Hour)
+
+	// Expired items disappear without being read
+	deadline := time.Now().Add(time.Second)
+	for c.Size() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected size 1 after sweep, got %d", c.Size())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, found := c.Get("long"); !found {
+		t.Error("Expected unexpired item to survive the sweep")
+	}
+
+	// Once closed, the sweeper no longer removes anything
+	c.Close()
+	c.Set("closed", []byte("value"), 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if c.Size() != 2 {
+		t.Errorf("Expected size 2 after Close stopped the sweeper, got %d", c.Size())
+	}
+
+	// Closing twice must not panic
+	c.Close()
+}
+
+func TestLRUCache_Keys(t *testing.T) {
+	c := cache.NewLRUCache(10)
+	c.Set("key1", []byte("value"), 0)
+	c.Set("key2", []byte("value"), 0)
+	c.Set("expired", []byte("value"), time.Nanosecond)
+	c.Set("key3", []byte("value"), 0)
+	time.Sleep(time.Millisecond)
+
+	// Reading key1 makes it the most recently used
+	c.Get("key1")
+
+	keys := c.Keys()
+	expected := []string{"key1", "key3", "key2"}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("Expected keys %v, got %v", expected, keys)
+			break
+		}
+	}
+}
+
+func TestLRUCache_RemoveMatching(t *testing.T) {
+	c := cache.NewLRUCache(10)
+	c.Set("GET:http://a.example.com/one", []byte("value"), 0)
+	c.Set("GET:http://a.example.com/two", []byte("value"), 0)
+	c.Set("GET:http://b.example.com/one", []byte("value"), 0)
+
+	removed := c.RemoveMatching(func(key string) bool {
+		return strings.Contains(key, "://a.example.com/")
+	})
+	if removed != 2 {
+		t.Errorf("Expected 2 items removed, got %d", removed)
+	}
+	if c.Size() != 1 {
+		t.Errorf("Expected size 1, got %d", c.Size())
+	}
+	if _, found := c.Get("GET:http://b.example.com/one"); !found {
+		t.Error("Expected non-matching item to survive")
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 2 {
+		t.Errorf("Expected 2 evictions, got %d", stats.Evictions)
+	}
+	if stats.AvgSize != len("value") {
+		t.Errorf("Expected average size %d, got %d", len("value"), stats.AvgSize)
+	}
+}
+
+func TestLRUCache_Peek(t *testing.T) {
+	c := cache.NewLRUCache(2)
+	c.Set("key1", []byte("value1"), 0)
+	c.Set("key2", []byte("value2"), 0)
+
+	item, found := c.Peek("key1")
+	if !found || string(item.Value) != "value1" {
+		t.Errorf("Expected to peek value1, got %v", item)
+	}
+	if _, found := c.Peek("missing"); found {
+		t.Error("Expected missing key not to be found")
+	}
+
+	// Peeking doesn't promote key1, so it is still evicted first
+	c.Set("key3", []byte("value3"), 0)
+	if _, found := c.Peek("key1"); found {
+		t.Error("Expected key1 to be evicted despite being peeked")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Expected no hits or misses, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+}
+
+func TestLRUCache_ResetStats(t *testing.T) {
+	c := cache.NewLRUCache(1)
+	c.Set("key1", []byte("value"), 0)
+	c.Get("key1")
+	c.Get("missing")
+	c.Set("key2", []byte("value"), 0)
+
+	c.ResetStats()
+	stats := c.Stats()
+	if stats.Hits != 0 || stats.Misses != 0 || stats.Evictions != 0 {
+		t.Errorf("Expected zeroed counters, got %d hits, %d misses and %d evictions", stats.Hits, stats.Misses, stats.Evictions)
+	}
+	if stats.Size != 1 {
+		t.Errorf("Expected items to be kept, got size %d", stats.Size)
+	}
+
+	// Resetting while readers are active never leaves a negative count
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			c.Get("key2")
+			c.Get("missing")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.ResetStats()
+	}
+	<-done
+
+	stats = c.Stats()
+	if stats.Hits < 0 || stats.Misses < 0 {
+		t.Errorf("Expected non-negative counters, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if stats.HitRate < 0 || stats.HitRate > 1 {
+		t.Errorf("Expected hit rate between 0 and 1, got %f", stats.HitRate)
+	}
+}
+
+func TestLRUCache_GetOrSetSingleFlight(t *testing.T) {
+	c := cache.NewLRUCache(10)
+
+	var fills atomic.Int32
+	release := make(chan struct{})
+	fill := func() ([]byte, error) {
+		fills.Add(1)
+		<-release
+		return []byte("value"), nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := c.GetOrSet("key", time.Minute, fill)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			results <- string(item.Value)
+		}()
+	}
+
+	// Give every caller time to pile up behind the first fill
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if fills.Load() != 1 {
+		t.Errorf("Expected 1 fill, got %d", fills.Load())
+	}
+	for value := range results {
+		if value != "value" {
+			t.Errorf("Expected value, got %s", value)
+		}
+	}
+	if item, found := c.Peek("key"); !found || string(item.Value) != "value" {
+		t.Error("Expected filled value to be cached")
+	}
+}
+
+func TestLRUCache_GetOrSetFailedFill(t *testing.T) {
+	c := cache.NewLRUCache(10)
+
+	_, err := c.GetOrSet("key", time.Minute, func() ([]byte, error) {
+		return nil, errors.New("upstream down")
+	})
+	if err == nil {
+		t.Error("Expected fill error to be returned")
+	}
+	if _, found := c.Peek("key"); found {
+		t.Error("Expected nothing to be cached after a failed fill")
+	}
+
+	// The failure doesn't stick to the key
+	item, err := c.GetOrSet("key", time.Minute, func() ([]byte, error) {
+		return []byte("value"), nil
+	})
+	if err != nil || string(item.Value) != "value" {
+		t.Errorf("Expected retry to succeed, got %v, %v", item, err)
+	}
+}
+
+func TestLRUCache_FrequentlyReadItemSurvivesChurn(t *testing.T) {
+	c := cache.NewLRUCache(100)
+	c.Set("hot", []byte("value"), 0)
+
+	// Reads near the front skip reordering, but must still keep the item
+	// away from the back of the list
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+		if i%10 == 0 {
+			if _, found := c.Get("hot"); !found {
+				t.Fatalf("Expected hot item to survive after %d inserts", i)
+			}
+		}
+	}
+	if c.Size() != 100 {
+		t.Errorf("Expected 100 items, got %d", c.Size())
+	}
+}
+
+func TestLRUCache_ConcurrentHitsCounted(t *testing.T) {
+	c := cache.NewLRUCache(100)
+	c.Set("key", []byte("value"), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Get("key")
+				c.Get("missing")
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Hits != 800 || stats.Misses != 800 {
+		t.Errorf("Expected 800 hits and 800 misses, got %d and %d", stats.Hits, stats.Misses)
+	}
+}
+
+func BenchmarkLRUCache_ParallelGet(b *testing.B) {
+	c := cache.NewLRUCache(1000)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		c.Set(keys[i], []byte("value"), 0)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func TestLRUCache_OnEvictReasons(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[string]cache.EvictReason)
+
+	var c *cache.LRUCache
+	c = cache.NewLRUCacheWithOptions(cache.LRUOptions{
+		Capacity: 2,
+		OnEvict: func(key string, item *cache.CacheItem, reason cache.EvictReason) {
+			// Runs outside the lock, so using the cache must not deadlock
+			c.Size()
+
+			mu.Lock()
+			defer mu.Unlock()
+			reasons[key] = reason
+		},
+	})
+
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Set("c", []byte("3"), 0) // Evicts a
+	c.Set("b", []byte("4"), 0) // Replacing is not an eviction
+	c.Set("d", []byte("5"), time.Millisecond)
+	c.Remove("b")
+	time.Sleep(5 * time.Millisecond)
+	c.RemoveExpired()
+	c.Set("e", []byte("6"), 0)
+	c.Clear()
+
+	expected := map[string]cache.EvictReason{
+		"a": cache.EvictCapacity,
+		"b": cache.EvictManual,
+		"c": cache.EvictCapacity,
+		"d": cache.EvictTTL,
+		"e": cache.EvictManual,
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != len(expected) {
+		t.Errorf("Expected %d evictions, got %d: %v", len(expected), len(reasons), reasons)
+	}
+	for key, reason := range expected {
+		if reasons[key] != reason {
+			t.Errorf("Expected %s to be evicted for %s, got %s", key, reason, reasons[key])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestCachedResponse_RoundTripsArbitraryContent(t *testing.T) {
+	original := &proxy.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"X-Json":     {`{"a": "b", "c": "d"}`},
+			"X-Folded":   {"line one\r\nX-Injected: value\r\n\r\nline two"},
+			"Set-Cookie": {"a=1", "b=2"},
+		},
+		Body: []byte("before\r\n\r\nafter: still body\r\n"),
+	}
+
+	data, err := proxy.EncodeCachedResponse(original)
+	if err != nil {
+		t.Fatalf("Expected encoding to succeed: %v", err)
+	}
+	decoded, err := proxy.DecodeCachedResponse(data)
+	if err != nil {
+		t.Fatalf("Expected decoding to succeed: %v", err)
+	}
+
+	if decoded.StatusCode != original.StatusCode {
+		t.Errorf("Expected status %d, got %d", original.StatusCode, decoded.StatusCode)
+	}
+	if string(decoded.Body) != string(original.Body) {
+		t.Errorf("Expected body %q, got %q", original.Body, decoded.Body)
+	}
+	for key, values := range original.Header {
+		got := decoded.Header.Values(key)
+		if len(got) != len(values) {
+			t.Errorf("Expected %d values for %s, got %v", len(values), key, got)
+			continue
+		}
+		for i := range values {
+			if got[i] != values[i] {
+				t.Errorf("Expected %s value %q, got %q", key, values[i], got[i])
+			}
+		}
+	}
+	if decoded.Header.Get("X-Injected") != "" {
+		t.Error("Expected no header to be injected by a folded value")
+	}
+}
+
+func TestCachedResponse_RejectsGarbage(t *testing.T) {
+	if _, err := proxy.DecodeCachedResponse([]byte("200\r\nContent-Type: text/plain\r\n\r\nbody")); err == nil {
+		t.Error("Expected an error for data in an unknown format")
+	}
+}
+
+func TestProxy_CachedBodyWithHeaderDelimiter(t *testing.T) {
+	body := "first\r\n\r\nsecond: part\r\n\r\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Colons", "a: b: c")
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected HIT, got %s", rec.Header().Get("X-Cache"))
+	}
+	if rec.Body.String() != body {
+		t.Errorf("Expected body %q, got %q", body, rec.Body.String())
+	}
+	if rec.Header().Get("X-Colons") != "a: b: c" {
+		t.Errorf("Expected X-Colons to survive, got %q", rec.Header().Get("X-Colons"))
+	}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestProxy_ClientDisconnectCancelsUpstream(t *testing.T) {
+	received := make(chan struct{})
+	upstreamErr := make(chan error, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		select {
+		case <-r.Context().Done():
+			upstreamErr <- r.Context().Err()
+		case <-time.After(5 * time.Second):
+			upstreamErr <- nil
+		}
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	// Disconnect once the upstream is working on the request
+	<-received
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the proxy to return after the client disconnected")
+	}
+
+	select {
+	case err := <-upstreamErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the upstream call to end with context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the upstream call to be canceled")
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// checksumProxy returns a proxy verifying JSON bodies and an upstream
+// recording the bodies it received
+func checksumProxy(t *testing.T, received *[]string) (http.Handler, string) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*received = append(*received, string(body))
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.NewDefaultConfig()
+	cfg.VerifyBodyChecksum = true
+	cfg.ChecksumContentTypes = []string{"application/json"}
+	return newTestProxy(t, cfg), upstream.URL
+}
+
+// postWithHeader sends a JSON body through the proxy with one extra header
+func postWithHeader(handler http.Handler, target, body, name, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(target), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(name, value)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChecksum_MatchingDigestsForwarded(t *testing.T) {
+	var received []string
+	handler, target := checksumProxy(t, &received)
+	body := `{"upload":"data"}`
+
+	sha := sha256.Sum256([]byte(body))
+	if rec := postWithHeader(handler, target, body, "Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sha[:])); rec.Code != http.StatusOK {
+		t.Errorf("Expected matching SHA-256 digest to pass, got %d", rec.Code)
+	}
+
+	sum := md5.Sum([]byte(body))
+	if rec := postWithHeader(handler, target, body, "Content-MD5", base64.StdEncoding.EncodeToString(sum[:])); rec.Code != http.StatusOK {
+		t.Errorf("Expected matching Content-MD5 to pass, got %d", rec.Code)
+	}
+
+	if len(received) != 2 || received[0] != body || received[1] != body {
+		t.Errorf("Expected upstream to receive both bodies intact, got %v", received)
+	}
+}
+
+func TestChecksum_MismatchRejected(t *testing.T) {
+	var received []string
+	handler, target := checksumProxy(t, &received)
+
+	sha := sha256.Sum256([]byte("original"))
+	if rec := postWithHeader(handler, target, "corrupted", "Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sha[:])); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected mismatching SHA-256 digest to be rejected, got %d", rec.Code)
+	}
+
+	sum := md5.Sum([]byte("original"))
+	if rec := postWithHeader(handler, target, "corrupted", "Digest", "MD5="+base64.StdEncoding.EncodeToString(sum[:])); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected mismatching MD5 digest to be rejected, got %d", rec.Code)
+	}
+
+	if len(received) != 0 {
+		t.Errorf("Expected upstream never to see corrupted bodies, got %v", received)
+	}
+}
+
+func TestChecksum_OversizedBodyRejected(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.VerifyBodyChecksum = true
+	cfg.ChecksumMaxBytes = 16
+	handler := newTestProxy(t, cfg)
+
+	body := strings.Repeat("x", 32)
+	sha := sha256.Sum256([]byte(body))
+	digest := "SHA-256=" + base64.StdEncoding.EncodeToString(sha[:])
+
+	if rec := postWithHeader(handler, upstream.URL, body, "Digest", digest); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a declared length over the limit, got %d", rec.Code)
+	}
+
+	// Without a declared length the limit applies while reading
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(upstream.URL), strings.NewReader(body))
+	req.ContentLength = -1
+	req.Header.Set("Digest", digest)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a streamed body over the limit, got %d", rec.Code)
+	}
+
+	if len(received) != 0 {
+		t.Errorf("Expected upstream never to see oversized bodies, got %v", received)
+	}
+
+	// Bodies within the limit are still verified and forwarded
+	small := "within limit"
+	sha = sha256.Sum256([]byte(small))
+	if rec := postWithHeader(handler, upstream.URL, small, "Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sha[:])); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 within the limit, got %d", rec.Code)
+	}
+	if len(received) != 1 || received[0] != small {
+		t.Errorf("Expected upstream to receive the small body intact, got %v", received)
+	}
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+var compressionAlgorithms = []cache.Compression{
+	cache.CompressionNone,
+	cache.CompressionGzip,
+	cache.CompressionZstd,
+	cache.CompressionLZ4,
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	values := [][]byte{
+		[]byte("200\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("hello world ", 500)),
+		{},
+		{0x00, 0x01, 0x02}, // Looks like a marker and must survive uncompressed
+	}
+
+	for _, algo := range compressionAlgorithms {
+		for _, value := range values {
+			compressed, err := cache.Compress(value, algo)
+			if err != nil {
+				t.Fatalf("Expected %s compression to succeed, got %v", algo, err)
+			}
+			decompressed, err := cache.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("Expected %s decompression to succeed, got %v", algo, err)
+			}
+			if !bytes.Equal(decompressed, value) {
+				t.Errorf("Expected %s round trip to return %q, got %q", algo, value, decompressed)
+			}
+		}
+	}
+}
+
+func TestCompression_MixedEntriesDecode(t *testing.T) {
+	c := cache.NewLRUCache(10)
+	value := []byte(strings.Repeat("cached body ", 100))
+
+	// A legacy entry stored before compression existed carries no marker
+	c.Set("legacy", value, 0)
+	for _, algo := range compressionAlgorithms {
+		compressed, err := cache.Compress(value, algo)
+		if err != nil {
+			t.Fatalf("Expected %s compression to succeed, got %v", algo, err)
+		}
+		c.Set(algo.String(), compressed, 0)
+	}
+
+	for _, key := range []string{"legacy", "none", "gzip", "zstd", "lz4"} {
+		item, found := c.Get(key)
+		if !found {
+			t.Fatalf("Expected %s entry to be found", key)
+		}
+		decompressed, err := cache.Decompress(item.Value)
+		if err != nil {
+			t.Errorf("Expected %s entry to decode, got %v", key, err)
+		} else if !bytes.Equal(decompressed, value) {
+			t.Errorf("Expected %s entry to decode to original value", key)
+		}
+	}
+}
+
+func TestCompression_ParseUnknownAlgorithm(t *testing.T) {
+	if _, err := cache.ParseCompression("brotli"); err == nil {
+		t.Error("Expected error for unknown compression algorithm")
+	}
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheCompression = "brotli"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for unknown compression algorithm")
+	}
+}
+
+func TestProxy_CacheEntriesSurviveCompressionChange(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	shared := cache.NewLRUCache(10)
+
+	// Populate the cache with zstd entries
+	cfg := config.NewDefaultConfig()
+	cfg.CacheCompression = "zstd"
+	if rec := proxyGet(newTestProxyWithCache(t, cfg, shared), upstream.URL); rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("Expected first request to miss, got %s", rec.Header().Get("X-Cache"))
+	}
+
+	// A proxy configured for another algorithm still serves them
+	cfg = config.NewDefaultConfig()
+	cfg.CacheCompression = "lz4"
+	rec := proxyGet(newTestProxyWithCache(t, cfg, shared), upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected cache HIT after compression change, got %s", rec.Header().Get("X-Cache"))
+	}
+	if rec.Body.String() != "content" {
+		t.Errorf("Expected cached body, got %q", rec.Body.String())
+	}
+}
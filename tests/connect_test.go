@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// echoTCPServer accepts connections and echoes back whatever it receives
+func echoTCPServer(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+// dialConnect sends a CONNECT request for the target through the proxy server
+func dialConnect(t *testing.T, proxyURL, target string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyURL[len("http://"):])
+	if err != nil {
+		t.Fatalf("Expected to connect to proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("Expected CONNECT response: %v", err)
+	}
+	return conn, reader, resp
+}
+
+func TestConnect_TunnelsBytes(t *testing.T) {
+	target := echoTCPServer(t)
+
+	cfg := config.NewDefaultConfig()
+	server := httptest.NewServer(proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg))
+	defer server.Close()
+
+	conn, reader, resp := dialConnect(t, server.URL, target.Addr().String())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	conn.Write([]byte("ping"))
+	echoed := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echoed); err != nil {
+		t.Fatalf("Expected echoed data: %v", err)
+	}
+	if string(echoed) != "ping" {
+		t.Errorf("Expected ping to be echoed, got %q", echoed)
+	}
+}
+
+func TestConnect_RespectsAllowedDomains(t *testing.T) {
+	target := echoTCPServer(t)
+
+	cfg := config.NewDefaultConfig()
+	cfg.AllowedDomains = []string{"example.com"}
+	server := httptest.NewServer(newTestProxy(t, cfg))
+	defer server.Close()
+
+	if _, _, resp := dialConnect(t, server.URL, target.Addr().String()); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestConnect_RespectsBlockedDomains(t *testing.T) {
+	target := echoTCPServer(t)
+
+	cfg := config.NewDefaultConfig()
+	cfg.BlockedDomains = []string{"127.0.0.1"}
+	server := httptest.NewServer(newTestProxy(t, cfg))
+	defer server.Close()
+
+	if _, _, resp := dialConnect(t, server.URL, target.Addr().String()); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestConnect_UnreachableTarget(t *testing.T) {
+	// Grab a free port and close it again so nothing is listening
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	server := httptest.NewServer(newTestProxy(t, nil))
+	defer server.Close()
+
+	if _, _, resp := dialConnect(t, server.URL, address); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", resp.StatusCode)
+	}
+}
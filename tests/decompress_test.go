@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// gzipBytes compresses data with gzip
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Error compressing body: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// postThroughProxy posts a gzip-encoded body for upstream through a chain
+// decompressing requests up to maxBytes
+func postThroughProxy(t *testing.T, upstream string, body []byte, maxBytes int64) *httptest.ResponseRecorder {
+	cfg := config.NewDefaultConfig()
+	cfg.DecompressRequests = true
+	cfg.MaxDecompressedBytes = maxBytes
+	handler := proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(upstream), bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDecompressRequests_ForwardsPlaintext(t *testing.T) {
+	var gotBody, gotEncoding string
+	var gotLength int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gotLength = r.ContentLength
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	payload := strings.Repeat("hello upstream ", 100)
+	rec := postThroughProxy(t, upstream.URL, gzipBytes(t, payload), 0)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if gotBody != payload {
+		t.Errorf("Expected upstream to receive the plaintext body, got %q", gotBody)
+	}
+	if gotEncoding != "" {
+		t.Errorf("Expected no Content-Encoding upstream, got %q", gotEncoding)
+	}
+	if gotLength != int64(len(payload)) {
+		t.Errorf("Expected Content-Length %d, got %d", len(payload), gotLength)
+	}
+}
+
+func TestDecompressRequests_RejectsMalformedBody(t *testing.T) {
+	rec := postThroughProxy(t, "http://127.0.0.1:1/", []byte("not gzip"), 0)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestDecompressRequests_RejectsOversizedBody(t *testing.T) {
+	rec := postThroughProxy(t, "http://127.0.0.1:1/", gzipBytes(t, strings.Repeat("a", 2048)), 1024)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// proxyPost sends a POST request with an Idempotency-Key through the proxy handler
+func proxyPost(handler http.Handler, target, idempotencyKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(target), strings.NewReader("payload"))
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDedup_RetryMidFlightSharesResult(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.DedupInFlight = true
+	handler := newTestProxy(t, cfg)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+
+	// Original request reaches the upstream and stalls there
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = proxyPost(handler, upstream.URL, "order-1")
+	}()
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&calls) == 1 })
+
+	// The client retries while the original is still in flight
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = proxyPost(handler, upstream.URL, "order-1")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected a single upstream call, got %d", n)
+	}
+	for i, rec := range results {
+		if rec.Code != http.StatusOK || rec.Body.String() != "created" {
+			t.Errorf("Expected request %d to get 200 created, got %d %q", i, rec.Code, rec.Body.String())
+		}
+	}
+	if results[1].Header().Get("X-Deduplicated") != "true" {
+		t.Error("Expected the retry to share the in-flight result")
+	}
+}
+
+func TestDedup_FailedInFlightDoesNotPoisonWaiters(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// First call fails after the retry has started waiting on it
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.DedupInFlight = true
+	handler := newTestProxy(t, cfg)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = proxyPost(handler, upstream.URL, "order-2")
+	}()
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&calls) == 1 })
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = proxyPost(handler, upstream.URL, "order-2")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	if results[0].Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected original request to fail with 503, got %d", results[0].Code)
+	}
+
+	// The waiting retry makes its own upstream call instead of inheriting the failure
+	if results[1].Code != http.StatusOK || results[1].Body.String() != "created" {
+		t.Errorf("Expected retry to succeed on its own, got %d %q", results[1].Code, results[1].Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", n)
+	}
+}
+
+// stalledServer answers every request with the given Cache-Control once
+// release is closed, counting the calls it receives
+func stalledServer(cacheControl string, calls *int32, release chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Write([]byte("popular"))
+	}))
+}
+
+func TestDedup_CollapsesConcurrentCacheMisses(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	upstream := stalledServer("max-age=60", &calls, release)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CollapseCacheMisses = true
+	handler := newTestProxy(t, cfg)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = proxyGet(handler, upstream.URL)
+		}(i)
+	}
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&calls) == 1 })
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", n)
+	}
+	for i, rec := range results {
+		if rec.Code != http.StatusOK || rec.Body.String() != "popular" {
+			t.Errorf("Expected request %d to get the shared response, got %d %q", i, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDedup_UncacheableMissNotShared(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	upstream := stalledServer("no-store", &calls, release)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CollapseCacheMisses = true
+	handler := newTestProxy(t, cfg)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = proxyGet(handler, upstream.URL)
+	}()
+	waitFor(t, time.Second, func() bool { return atomic.LoadInt32(&calls) == 1 })
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = proxyGet(handler, upstream.URL)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	wg.Wait()
+
+	// A response kept out of the cache is only for the client that asked for it
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", n)
+	}
+	if results[1].Header().Get("X-Deduplicated") != "" {
+		t.Error("Expected uncacheable response not to be shared")
+	}
+}
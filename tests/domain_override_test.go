@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_DomainOverrideTTL(t *testing.T) {
+	// No freshness information, so the default TTL applies
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.DomainOverrides = []config.DomainOverride{
+		{Domain: "example.com", TTL: 5},
+		{Domain: "127.0.0.1", TTL: 10},
+	}
+	c := cache.NewLRUCache(10)
+	proxyGet(newTestProxyWithCache(t, cfg, c), upstream.URL)
+
+	item, found := c.Peek("GET:" + upstream.URL + "/")
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if ttl := item.ExpiresAt.Sub(item.CreatedAt).Round(time.Second); ttl != 10*time.Second {
+		t.Errorf("Expected the override's TTL of 10s, got %v", ttl)
+	}
+}
+
+func TestProxy_DomainOverrideNoCache(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.DomainOverrides = []config.DomainOverride{{Domain: "127.0.0.1", NoCache: true}}
+	handler := newTestProxy(t, cfg)
+
+	proxyGet(handler, upstream.URL)
+	rec := proxyGet(handler, upstream.URL)
+
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected cache miss for an uncached domain, got %s", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestProxy_DomainOverrideMaxBodyBytes(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.DomainOverrides = []config.DomainOverride{{Domain: "127.0.0.1", MaxBodyBytes: 4}}
+	handler := newTestProxy(t, cfg)
+
+	proxyGet(handler, upstream.URL)
+	rec := proxyGet(handler, upstream.URL)
+
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected body above the override's limit not to be cached, got %s", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestDomainOverride_Matches(t *testing.T) {
+	override := config.DomainOverride{Domain: "example.com"}
+
+	tests := []struct {
+		host    string
+		matches bool
+	}{
+		{"example.com", true},
+		{"api.example.com", true},
+		{"API.Example.com", true},
+		{"badexample.com", false},
+		{"example.org", false},
+		{"com", false},
+	}
+
+	for _, tt := range tests {
+		if got := override.Matches(tt.host); got != tt.matches {
+			t.Errorf("Expected Matches(%q) to be %v, got %v", tt.host, tt.matches, got)
+		}
+	}
+}
+
+func TestDomainOverride_ParseFlag(t *testing.T) {
+	override, err := config.ParseDomainOverride("example.com:ttl=10,no_cache,max_body_bytes=2048")
+	if err != nil {
+		t.Fatalf("Expected override to parse, got %v", err)
+	}
+	if override.Domain != "example.com" || override.TTL != 10 || !override.NoCache || override.MaxBodyBytes != 2048 {
+		t.Errorf("Expected all settings to be parsed, got %+v", override)
+	}
+
+	if override, err := config.ParseDomainOverride("example.com"); err != nil || override.Domain != "example.com" {
+		t.Errorf("Expected a bare domain to parse, got %+v, %v", override, err)
+	}
+
+	for _, value := range []string{"", ":ttl=10", "example.com:ttl=abc", "example.com:bogus"} {
+		if _, err := config.ParseDomainOverride(value); err == nil {
+			t.Errorf("Expected error parsing %q", value)
+		}
+	}
+}
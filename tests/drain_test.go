@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestDrain_InFlightReachesZero(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxyGet(handler, upstream.URL)
+		}()
+	}
+	waitFor(t, time.Second, func() bool { return handler.InFlight() == 3 })
+
+	// The drain gives up while requests are still stuck upstream
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := handler.Drain(ctx, 10*time.Millisecond); err == nil {
+		t.Error("Expected drain to report remaining requests at the deadline")
+	}
+
+	// Once they complete the counter drops to zero and the drain finishes
+	close(release)
+	if err := handler.Drain(context.Background(), 10*time.Millisecond); err != nil {
+		t.Errorf("Expected drain to complete, got %v", err)
+	}
+	if n := handler.InFlight(); n != 0 {
+		t.Errorf("Expected 0 requests in flight, got %d", n)
+	}
+	wg.Wait()
+}
+
+func TestShutdownServer_CompletesInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("complete"))
+	}))
+	defer upstream.Close()
+
+	handler := proxy.NewProxyHandler(cache.NewLRUCache(100), config.NewDefaultConfig())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected to listen, got %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	proxyURL := "http://" + listener.Addr().String() + "/?url=" + url.QueryEscape(upstream.URL)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	results := make(chan result, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			resp, err := http.Get(proxyURL)
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			results <- result{status: resp.StatusCode, body: string(body), err: err}
+		}()
+	}
+	waitFor(t, time.Second, func() bool { return handler.InFlight() == 3 })
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- handler.ShutdownServer(ctx, server, time.Second)
+	}()
+
+	// New connections are refused while the requests in flight carry on
+	waitFor(t, time.Second, func() bool {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	})
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Expected shutdown to wait for requests in flight, got %v", err)
+	default:
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Errorf("Expected request to complete, got %v", r.err)
+		} else if r.status != http.StatusOK || r.body != "complete" {
+			t.Errorf("Expected 200 with body complete, got %d with %q", r.status, r.body)
+		}
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+	if n := handler.InFlight(); n != 0 {
+		t.Errorf("Expected 0 requests in flight, got %d", n)
+	}
+}
+
+func TestShutdownServer_StopsPoolAfterDeadline(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	handler := proxy.NewProxyHandler(cache.NewLRUCache(100), config.NewDefaultConfig())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected to listen, got %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+
+	go http.Get("http://" + listener.Addr().String() + "/?url=" + url.QueryEscape(upstream.URL))
+	waitFor(t, time.Second, func() bool { return handler.InFlight() == 1 })
+
+	// A stuck request can't hold up the shutdown past its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := handler.ShutdownServer(ctx, server, time.Second); err == nil {
+		t.Error("Expected shutdown to report the stuck request")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected shutdown to give up at the deadline, took %v", elapsed)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_HeaderRulesRewriteBothDirections(t *testing.T) {
+	upstream := newEchoUpstream(t, map[string]string{"Server": "upstream/1.2.3", "X-Internal": "secret"})
+
+	cfg := config.NewDefaultConfig()
+	cfg.HeaderRules = []config.HeaderRule{{
+		AddRequestHeaders:     map[string]string{"X-Api-Key": "injected"},
+		RemoveRequestHeaders:  []string{"X-Debug"},
+		AddResponseHeaders:    map[string]string{"X-Internal": "redacted"},
+		RemoveResponseHeaders: []string{"Server"},
+	}}
+	handler := newTestProxy(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("X-Api-Key", "from-client")
+	req.Header.Set("X-Debug", "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Seen-X-Api-Key"); got != "injected" {
+		t.Errorf("Expected upstream to see injected API key, got %q", got)
+	}
+	if got := rec.Header().Get("X-Seen-X-Debug"); got != "" {
+		t.Errorf("Expected X-Debug to be removed upstream, got %q", got)
+	}
+	if got := rec.Header().Get("Server"); got != "" {
+		t.Errorf("Expected Server header to be removed, got %q", got)
+	}
+	if got := rec.Header().Get("X-Internal"); got != "redacted" {
+		t.Errorf("Expected X-Internal to be overridden, got %q", got)
+	}
+
+	// Cache hits carry the rewritten headers too
+	rec = proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected cache hit, got %s", rec.Header().Get("X-Cache"))
+	}
+	if got := rec.Header().Get("Server"); got != "" {
+		t.Errorf("Expected Server header to be removed on hit, got %q", got)
+	}
+}
+
+func TestProxy_HeaderRulesScopedToDomain(t *testing.T) {
+	upstream := newEchoUpstream(t, map[string]string{"Server": "upstream/1.2.3", "X-Internal": "secret"})
+
+	cfg := config.NewDefaultConfig()
+	cfg.HeaderRules = []config.HeaderRule{{
+		Domain:                "example.com",
+		AddRequestHeaders:     map[string]string{"X-Api-Key": "injected"},
+		RemoveResponseHeaders: []string{"Server"},
+	}}
+	handler := newTestProxy(t, cfg)
+
+	rec := proxyGet(handler, upstream.URL)
+	if got := rec.Header().Get("X-Seen-X-Api-Key"); got != "" {
+		t.Errorf("Expected no API key for another domain, got %q", got)
+	}
+	if got := rec.Header().Get("Server"); got != "upstream/1.2.3" {
+		t.Errorf("Expected Server header to be kept for another domain, got %q", got)
+	}
+}
+
+func TestConfig_HeaderRulesValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.HeaderRules = []config.HeaderRule{{RemoveResponseHeaders: []string{"Bad Header"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for invalid header name")
+	}
+}
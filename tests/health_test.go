@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestHealth_ServedWithoutTarget(t *testing.T) {
+	handler := newTestProxy(t, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var body struct {
+		Status string `json:"status"`
+		Uptime *int64 `json:"uptime"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %q: %v", rec.Body.String(), err)
+	}
+	if body.Status != "ok" {
+		t.Errorf("Expected status ok, got %s", body.Status)
+	}
+	if body.Uptime == nil {
+		t.Errorf("Expected uptime in body, got %q", rec.Body.String())
+	}
+}
+
+func TestHealth_ConfigurablePath(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.HealthPath = "/live"
+	handler := newTestProxy(t, cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+
+	// The default path is a regular request again, which lacks a target
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestHealth_ReadinessFollowsWorkerPool(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	handler := proxy.NewProxyHandler(cache.NewLRUCache(10), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+
+	handler.Shutdown()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestIdleMap_RemovesIdleEntries(t *testing.T) {
+	m := proxy.NewIdleMap[int](50*time.Millisecond, 10*time.Millisecond)
+	defer m.Stop()
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		m.Update(ip, func(count *int, isNew bool) { *count++ })
+	}
+	if m.Len() != 3 {
+		t.Fatalf("Expected 3 entries, got %d", m.Len())
+	}
+
+	// Keep one client active while the others go idle
+	deadline := time.Now().Add(150 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		m.Update("192.0.2.1", func(count *int, isNew bool) { *count++ })
+		time.Sleep(5 * time.Millisecond)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Expected only the active entry to remain, got %d entries", m.Len())
+	}
+
+	// The surviving entry kept its state
+	m.Update("192.0.2.1", func(count *int, isNew bool) {
+		if isNew || *count < 2 {
+			t.Errorf("Expected existing entry with accumulated state, got new=%v count=%d", isNew, *count)
+		}
+	})
+
+	// Once it goes idle too, the map is empty
+	waitFor(t, time.Second, func() bool { return m.Len() == 0 })
+}
+
+func TestIdleMap_RecreatedEntryStartsFresh(t *testing.T) {
+	m := proxy.NewIdleMap[int](10*time.Millisecond, time.Hour)
+	defer m.Stop()
+
+	m.Update("192.0.2.1", func(count *int, isNew bool) { *count = 5 })
+	time.Sleep(20 * time.Millisecond)
+	m.Sweep()
+
+	m.Update("192.0.2.1", func(count *int, isNew bool) {
+		if !isNew || *count != 0 {
+			t.Errorf("Expected a fresh entry after eviction, got new=%v count=%d", isNew, *count)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// filterStatus sends a request from remoteAddr through the IP filter
+func filterStatus(filter proxy.Middleware, remoteAddr, forwardedFor string) int {
+	handler := filter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestIPFilter_AllowAndDeny(t *testing.T) {
+	filter := proxy.IPFilter(proxy.IPFilterOptions{
+		Allow: []string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32"},
+		Deny:  []string{"10.0.5.0/24", "2001:db8:bad::1"},
+	})
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.1.2.3:5000", http.StatusOK},
+		{"192.168.1.10:5000", http.StatusOK},
+		{"192.168.1.11:5000", http.StatusForbidden},
+		{"10.0.5.7:5000", http.StatusForbidden}, // Denied within an allowed range
+		{"[2001:db8::1]:5000", http.StatusOK},
+		{"[2001:db8:bad::1]:5000", http.StatusForbidden},
+		{"[2001:db9::1]:5000", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if got := filterStatus(filter, tt.remoteAddr, ""); got != tt.want {
+			t.Errorf("%s: Expected status %d, got %d", tt.remoteAddr, tt.want, got)
+		}
+	}
+}
+
+func TestIPFilter_DenyOnly(t *testing.T) {
+	filter := proxy.IPFilter(proxy.IPFilterOptions{Deny: []string{"203.0.113.0/24"}})
+
+	if got := filterStatus(filter, "203.0.113.9:5000", ""); got != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a denied client, got %d", got)
+	}
+	if got := filterStatus(filter, "198.51.100.1:5000", ""); got != http.StatusOK {
+		t.Errorf("Expected status 200 for another client, got %d", got)
+	}
+}
+
+func TestIPFilter_TrustedForwardedHeaders(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("10.0.0.1/32")
+	filter := proxy.IPFilter(proxy.IPFilterOptions{
+		Deny:              []string{"203.0.113.9"},
+		TrustProxyHeaders: true,
+		TrustedProxies:    []*net.IPNet{lb},
+	})
+
+	if got := filterStatus(filter, "10.0.0.1:5000", "203.0.113.9"); got != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a denied client behind a trusted proxy, got %d", got)
+	}
+	if got := filterStatus(filter, "10.0.0.2:5000", "203.0.113.9"); got != http.StatusOK {
+		t.Errorf("Expected untrusted peer's header to be ignored, got %d", got)
+	}
+}
+
+func TestConfig_ClientIPsValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.AllowedClientIPs = []string{"10.0.0.0/33"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for an invalid CIDR")
+	}
+}
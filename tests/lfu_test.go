@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+func TestLFUCache_EvictsLeastFrequent(t *testing.T) {
+	c := cache.NewCacheWithPolicy(3, cache.PolicyLFU)
+
+	c.Set("hot", []byte("value"), 0)
+	c.Set("warm", []byte("value"), 0)
+	c.Set("cold", []byte("value"), 0)
+	c.Get("hot")
+	c.Get("hot")
+	c.Get("warm")
+
+	// A long tail of new keys only displaces other rarely used entries
+	c.Set("tail1", []byte("value"), 0)
+	c.Set("tail2", []byte("value"), 0)
+
+	for _, key := range []string{"hot", "warm"} {
+		if _, found := c.Peek(key); !found {
+			t.Errorf("Expected %s to survive", key)
+		}
+	}
+	if _, found := c.Peek("cold"); found {
+		t.Error("Expected cold to be evicted")
+	}
+	if c.Size() != 3 {
+		t.Errorf("Expected size 3, got %d", c.Size())
+	}
+}
+
+func TestLFUCache_TiesBrokenByRecency(t *testing.T) {
+	c := cache.NewLFUCache(2)
+	c.Set("older", []byte("value"), 0)
+	c.Set("newer", []byte("value"), 0)
+
+	c.Set("third", []byte("value"), 0)
+	if _, found := c.Peek("older"); found {
+		t.Error("Expected the least recent of equally used items to be evicted")
+	}
+	if _, found := c.Peek("newer"); !found {
+		t.Error("Expected newer to survive")
+	}
+}
+
+func TestLFUCache_Stats(t *testing.T) {
+	c := cache.NewLFUCache(1)
+	c.Set("key1", []byte("value"), 0)
+	c.Get("key1")
+	c.Get("missing")
+	c.Set("key2", []byte("value"), 0)
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d and %d", stats.Hits, stats.Misses)
+	}
+	if stats.Evictions != 1 {
+		t.Errorf("Expected 1 eviction, got %d", stats.Evictions)
+	}
+	if stats.Size != 1 || stats.Capacity != 1 {
+		t.Errorf("Expected size 1 of capacity 1, got %d of %d", stats.Size, stats.Capacity)
+	}
+}
+
+func TestLFUCache_Keys(t *testing.T) {
+	c := cache.NewLFUCache(3)
+	c.Set("once", []byte("value"), 0)
+	c.Set("twice", []byte("value"), 0)
+	c.Get("twice")
+
+	keys := c.Keys()
+	if len(keys) != 2 || keys[0] != "twice" || keys[1] != "once" {
+		t.Errorf("Expected [twice once], got %v", keys)
+	}
+}
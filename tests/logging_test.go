@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// captureLogs sends log messages to a buffer at the given level for the test
+func captureLogs(t *testing.T, level logging.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	logging.SetLevel(level)
+	t.Cleanup(resetLogging)
+	return &buf
+}
+
+// resetLogging restores the default logging setup
+func resetLogging() {
+	logging.SetOutput(os.Stderr)
+	logging.SetLevel(logging.LevelInfo)
+	logging.SetFormat(logging.FormatText)
+}
+
+func TestLogging_WarnLevelSuppressesInfo(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.LogLevel = "warn"
+	level, ok := logging.ParseLevel(cfg.LogLevel)
+	if !ok {
+		t.Fatalf("Expected level %q to parse", cfg.LogLevel)
+	}
+	buf := captureLogs(t, level)
+
+	logging.Debugf("debug message")
+	logging.Infof("info message")
+	logging.Warnf("warn message")
+	logging.Errorf("error message")
+
+	output := buf.String()
+	for _, suppressed := range []string{"debug message", "info message"} {
+		if strings.Contains(output, suppressed) {
+			t.Errorf("Expected %q to be suppressed, got %q", suppressed, output)
+		}
+	}
+	for _, written := range []string{"WARN warn message", "ERROR error message"} {
+		if !strings.Contains(output, written) {
+			t.Errorf("Expected %q to be written, got %q", written, output)
+		}
+	}
+}
+
+func TestLogging_CacheLookupsAreDebug(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	buf := captureLogs(t, logging.LevelInfo)
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+	proxyGet(handler, upstream.URL)
+
+	if output := buf.String(); strings.Contains(output, "Cache miss") || strings.Contains(output, "Cache hit") {
+		t.Errorf("Expected cache lookups not to be logged at info level, got %q", output)
+	}
+}
+
+func TestLogging_ConfigureWritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.log")
+	closer, err := logging.Configure("debug", "text", path)
+	if err != nil {
+		t.Fatalf("Expected logging to be configured, got %v", err)
+	}
+	t.Cleanup(resetLogging)
+
+	logging.Debugf("written to file")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected log file to exist, got %v", err)
+	}
+	if !strings.Contains(string(data), "DEBUG written to file") {
+		t.Errorf("Expected debug message in log file, got %q", data)
+	}
+}
+
+func TestLogging_InvalidLevel(t *testing.T) {
+	if _, ok := logging.ParseLevel("verbose"); ok {
+		t.Error("Expected unknown level not to parse")
+	}
+
+	cfg := config.NewDefaultConfig()
+	cfg.LogLevel = "verbose"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for unknown log level")
+	}
+}
+
+func TestLogger_JSONFormat(t *testing.T) {
+	buf := captureLogs(t, logging.LevelInfo)
+	logging.SetFormat(logging.FormatJSON)
+
+	handler := proxy.Chain(textHandler("hello"), proxy.RequestID(), proxy.Logger())
+	req := httptest.NewRequest(http.MethodGet, "/path", nil)
+	req.Header.Set("X-Request-ID", "trace-json")
+	req.Header.Set("User-Agent", "tester")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("Expected one JSON object, got %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]any{
+		"level":       "info",
+		"msg":         "request",
+		"method":      "GET",
+		"path":        "/path",
+		"status":      float64(http.StatusOK),
+		"bytes":       float64(len("hello")),
+		"user_agent":  "tester",
+		"request_id":  "trace-json",
+		"remote_addr": req.RemoteAddr,
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["duration_ms"].(float64); !ok {
+		t.Errorf("Expected a numeric duration_ms, got %v", entry["duration_ms"])
+	}
+}
+
+func TestLogging_InvalidFormat(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.LogFormat = "xml"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for unknown log format")
+	}
+}
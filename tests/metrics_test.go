@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestMetrics_RecordsRequestsAndCacheLookups(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MetricsEnabled = true
+	handler := proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg)
+
+	proxyGet(handler, upstream.URL)
+	proxyGet(handler, upstream.URL)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`proxy_requests_total{code="200",method="GET"} 2`,
+		`proxy_request_duration_seconds_count{code="200",method="GET"} 2`,
+		"proxy_requests_in_flight 0",
+		"proxy_cache_hits_total 1",
+		"proxy_cache_misses_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetrics_DisabledByDefault(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	handler := proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestMetrics_RecordsCacheDecodingErrors(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MetricsEnabled = true
+	c := cache.NewLRUCache(10)
+	handler := proxy.CreateMiddlewareChain(newTestProxyWithCache(t, cfg, c), cfg)
+
+	// A corrupt entry is refetched and counted
+	c.Set("GET:"+upstream.URL+"/corrupt", []byte("no header separator"), time.Minute)
+	proxyGet(handler, upstream.URL+"/corrupt")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"proxy_cache_deserialization_errors_total 1",
+		"proxy_cache_serialization_errors_total 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
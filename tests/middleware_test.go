@@ -0,0 +1,679 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/logging"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+	"github.com/andybalholm/brotli"
+)
+
+// textHandler writes a fixed plain-text body
+func textHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	})
+}
+
+func TestCompress_TrustedPeerBypass(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	handler := proxy.Compress(proxy.CompressOptions{
+		TrustedPeers: []*net.IPNet{trusted},
+	})(textHandler("hello world"))
+
+	// Request from a trusted peer should not be compressed
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no Content-Encoding for trusted peer, got %s", enc)
+	}
+	if rec.Body.String() != "hello world" {
+		t.Errorf("Expected plain body, got %q", rec.Body.String())
+	}
+
+	// Request from any other client should still be compressed
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.10:4567"
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("Expected gzip Content-Encoding, got %q", enc)
+	}
+}
+
+func TestCompress_BypassHeader(t *testing.T) {
+	handler := proxy.Compress(proxy.CompressOptions{
+		BypassHeader: "X-Compressed-By",
+	})(textHandler("hello world"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("X-Compressed-By", "edge")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no Content-Encoding with bypass header, got %s", enc)
+	}
+}
+
+// gzipRequest builds a request accepting gzip
+func gzipRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	return req
+}
+
+func TestCompress_SkipsAlreadyEncodedResponse(t *testing.T) {
+	var encoded bytes.Buffer
+	gz := gzip.NewWriter(&encoded)
+	gz.Write([]byte("hello world"))
+	gz.Close()
+
+	// Mimics the proxy copying an upstream gzip response with its length
+	handler := proxy.Compress(proxy.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(encoded.Len()))
+		w.Write(encoded.Bytes())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+
+	if !bytes.Equal(rec.Body.Bytes(), encoded.Bytes()) {
+		t.Errorf("Expected the upstream gzip bytes untouched, got %q", rec.Body.Bytes())
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(encoded.Len()) {
+		t.Errorf("Expected Content-Length %d, got %s", encoded.Len(), cl)
+	}
+}
+
+func TestCompress_SkipsImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	handler := proxy.Compress(proxy.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(png)))
+		w.Write(png)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no Content-Encoding for an image, got %s", enc)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Errorf("Expected image body untouched, got %q", rec.Body.Bytes())
+	}
+}
+
+func TestCompress_DropsUpstreamContentLength(t *testing.T) {
+	body := `{"hello":"world"}`
+	handler := proxy.Compress(proxy.CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write([]byte(body))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding, got %q", enc)
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Expected no Content-Length on compressed body, got %s", cl)
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip body: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != body {
+		t.Errorf("Expected decoded body %s, got %q", body, decoded)
+	}
+}
+
+func TestCompress_MinSizeLeavesSmallBodies(t *testing.T) {
+	body := "hello world"
+	handler := proxy.Compress(proxy.CompressOptions{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Upstream", "kept")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Expected no Content-Encoding below the minimum size, got %s", enc)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-Upstream") != "kept" {
+		t.Errorf("Expected original headers intact, got %v", rec.Header())
+	}
+	if rec.Body.String() != body {
+		t.Errorf("Expected plain body, got %q", rec.Body.String())
+	}
+}
+
+func TestCompress_MinSizeReachedAcrossWrites(t *testing.T) {
+	chunk := strings.Repeat("a", 300)
+	handler := proxy.Compress(proxy.CompressOptions{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 4; i++ {
+			w.Write([]byte(chunk))
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding, got %q", enc)
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Expected gzip body: %v", err)
+	}
+	decoded, _ := io.ReadAll(reader)
+	if string(decoded) != strings.Repeat(chunk, 4) {
+		t.Errorf("Expected decoded body of %d bytes, got %d", 4*len(chunk), len(decoded))
+	}
+}
+
+func TestCompress_MinSizeUsesDeclaredLength(t *testing.T) {
+	body := strings.Repeat("b", 2048)
+	handler := proxy.Compress(proxy.CompressOptions{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+
+		// The decision was made before any body was written
+		if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+			t.Errorf("Expected gzip Content-Encoding once the header is written, got %q", enc)
+		}
+		w.Write([]byte(body))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, gzipRequest())
+	if rec.Header().Get("Content-Length") != "" {
+		t.Errorf("Expected no Content-Length on compressed body, got %s", rec.Header().Get("Content-Length"))
+	}
+}
+
+func TestCompress_NegotiatesEncoding(t *testing.T) {
+	handler := proxy.Compress(proxy.CompressOptions{})(textHandler("hello world"))
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"gzip;q=0, br;q=0", ""},
+		{"deflate", ""},
+		{"identity", ""},
+		{"*", "br"},
+		{"*;q=0.1, br;q=0", "gzip"},
+		{"x-gzip", "gzip"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if enc := rec.Header().Get("Content-Encoding"); enc != tt.expected {
+			t.Errorf("Expected Content-Encoding %q for Accept-Encoding %q, got %q", tt.expected, tt.accept, enc)
+		}
+	}
+}
+
+func TestCompress_BrotliBodyDecodes(t *testing.T) {
+	body := strings.Repeat("hello brotli ", 100)
+	handler := proxy.Compress(proxy.CompressOptions{})(textHandler(body))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	decoded, err := io.ReadAll(brotli.NewReader(rec.Body))
+	if err != nil {
+		t.Fatalf("Expected brotli body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Errorf("Expected decoded body of %d bytes, got %d", len(body), len(decoded))
+	}
+}
+
+// exhaustRateLimit sends requests until the client's burst is used up
+// newRateLimit creates a RateLimit middleware whose idle client sweeper stops
+// when the test ends
+func newRateLimit(t *testing.T, opts proxy.RateLimitOptions) proxy.Middleware {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	opts.Context = ctx
+	return proxy.RateLimit(opts)
+}
+
+func exhaustRateLimit(t *testing.T, handler http.Handler, burst int) {
+	t.Helper()
+	for i := 0; i < burst; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the burst to pass, got %d", i, rec.Code)
+		}
+	}
+}
+
+func TestRateLimit_RejectMode(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 600, // One token every 100ms
+		Mode:              proxy.RateLimitReject,
+	})(textHandler("ok"))
+	exhaustRateLimit(t, handler, 600)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on rejection")
+	}
+}
+
+func TestRateLimit_RejectionDescribesLimit(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 60, // One token every second
+		Mode:              proxy.RateLimitReject,
+	})(textHandler("ok"))
+
+	// Allowed requests report what is left of the allowance
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("X-RateLimit-Limit") != "60" {
+		t.Errorf("Expected X-RateLimit-Limit 60, got %s", rec.Header().Get("X-RateLimit-Limit"))
+	}
+	if rec.Header().Get("X-RateLimit-Remaining") != "59" {
+		t.Errorf("Expected X-RateLimit-Remaining 59, got %s", rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	exhaustRateLimit(t, handler, 59)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %s", rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected X-RateLimit-Remaining 0, got %s", rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < time.Now().Unix() || reset > time.Now().Add(61*time.Second).Unix() {
+		t.Errorf("Expected X-RateLimit-Reset within the next minute, got %s", rec.Header().Get("X-RateLimit-Reset"))
+	}
+
+	var body struct {
+		Error      string `json:"error"`
+		Limit      int    `json:"limit"`
+		RetryAfter int    `json:"retry_after"`
+		Reset      int64  `json:"reset"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %q: %v", rec.Body.String(), err)
+	}
+	if body.Limit != 60 || body.RetryAfter != 1 || body.Reset != reset || body.Error == "" {
+		t.Errorf("Expected body describing the limit, got %+v", body)
+	}
+}
+
+// rateLimitedFrom sends a request from the load balancer on behalf of the
+// forwarded client and reports whether it was rejected
+func rateLimitedFrom(handler http.Handler, remoteAddr, forwardedFor string) bool {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code == http.StatusTooManyRequests
+}
+
+func TestRateLimit_TrustProxyHeaders(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 1,
+		Mode:              proxy.RateLimitReject,
+		TrustProxyHeaders: true,
+	})(textHandler("ok"))
+
+	// Clients behind the same load balancer get buckets of their own
+	if rateLimitedFrom(handler, "10.0.0.1:1234", "203.0.113.7, 10.0.0.1") {
+		t.Error("Expected first request of the first client to pass")
+	}
+	if rateLimitedFrom(handler, "10.0.0.1:1234", "203.0.113.8") {
+		t.Error("Expected first request of the second client to pass")
+	}
+	if !rateLimitedFrom(handler, "10.0.0.1:1234", "203.0.113.7") {
+		t.Error("Expected second request of the first client to be limited")
+	}
+
+	// Unparseable values fall back to the peer address
+	if rateLimitedFrom(handler, "10.0.0.1:1234", "not-an-ip") {
+		t.Error("Expected first request keyed by the peer address to pass")
+	}
+	if !rateLimitedFrom(handler, "10.0.0.1:1234", "") {
+		t.Error("Expected second request keyed by the peer address to be limited")
+	}
+}
+
+func TestRateLimit_IgnoresProxyHeadersFromUntrustedPeers(t *testing.T) {
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 1,
+		Mode:              proxy.RateLimitReject,
+		TrustProxyHeaders: true,
+		TrustedProxies:    []*net.IPNet{lb},
+	})(textHandler("ok"))
+
+	// A client outside the load balancer network can't pick a fresh bucket
+	if rateLimitedFrom(handler, "192.168.1.10:1234", "203.0.113.1") {
+		t.Error("Expected first request to pass")
+	}
+	if !rateLimitedFrom(handler, "192.168.1.10:1234", "203.0.113.2") {
+		t.Error("Expected spoofed X-Forwarded-For to be ignored")
+	}
+}
+
+func TestRateLimit_ProxyHeadersIgnoredByDefault(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 1,
+		Mode:              proxy.RateLimitReject,
+	})(textHandler("ok"))
+
+	if rateLimitedFrom(handler, "10.0.0.1:1234", "203.0.113.1") {
+		t.Error("Expected first request to pass")
+	}
+	if !rateLimitedFrom(handler, "10.0.0.1:1234", "203.0.113.2") {
+		t.Error("Expected X-Forwarded-For to be ignored without TrustProxyHeaders")
+	}
+}
+
+func TestRateLimit_DelayModeAdmitsAfterWait(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 600, // One token every 100ms
+		Mode:              proxy.RateLimitDelay,
+		MaxDelay:          time.Second,
+	})(textHandler("ok"))
+	exhaustRateLimit(t, handler, 600)
+
+	// The next request waits for a token instead of failing
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected delayed request to be admitted, got %d", rec.Code)
+	}
+	if elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected request to be held for about 100ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimit_DelayModeRejectsBeyondMaxDelay(t *testing.T) {
+	handler := newRateLimit(t, proxy.RateLimitOptions{
+		RequestsPerMinute: 60, // One token every second
+		Mode:              proxy.RateLimitDelay,
+		MaxDelay:          100 * time.Millisecond,
+	})(textHandler("ok"))
+	exhaustRateLimit(t, handler, 60)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 when the wait exceeds the max delay, got %d", rec.Code)
+	}
+}
+
+// writeCounter is a ResponseWriter counting the writes that reach it
+type writeCounter struct {
+	header  http.Header
+	writes  int
+	flushes int
+	body    []byte
+}
+
+func (wc *writeCounter) Header() http.Header { return wc.header }
+
+func (wc *writeCounter) WriteHeader(int) {}
+
+func (wc *writeCounter) Write(data []byte) (int, error) {
+	wc.writes++
+	wc.body = append(wc.body, data...)
+	return len(data), nil
+}
+
+func (wc *writeCounter) Flush() { wc.flushes++ }
+
+// chunkedHandler writes the body in small chunks, flushing once halfway
+func chunkedHandler(chunks, chunkSize int) http.Handler {
+	chunk := make([]byte, chunkSize)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			w.Write(chunk)
+			if i == chunks/2 {
+				http.NewResponseController(w).Flush()
+			}
+		}
+	})
+}
+
+func TestBufferResponses_CoalescesWritesAndFlushes(t *testing.T) {
+	handler := proxy.BufferResponses(32 << 10)(chunkedHandler(256, 512))
+
+	wc := &writeCounter{header: make(http.Header)}
+	handler.ServeHTTP(wc, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(wc.body) != 256*512 {
+		t.Errorf("Expected %d body bytes, got %d", 256*512, len(wc.body))
+	}
+	if wc.writes > 8 {
+		t.Errorf("Expected buffered writes to be coalesced, got %d writes", wc.writes)
+	}
+	if wc.flushes != 1 {
+		t.Errorf("Expected handler flush to reach the client, got %d flushes", wc.flushes)
+	}
+}
+
+func benchmarkResponseWrites(b *testing.B, handler http.Handler) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	writes := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wc := &writeCounter{header: make(http.Header)}
+		handler.ServeHTTP(wc, req)
+		writes += wc.writes
+	}
+	b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkResponseWrites_Unbuffered(b *testing.B) {
+	benchmarkResponseWrites(b, chunkedHandler(2048, 512))
+}
+
+func BenchmarkResponseWrites_Buffered(b *testing.B) {
+	benchmarkResponseWrites(b, proxy.BufferResponses(32<<10)(chunkedHandler(2048, 512)))
+}
+
+// requestIDHandler records the request ID seen in the context and headers
+func requestIDHandler(fromContext, fromHeader *string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*fromContext = proxy.RequestIDFromContext(r.Context())
+		*fromHeader = r.Header.Get("X-Request-ID")
+	})
+}
+
+func TestRequestID_GeneratesRandomIDs(t *testing.T) {
+	var fromContext, fromHeader string
+	handler := proxy.RequestID()(requestIDHandler(&fromContext, &fromHeader))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		id := rec.Header().Get("X-Request-ID")
+		if len(id) != 32 {
+			t.Fatalf("Expected a 32 character hex ID, got %q", id)
+		}
+		if seen[id] {
+			t.Errorf("Expected unique IDs, got %s twice", id)
+		}
+		seen[id] = true
+
+		// Handlers and the upstream see the same ID as the client
+		if fromContext != id || fromHeader != id {
+			t.Errorf("Expected ID %s in context and request header, got %q and %q", id, fromContext, fromHeader)
+		}
+	}
+}
+
+func TestRequestID_ReusesIncomingID(t *testing.T) {
+	var fromContext, fromHeader string
+	handler := proxy.RequestID()(requestIDHandler(&fromContext, &fromHeader))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "trace-abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get("X-Request-ID"); id != "trace-abc-123" {
+		t.Errorf("Expected incoming ID to be reused, got %s", id)
+	}
+	if fromContext != "trace-abc-123" {
+		t.Errorf("Expected incoming ID in context, got %s", fromContext)
+	}
+
+	// IDs that could break log lines are replaced
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\nforged log line")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Errorf("Expected a generated ID for an invalid incoming one, got %q", id)
+	}
+}
+
+func TestLogger_IncludesRequestID(t *testing.T) {
+	logs := captureLogs(t, logging.LevelInfo)
+
+	handler := proxy.Chain(textHandler("ok"), proxy.RequestID(), proxy.Logger())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "trace-xyz")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), "trace-xyz") {
+		t.Errorf("Expected log line to contain the request ID, got %q", logs.String())
+	}
+}
+
+func TestCreateMiddlewareChain_ConfiguredMiddleware(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Middleware = []string{"security_headers", "request_id"}
+	handler := proxy.CreateMiddlewareChain(textHandler("ok"), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("Expected security headers to be added")
+	}
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Error("Expected a request ID to be added")
+	}
+	if rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Error("Expected rate limiting to be left out")
+	}
+}
+
+func TestRecover_AnswersPanicsWith500(t *testing.T) {
+	logs := captureLogs(t, logging.LevelError)
+
+	cfg := config.NewDefaultConfig()
+	cfg.Middleware = []string{"recover", "logger"}
+	handler := proxy.CreateMiddlewareChain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), cfg)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+	if !strings.Contains(logs.String(), "boom") {
+		t.Errorf("Expected the panic to be logged, got %q", logs.String())
+	}
+}
+
+func TestConfig_MiddlewareValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Middleware = []string{"logger", "gzip"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for an unknown middleware")
+	}
+
+	cfg.Middleware = []string{"logger", "logger"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for a duplicate middleware")
+	}
+}
+
+func TestProxy_ShutdownCancelsContext(t *testing.T) {
+	handler := proxy.NewProxyHandler(cache.NewLRUCache(10), config.NewDefaultConfig())
+	if handler.Context().Err() != nil {
+		t.Fatal("Expected context to be live before shutdown")
+	}
+
+	// Middleware sweepers built on the handler stop along with it
+	handler.Shutdown()
+	if handler.Context().Err() == nil {
+		t.Error("Expected context to be cancelled by shutdown")
+	}
+}
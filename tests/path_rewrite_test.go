@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_PathRewriteStripsPrefix(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+
+	cfg := config.NewDefaultConfig()
+	cfg.PathRewrites = []config.PathRewriteRule{{StripPrefix: "/api"}}
+	handler := newTestProxy(t, cfg)
+
+	tests := map[string]string{
+		"/api/users": "/users",
+		"/api":       "/",
+		"/apix/data": "/apix/data",
+		"/other":     "/other",
+	}
+	for path, want := range tests {
+		if rec := proxyGet(handler, upstream.URL+path); rec.Body.String() != want {
+			t.Errorf("%s: Expected upstream path %s, got %s", path, want, rec.Body.String())
+		}
+	}
+}
+
+func TestProxy_PathRewriteRegex(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+
+	cfg := config.NewDefaultConfig()
+	cfg.PathRewrites = []config.PathRewriteRule{{Match: `^/v1/(.*)$`, Replace: "/v2/$1"}}
+	handler := newTestProxy(t, cfg)
+
+	rec := proxyGet(handler, upstream.URL+"/v1/items/7")
+	if rec.Body.String() != "/v2/items/7" {
+		t.Errorf("Expected upstream path /v2/items/7, got %s", rec.Body.String())
+	}
+
+	// The original and the rewritten path fetch the same resource, so they
+	// share a cache entry
+	rec = proxyGet(handler, upstream.URL+"/v2/items/7")
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected cache hit for the rewritten path, got %s", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestProxy_PathRewriteScopedToDomain(t *testing.T) {
+	upstream := newEchoUpstream(t, nil)
+
+	cfg := config.NewDefaultConfig()
+	cfg.PathRewrites = []config.PathRewriteRule{{Domain: "example.com", StripPrefix: "/api"}}
+	handler := newTestProxy(t, cfg)
+
+	if rec := proxyGet(handler, upstream.URL+"/api/users"); rec.Body.String() != "/api/users" {
+		t.Errorf("Expected path to be kept for another domain, got %s", rec.Body.String())
+	}
+}
+
+func TestConfig_PathRewritesValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.PathRewrites = []config.PathRewriteRule{{Match: "("}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for invalid expression")
+	}
+
+	cfg.PathRewrites = []config.PathRewriteRule{{Domain: "example.com"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for a rule without a rewrite")
+	}
+}
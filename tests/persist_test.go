@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+func TestLRUCache_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.gob")
+
+	c := cache.NewLRUCache(10)
+	c.Set("forever", []byte("value1"), 0)
+	c.Set("hour", []byte("value2"), time.Hour)
+	c.Set("short", []byte("value3"), 50*time.Millisecond)
+	original, _ := c.Peek("hour")
+
+	if err := c.SaveToFile(path); err != nil {
+		t.Fatalf("Expected save to succeed: %v", err)
+	}
+
+	// Entries that expire before the restart are skipped on load
+	time.Sleep(100 * time.Millisecond)
+
+	restored := cache.NewLRUCache(10)
+	if err := restored.LoadFromFile(path); err != nil {
+		t.Fatalf("Expected load to succeed: %v", err)
+	}
+	if restored.Size() != 2 {
+		t.Errorf("Expected 2 restored items, got %d", restored.Size())
+	}
+
+	item, found := restored.Peek("hour")
+	if !found {
+		t.Fatal("Expected to find hour")
+	}
+	if string(item.Value) != "value2" {
+		t.Errorf("Expected value2, got %s", item.Value)
+	}
+	if !item.ExpiresAt.Equal(original.ExpiresAt) {
+		t.Errorf("Expected expiration %v to be preserved, got %v", original.ExpiresAt, item.ExpiresAt)
+	}
+	if _, found := restored.Peek("short"); found {
+		t.Error("Expected expired item not to be restored")
+	}
+
+	// Recency order survives the round trip
+	keys := restored.Keys()
+	if len(keys) != 2 || keys[0] != "hour" || keys[1] != "forever" {
+		t.Errorf("Expected [hour forever], got %v", keys)
+	}
+}
+
+func TestLRUCache_LoadMissingFile(t *testing.T) {
+	c := cache.NewLRUCache(10)
+	if err := c.LoadFromFile(filepath.Join(t.TempDir(), "missing.gob")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// bodyEchoServer answers with the request body, counting requests
+func bodyEchoServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("echo:" + string(body)))
+	}))
+}
+
+// proxyPostBody sends a POST request with the body for the target URL through the proxy handler
+func proxyPostBody(handler http.Handler, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(target), strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProxy_CacheablePOSTKeysByBody(t *testing.T) {
+	var requests int32
+	upstream := bodyEchoServer(&requests)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.CacheablePOST = true
+	handler := newTestProxy(t, cfg)
+
+	queries := []string{`{"query":"a"}`, `{"query":"b"}`}
+	for _, query := range queries {
+		rec := proxyPostBody(handler, upstream.URL, query)
+		if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "echo:"+query {
+			t.Errorf("Expected MISS with echo of %s, got %s %q", query, rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+	}
+	for _, query := range queries {
+		rec := proxyPostBody(handler, upstream.URL, query)
+		if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "echo:"+query {
+			t.Errorf("Expected HIT with echo of %s, got %s %q", query, rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", n)
+	}
+}
+
+func TestProxy_POSTNotCachedByDefault(t *testing.T) {
+	var requests int32
+	upstream := bodyEchoServer(&requests)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyPostBody(handler, upstream.URL, "payload")
+	rec := proxyPostBody(handler, upstream.URL, "payload")
+
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "echo:payload" {
+		t.Errorf("Expected MISS with echoed body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", n)
+	}
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_UpstreamTimeoutReturns504(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	cfg := config.NewDefaultConfig()
+	cfg.ProxyTimeout = 1
+	handler := newTestProxy(t, cfg)
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", rec.Code)
+	}
+	if reason := rec.Header().Get("X-Proxy-Error"); reason != "upstream_timeout" {
+		t.Errorf("Expected X-Proxy-Error upstream_timeout, got %s", reason)
+	}
+}
+
+func TestProxy_ConnectionRefusedReturns502(t *testing.T) {
+	// Grab a free port and close it again so nothing is listening there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	target := "http://" + listener.Addr().String()
+	listener.Close()
+
+	handler := newTestProxy(t, nil)
+
+	start := time.Now()
+	rec := proxyGet(handler, target)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+	if reason := rec.Header().Get("X-Proxy-Error"); reason != "connection_refused" {
+		t.Errorf("Expected X-Proxy-Error connection_refused, got %s", reason)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected a refused connection to fail fast, took %v", elapsed)
+	}
+}
+
+func TestProxy_MalformedTargetReturns400(t *testing.T) {
+	handler := newTestProxy(t, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?url=http%3A%2F%2F%25zz", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	if reason := rec.Header().Get("X-Proxy-Error"); reason != "invalid_target" {
+		t.Errorf("Expected X-Proxy-Error invalid_target, got %s", reason)
+	}
+}
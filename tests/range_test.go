@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves a fixed body honoring Range requests, counting requests
+func rangeServer(body string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+}
+
+func TestProxy_RangePassthroughIsNotCached(t *testing.T) {
+	var requests int32
+	upstream := rangeServer("0123456789", &requests)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+
+	for i := 0; i < 2; i++ {
+		rec := proxyGetWithHeader(handler, upstream.URL, "Range", "bytes=2-4")
+		if rec.Code != http.StatusPartialContent {
+			t.Errorf("Expected status 206, got %d", rec.Code)
+		}
+		if rec.Body.String() != "234" {
+			t.Errorf("Expected body 234, got %q", rec.Body.String())
+		}
+		if rec.Header().Get("Content-Range") != "bytes 2-4/10" {
+			t.Errorf("Expected Content-Range bytes 2-4/10, got %s", rec.Header().Get("Content-Range"))
+		}
+	}
+
+	// The partial body must not have been stored as the whole resource
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Body.String() != "0123456789" {
+		t.Errorf("Expected full body, got %q", rec.Body.String())
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("Expected 3 upstream requests, got %d", n)
+	}
+}
+
+func TestProxy_RangeServedFromCachedBody(t *testing.T) {
+	var requests int32
+	upstream := rangeServer("0123456789", &requests)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+
+	tests := []struct {
+		rng          string
+		body         string
+		contentRange string
+	}{
+		{"bytes=2-4", "234", "bytes 2-4/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-2", "89", "bytes 8-9/10"},
+		{"bytes=8-20", "89", "bytes 8-9/10"},
+	}
+	for _, tt := range tests {
+		rec := proxyGetWithHeader(handler, upstream.URL, "Range", tt.rng)
+		if rec.Code != http.StatusPartialContent {
+			t.Errorf("Expected status 206 for %s, got %d", tt.rng, rec.Code)
+		}
+		if rec.Header().Get("X-Cache") != "HIT" {
+			t.Errorf("Expected X-Cache HIT for %s, got %s", tt.rng, rec.Header().Get("X-Cache"))
+		}
+		if rec.Body.String() != tt.body {
+			t.Errorf("Expected body %q for %s, got %q", tt.body, tt.rng, rec.Body.String())
+		}
+		if rec.Header().Get("Content-Range") != tt.contentRange {
+			t.Errorf("Expected Content-Range %s for %s, got %s", tt.contentRange, tt.rng, rec.Header().Get("Content-Range"))
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", n)
+	}
+}
+
+func TestProxy_RangeFromCacheEdgeCases(t *testing.T) {
+	var requests int32
+	upstream := rangeServer("0123456789", &requests)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	proxyGet(handler, upstream.URL)
+
+	rec := proxyGetWithHeader(handler, upstream.URL, "Range", "bytes=20-")
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected status 416, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Range") != "bytes */10" {
+		t.Errorf("Expected Content-Range bytes */10, got %s", rec.Header().Get("Content-Range"))
+	}
+
+	// Multiple ranges are answered with the whole body
+	rec = proxyGetWithHeader(handler, upstream.URL, "Range", "bytes=0-1,4-5")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("Expected full body with status 200, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// A failed If-Range condition also gets the whole body
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("Range", "bytes=2-4")
+	req.Header.Set("If-Range", `"v0"`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("Expected full body with status 200, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// redirectChain returns an upstream where /hops/N redirects to /hops/N-1 and
+// /hops/0 answers with done
+func redirectChain() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hops/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+}
+
+func TestProxy_MaxRedirects(t *testing.T) {
+	upstream := redirectChain()
+	defer upstream.Close()
+
+	tests := []struct {
+		maxRedirects int
+		hops         int
+		status       int
+	}{
+		{10, 5, http.StatusOK},
+		{5, 5, http.StatusOK},
+		{3, 5, http.StatusBadGateway},
+		{0, 5, http.StatusFound},
+		{-1, 20, http.StatusOK},
+		{-1, config.RedirectCap + 1, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		cfg := config.NewDefaultConfig()
+		cfg.MaxRedirects = tt.maxRedirects
+		handler := newTestProxy(t, cfg)
+
+		rec := proxyGet(handler, fmt.Sprintf("%s/hops/%d", upstream.URL, tt.hops))
+		if rec.Code != tt.status {
+			t.Errorf("Expected status %d for %d hops with max redirects %d, got %d", tt.status, tt.hops, tt.maxRedirects, rec.Code)
+		}
+		if tt.status == http.StatusOK && rec.Body.String() != "done" {
+			t.Errorf("Expected body done for max redirects %d, got %q", tt.maxRedirects, rec.Body.String())
+		}
+	}
+}
+
+func TestProxy_MaxRedirectsZeroReturnsRedirect(t *testing.T) {
+	upstream := redirectChain()
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxRedirects = 0
+	handler := newTestProxy(t, cfg)
+
+	rec := proxyGet(handler, upstream.URL+"/hops/1")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d", rec.Code)
+	}
+	if location := rec.Header().Get("Location"); location != "/hops/0" {
+		t.Errorf("Expected Location /hops/0, got %q", location)
+	}
+}
+
+func TestConfig_MaxRedirectsValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.MaxRedirects = config.RedirectCap + 1
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected error for max redirects above the cap")
+	}
+
+	for _, n := range []int{-1, 0, config.RedirectCap} {
+		cfg := config.NewDefaultConfig()
+		cfg.MaxRedirects = n
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected max redirects %d to be valid, got %v", n, err)
+		}
+	}
+}
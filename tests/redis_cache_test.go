@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisCache creates a Redis cache backed by an in-process server
+func newTestRedisCache(t *testing.T, prefix string) (*cache.RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	c := cache.NewRedisCache(cache.RedisOptions{Addr: server.Addr(), KeyPrefix: prefix, Capacity: 100})
+	t.Cleanup(func() { c.Close() })
+	return c, server
+}
+
+func TestRedisCache_SetGetRemove(t *testing.T) {
+	c, _ := newTestRedisCache(t, "test:")
+
+	if !c.Set("key", []byte("value"), time.Minute) {
+		t.Errorf("Expected Set to report a new item")
+	}
+	if c.Set("key", []byte("updated"), time.Minute) {
+		t.Errorf("Expected Set to report an update")
+	}
+
+	item, found := c.Get("key")
+	if !found {
+		t.Fatalf("Expected to find key")
+	}
+	if !bytes.Equal(item.Value, []byte("updated")) {
+		t.Errorf("Expected value updated, got %s", item.Value)
+	}
+	if item.Key != "key" || item.Size != len("updated") {
+		t.Errorf("Expected key with size %d, got %s with size %d", len("updated"), item.Key, item.Size)
+	}
+	if time.Until(item.ExpiresAt) <= 0 || time.Until(item.ExpiresAt) > time.Minute {
+		t.Errorf("Expected item to expire within a minute, got %v", item.ExpiresAt)
+	}
+
+	if !c.Remove("key") {
+		t.Errorf("Expected Remove to find key")
+	}
+	if _, found := c.Get("key"); found {
+		t.Errorf("Expected key to be removed")
+	}
+}
+
+func TestRedisCache_UsesRedisTTL(t *testing.T) {
+	c, server := newTestRedisCache(t, "test:")
+
+	c.Set("short", []byte("value"), 10*time.Second)
+	c.Set("forever", []byte("value"), 0)
+
+	if ttl := server.TTL("test:short"); ttl != 10*time.Second {
+		t.Errorf("Expected redis TTL 10s, got %v", ttl)
+	}
+	if ttl := server.TTL("test:forever"); ttl != 0 {
+		t.Errorf("Expected no redis TTL, got %v", ttl)
+	}
+
+	server.FastForward(11 * time.Second)
+	if _, found := c.Get("short"); found {
+		t.Errorf("Expected short to have expired")
+	}
+	if _, found := c.Get("forever"); !found {
+		t.Errorf("Expected forever to be kept")
+	}
+}
+
+func TestRedisCache_ClearKeepsOtherData(t *testing.T) {
+	c, server := newTestRedisCache(t, "test:")
+	server.Set("unrelated", "data")
+
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+
+	keys := c.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("Expected keys [a b], got %v", keys)
+	}
+	if c.Size() != 2 {
+		t.Errorf("Expected size 2, got %d", c.Size())
+	}
+
+	c.Clear()
+	if c.Size() != 0 {
+		t.Errorf("Expected size 0 after Clear, got %d", c.Size())
+	}
+	if !server.Exists("unrelated") {
+		t.Errorf("Expected Clear to leave keys outside the prefix alone")
+	}
+}
+
+func TestRedisCache_SharedBetweenInstances(t *testing.T) {
+	first, server := newTestRedisCache(t, "shared:")
+	second := cache.NewRedisCache(cache.RedisOptions{Addr: server.Addr(), KeyPrefix: "shared:"})
+	defer second.Close()
+
+	first.Set("key", []byte("value"), time.Minute)
+	if item, found := second.Get("key"); !found || string(item.Value) != "value" {
+		t.Errorf("Expected the second instance to see the item")
+	}
+}
+
+func TestRedisCache_Stats(t *testing.T) {
+	c, _ := newTestRedisCache(t, "test:")
+
+	c.Set("key", []byte("value"), 0)
+	c.Get("key")
+	c.Get("key")
+	c.Get("missing")
+	c.Peek("key")
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d and %d", stats.Hits, stats.Misses)
+	}
+	if stats.Size != 1 || stats.Capacity != 100 {
+		t.Errorf("Expected size 1 and capacity 100, got %d and %d", stats.Size, stats.Capacity)
+	}
+
+	c.ResetStats()
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Expected counters reset, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+}
+
+func TestRedisCache_UnreachableServerMisses(t *testing.T) {
+	c, server := newTestRedisCache(t, "test:")
+	server.Close()
+
+	if c.Set("key", []byte("value"), 0) {
+		t.Errorf("Expected Set to fail against a closed server")
+	}
+	if _, found := c.Get("key"); found {
+		t.Errorf("Expected a miss against a closed server")
+	}
+	if err := c.Ping(); err == nil {
+		t.Errorf("Expected Ping to fail against a closed server")
+	}
+}
+
+func TestProxy_RedisCacheServesHits(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	c, _ := newTestRedisCache(t, "proxy:")
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+
+	proxyGet(handler, upstream.URL)
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected cache hit, got %s", rec.Header().Get("X-Cache"))
+	}
+	if rec.Body.String() != "content" {
+		t.Errorf("Expected body content, got %q", rec.Body.String())
+	}
+}
+
+func TestConfig_CacheBackendValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.CacheBackend = "memcached"
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected error for unknown cache backend")
+	}
+
+	cfg = config.NewDefaultConfig()
+	cfg.CacheBackend = "redis"
+	cfg.RedisAddr = ""
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected error for redis backend without an address")
+	}
+
+	cfg = config.NewDefaultConfig()
+	cfg.CacheBackend = "redis"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected redis backend with the default address to be valid, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestRefreshLimiter_DropsBeyondLimit(t *testing.T) {
+	limiter := proxy.NewRefreshLimiter(2)
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	refresh := func() {
+		defer wg.Done()
+		<-release
+	}
+
+	// Fill every slot with a refresh that doesn't finish yet
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		if !limiter.Go(refresh) {
+			t.Fatalf("Expected refresh %d to start", i)
+		}
+	}
+
+	// Further triggers are dropped instead of queued
+	for i := 0; i < 3; i++ {
+		if limiter.Go(func() { t.Error("Dropped refresh must not run") }) {
+			t.Errorf("Expected refresh to be dropped at the limit")
+		}
+	}
+	if dropped := limiter.Dropped(); dropped != 3 {
+		t.Errorf("Expected 3 dropped refreshes, got %d", dropped)
+	}
+	if active := limiter.Active(); active != 2 {
+		t.Errorf("Expected 2 active refreshes, got %d", active)
+	}
+
+	close(release)
+	wg.Wait()
+
+	// Slots free up once the running refreshes complete
+	waitFor(t, time.Second, func() bool { return limiter.Active() == 0 })
+	done := make(chan struct{})
+	if !limiter.Go(func() { close(done) }) {
+		t.Error("Expected refresh to start after slots were released")
+	}
+	<-done
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestHolder_ReloadAppliesReloadableFieldsOnly(t *testing.T) {
+	holder := config.NewHolder(config.NewDefaultConfig())
+
+	next := config.NewDefaultConfig()
+	next.Port = 9999
+	next.CacheTTL = 42
+	next.AllowedDomains = []string{"example.com"}
+	next.RateLimitMode = "delay"
+	next.LogLevel = "debug"
+
+	current, err := holder.Reload(next)
+	if err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+	if holder.Load() != current {
+		t.Errorf("Expected the reloaded configuration to be current")
+	}
+	if current.CacheTTL != 42 || current.RateLimitMode != "delay" || current.LogLevel != "debug" {
+		t.Errorf("Expected reloadable fields to be applied, got ttl %d, mode %s, level %s", current.CacheTTL, current.RateLimitMode, current.LogLevel)
+	}
+	if len(current.AllowedDomains) != 1 || current.AllowedDomains[0] != "example.com" {
+		t.Errorf("Expected allowed domains [example.com], got %v", current.AllowedDomains)
+	}
+	if current.Port != config.NewDefaultConfig().Port {
+		t.Errorf("Expected port to require a restart, got %d", current.Port)
+	}
+}
+
+func TestHolder_ReloadRejectsInvalidConfig(t *testing.T) {
+	original := config.NewDefaultConfig()
+	holder := config.NewHolder(original)
+
+	next := config.NewDefaultConfig()
+	next.RateLimitMode = "bogus"
+	if _, err := holder.Reload(next); err == nil {
+		t.Error("Expected reload of an invalid configuration to fail")
+	}
+	if holder.Load() != original {
+		t.Errorf("Expected the original configuration to stay current")
+	}
+}
+
+func TestProxy_ReloadAllowedDomains(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	if rec := proxyGet(handler, upstream.URL); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 before reload, got %d", rec.Code)
+	}
+
+	next := config.NewDefaultConfig()
+	next.AllowedDomains = []string{"example.com"}
+	if _, err := handler.Settings().Reload(next); err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+
+	if rec := proxyGet(handler, upstream.URL); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 after reload, got %d", rec.Code)
+	}
+}
+
+func TestProxy_ReloadRateLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxConnections = 1
+	handler := newTestProxy(t, cfg)
+	chain := proxy.CreateMiddlewareChain(handler, cfg)
+
+	if limit := proxyGet(chain, upstream.URL).Header().Get("X-RateLimit-Limit"); limit != "60" {
+		t.Errorf("Expected limit 60 before reload, got %s", limit)
+	}
+
+	next := config.NewDefaultConfig()
+	next.MaxConnections = 2
+	if _, err := handler.Settings().Reload(next); err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+
+	if limit := proxyGet(chain, upstream.URL).Header().Get("X-RateLimit-Limit"); limit != "120" {
+		t.Errorf("Expected limit 120 after reload, got %s", limit)
+	}
+}
+
+func TestConfig_ReloadKeepsOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"cache_ttl": 100}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROXY_BLOCKED_DOMAINS", "blocked.example.com")
+	args := []string{"--config", path, "--allowed-domains", "example.com"}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		t.Fatalf("Expected configuration to load, got %v", err)
+	}
+	holder := config.NewHolder(cfg)
+
+	// The file doesn't mention the domains, so a reload must not reset them
+	if err := os.WriteFile(path, []byte(`{"cache_ttl": 200}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	next, err := config.Load(args)
+	if err != nil {
+		t.Fatalf("Expected configuration to reload, got %v", err)
+	}
+	current, err := holder.Reload(next)
+	if err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+
+	if current.CacheTTL != 200 {
+		t.Errorf("Expected cache TTL 200 from the file, got %d", current.CacheTTL)
+	}
+	if len(current.AllowedDomains) != 1 || current.AllowedDomains[0] != "example.com" {
+		t.Errorf("Expected allowed domains from the flags, got %v", current.AllowedDomains)
+	}
+	if len(current.BlockedDomains) != 1 || current.BlockedDomains[0] != "blocked.example.com" {
+		t.Errorf("Expected blocked domains from the environment, got %v", current.BlockedDomains)
+	}
+}
@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// flakyServer fails the first failures requests with the status and succeeds
+// afterwards, counting every request and recording the bodies it was sent
+func flakyServer(failures int32, status int, requests *atomic.Int32, bodies *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bodies != nil {
+			*bodies = append(*bodies, string(body))
+		}
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func retryConfig(maxRetries int) *config.Config {
+	cfg := config.NewDefaultConfig()
+	cfg.MaxRetries = maxRetries
+	cfg.RetryBackoff = 1
+	return cfg
+}
+
+func TestRetry_GetRetriedOnGatewayErrors(t *testing.T) {
+	var requests atomic.Int32
+	upstream := flakyServer(2, http.StatusServiceUnavailable, &requests, nil)
+	defer upstream.Close()
+
+	rec := proxyGet(newTestProxy(t, retryConfig(3)), upstream.URL)
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("Expected status 200 with body ok, got %d %q", rec.Code, rec.Body.String())
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Expected 3 upstream requests, got %d", requests.Load())
+	}
+}
+
+func TestRetry_GivesUpAfterMaxRetries(t *testing.T) {
+	var requests atomic.Int32
+	upstream := flakyServer(10, http.StatusBadGateway, &requests, nil)
+	defer upstream.Close()
+
+	rec := proxyGet(newTestProxy(t, retryConfig(2)), upstream.URL)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Expected 3 upstream requests, got %d", requests.Load())
+	}
+}
+
+func TestRetry_OtherStatusesNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	upstream := flakyServer(1, http.StatusInternalServerError, &requests, nil)
+	defer upstream.Close()
+
+	if rec := proxyGet(newTestProxy(t, retryConfig(3)), upstream.URL); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", requests.Load())
+	}
+}
+
+func TestRetry_PostNeverRetried(t *testing.T) {
+	var requests atomic.Int32
+	upstream := flakyServer(1, http.StatusServiceUnavailable, &requests, nil)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, retryConfig(3))
+	req := httptest.NewRequest(http.MethodPost, "/?url="+url.QueryEscape(upstream.URL), strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", requests.Load())
+	}
+}
+
+func TestRetry_BodyResentOnEveryAttempt(t *testing.T) {
+	var requests atomic.Int32
+	var bodies []string
+	upstream := flakyServer(1, http.StatusServiceUnavailable, &requests, &bodies)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, retryConfig(2))
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), strings.NewReader("query"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if len(bodies) != 2 || bodies[0] != "query" || bodies[1] != "query" {
+		t.Errorf("Expected the body on both attempts, got %q", bodies)
+	}
+}
+
+func TestRetry_BackoffBoundedByProxyTimeout(t *testing.T) {
+	var requests atomic.Int32
+	upstream := flakyServer(10, http.StatusServiceUnavailable, &requests, nil)
+	defer upstream.Close()
+
+	// The first backoff alone would outlast the proxy timeout
+	cfg := retryConfig(3)
+	cfg.RetryBackoff = 5000
+	cfg.ProxyTimeout = 1
+
+	start := time.Now()
+	if rec := proxyGet(newTestProxy(t, cfg), upstream.URL); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected no retry past the proxy timeout, took %v", elapsed)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", requests.Load())
+	}
+}
+
+func TestRetry_SlowAttemptsBoundedByProxyTimeout(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-time.After(900 * time.Millisecond):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	// Every attempt fits within the proxy timeout, but not two of them
+	cfg := retryConfig(3)
+	cfg.ProxyTimeout = 1
+
+	start := time.Now()
+	if rec := proxyGet(newTestProxy(t, cfg), upstream.URL); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Expected retries to stop at the proxy timeout, took %v", elapsed)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", requests.Load())
+	}
+}
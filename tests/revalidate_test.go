@@ -0,0 +1,403 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// etagServer answers 304 to requests carrying the current ETag and the full
+// body otherwise, recording the validators it was sent
+func etagServer(etag, body string, validators *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*validators = append(*validators, r.Header.Get("If-None-Match"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+// plantStale stores a response for the URL that went stale a minute ago
+func plantStale(t *testing.T, c cache.Cache, target, etag, body string) {
+	t.Helper()
+	plantEntry(t, c, target, &proxy.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {etag}, "Cache-Control": {"max-age=60"}},
+		Body:       []byte(body),
+		ETag:       etag,
+		FreshUntil: time.Now().Add(-time.Minute),
+	})
+}
+
+// plantEntry stores the response in the cache for the URL
+func plantEntry(t *testing.T, c cache.Cache, target string, resp *proxy.CachedResponse) {
+	t.Helper()
+	data, err := proxy.EncodeCachedResponse(resp)
+	if err != nil {
+		t.Fatalf("Expected encoding to succeed: %v", err)
+	}
+	c.Set("GET:"+target+"/", data, time.Hour)
+}
+
+func TestRevalidate_NotModifiedServesCachedBody(t *testing.T) {
+	var validators []string
+	upstream := etagServer(`"v1"`, "fresh", &validators)
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantStale(t, c, upstream.URL, `"v1"`, "cached")
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "REVALIDATED" {
+		t.Errorf("Expected X-Cache REVALIDATED, got %s", rec.Header().Get("X-Cache"))
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "cached" {
+		t.Errorf("Expected cached body with status 200, got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(validators) != 1 || validators[0] != `"v1"` {
+		t.Errorf("Expected upstream to be asked with If-None-Match \"v1\", got %v", validators)
+	}
+
+	// The entry is fresh again and served without asking the upstream
+	rec = proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "cached" {
+		t.Errorf("Expected HIT with cached body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if len(validators) != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", len(validators))
+	}
+}
+
+func TestRevalidate_ChangedContentReplacesEntry(t *testing.T) {
+	var validators []string
+	upstream := etagServer(`"v2"`, "updated", &validators)
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantStale(t, c, upstream.URL, `"v1"`, "cached")
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "updated" {
+		t.Errorf("Expected MISS with updated body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+
+	rec = proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "updated" {
+		t.Errorf("Expected HIT with updated body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
+
+func TestRevalidate_EntriesKeptPastFreshness(t *testing.T) {
+	var validators []string
+	upstream := etagServer(`"v1"`, "content", &validators)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.RevalidateWindow = 120
+	c := cache.NewLRUCache(10)
+	proxyGet(newTestProxyWithCache(t, cfg, c), upstream.URL)
+
+	item, found := c.Peek("GET:" + upstream.URL + "/")
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if retained := item.ExpiresAt.Sub(item.CreatedAt).Round(time.Second); retained != 180*time.Second {
+		t.Errorf("Expected entry to be retained for 180s, got %v", retained)
+	}
+}
+
+func TestRevalidate_NoCacheRevalidatesEveryUse(t *testing.T) {
+	requests, conditional := 0, 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	if rec := proxyGet(handler, upstream.URL); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected MISS, got %s", rec.Header().Get("X-Cache"))
+	}
+
+	// The stored copy is never served without asking the upstream first
+	for i := 0; i < 2; i++ {
+		rec := proxyGet(handler, upstream.URL)
+		if rec.Header().Get("X-Cache") != "REVALIDATED" || rec.Body.String() != "content" {
+			t.Errorf("Expected REVALIDATED with cached body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+	}
+	if requests != 3 || conditional != 2 {
+		t.Errorf("Expected 3 upstream requests of which 2 conditional, got %d and %d", requests, conditional)
+	}
+}
+
+func TestRevalidate_NoCacheWithoutValidatorsNotStored(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	proxyGet(newTestProxyWithCache(t, config.NewDefaultConfig(), c), upstream.URL)
+	if c.Size() != 0 {
+		t.Errorf("Expected no-cache response without validators not to be stored, got %d items", c.Size())
+	}
+}
+
+func TestRevalidate_NoCacheUpstreamDownIsMiss(t *testing.T) {
+	upstream := statusServer(http.StatusOK)
+	target := upstream.URL
+	upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, target, &proxy.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Cache-Control": {"no-cache"}},
+		Body:       []byte("cached"),
+		ETag:       `"v1"`,
+		FreshUntil: time.Now(),
+		NoCache:    true,
+	})
+
+	if rec := proxyGet(handler, target); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", rec.Code)
+	}
+}
+
+func TestRevalidate_StaleIfErrorServesStale(t *testing.T) {
+	upstream := statusServer(http.StatusServiceUnavailable)
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:   http.StatusOK,
+		Header:       http.Header{"Cache-Control": {"max-age=60, stale-if-error=300"}},
+		Body:         []byte("cached"),
+		FreshUntil:   time.Now().Add(-time.Minute),
+		StaleIfError: 300,
+	})
+
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "STALE" || rec.Code != http.StatusOK || rec.Body.String() != "cached" {
+		t.Errorf("Expected STALE 200 with cached body, got %s %d %q", rec.Header().Get("X-Cache"), rec.Code, rec.Body.String())
+	}
+}
+
+func TestRevalidate_MustRevalidateNeverServesStale(t *testing.T) {
+	upstream := statusServer(http.StatusServiceUnavailable)
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:     http.StatusOK,
+		Header:         http.Header{"Cache-Control": {"max-age=60, must-revalidate, stale-if-error=300"}},
+		Body:           []byte("cached"),
+		FreshUntil:     time.Now().Add(-time.Minute),
+		MustRevalidate: true,
+		StaleIfError:   300,
+	})
+
+	if rec := proxyGet(handler, upstream.URL); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the upstream's 503, got %d", rec.Code)
+	}
+}
+
+func TestRevalidate_StaleIfErrorExtendsRetention(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-if-error=900")
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	proxyGet(newTestProxyWithCache(t, config.NewDefaultConfig(), c), upstream.URL)
+
+	item, found := c.Peek("GET:" + upstream.URL + "/")
+	if !found {
+		t.Fatal("Expected response to be cached")
+	}
+	if retained := item.ExpiresAt.Sub(item.CreatedAt).Round(time.Second); retained != 960*time.Second {
+		t.Errorf("Expected entry to be retained for 960s, got %v", retained)
+	}
+}
+
+func TestRevalidate_StaleWhileRevalidateRefreshesInBackground(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("updated"))
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:           http.StatusOK,
+		Header:               http.Header{"Cache-Control": {"max-age=60, stale-while-revalidate=300"}},
+		Body:                 []byte("cached"),
+		FreshUntil:           time.Now().Add(-time.Minute),
+		StaleWhileRevalidate: 300,
+	})
+
+	// Every hit is answered right away from the stale entry
+	for i := 0; i < 3; i++ {
+		rec := proxyGet(handler, upstream.URL)
+		if rec.Header().Get("X-Cache") != "STALE" || rec.Body.String() != "cached" {
+			t.Errorf("Expected STALE with cached body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+	}
+
+	// Only a single refresh was started for the key
+	waitFor(t, time.Second, func() bool { return requests.Load() == 1 })
+	close(release)
+
+	waitFor(t, time.Second, func() bool {
+		return proxyGet(handler, upstream.URL).Header().Get("X-Cache") == "HIT"
+	})
+	if rec := proxyGet(handler, upstream.URL); rec.Body.String() != "updated" {
+		t.Errorf("Expected refreshed body, got %q", rec.Body.String())
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", requests.Load())
+	}
+}
+
+func TestRevalidate_ShutdownWaitsForBackgroundRefresh(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("updated"))
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:           http.StatusOK,
+		Header:               http.Header{"Cache-Control": {"max-age=60, stale-while-revalidate=300"}},
+		Body:                 []byte("cached"),
+		FreshUntil:           time.Now().Add(-time.Minute),
+		StaleWhileRevalidate: 300,
+	})
+	proxyGet(handler, upstream.URL)
+	waitFor(t, time.Second, func() bool { return requests.Load() == 1 })
+
+	stopped := make(chan struct{})
+	go func() {
+		handler.Shutdown()
+		close(stopped)
+	}()
+
+	// Shutdown returns only once the refresh is done writing to the cache
+	select {
+	case <-stopped:
+		t.Error("Expected shutdown to wait for the running refresh")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+
+	item, found := c.Get("GET:" + upstream.URL + "/")
+	if !found {
+		t.Fatal("Expected the refreshed entry in the cache")
+	}
+	resp, err := proxy.DecodeCachedResponse(item.Value)
+	if err != nil || string(resp.Body) != "updated" {
+		t.Errorf("Expected refreshed body in the cache, got %v, %v", resp, err)
+	}
+}
+
+func TestRevalidate_StaleWhileRevalidateWindowElapsed(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:           http.StatusOK,
+		Header:               http.Header{},
+		Body:                 []byte("cached"),
+		FreshUntil:           time.Now().Add(-time.Hour),
+		StaleWhileRevalidate: 60,
+	})
+
+	// Past the window the entry is refetched in the foreground
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "content" {
+		t.Errorf("Expected MISS with upstream body, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
+
+func TestRevalidate_StaleWhileRevalidateAppliesResponseRules(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Server", "upstream/1.0")
+		w.Header().Set("Vary", "X-Variant")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("updated"))
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.HeaderRules = []config.HeaderRule{{RemoveResponseHeaders: []string{"Server"}}}
+	c := cache.NewLRUCache(10)
+	handler := newTestProxyWithCache(t, cfg, c)
+	plantEntry(t, c, upstream.URL, &proxy.CachedResponse{
+		StatusCode:           http.StatusOK,
+		Header:               http.Header{"Cache-Control": {"max-age=60, stale-while-revalidate=300"}},
+		Body:                 []byte("cached"),
+		FreshUntil:           time.Now().Add(-time.Minute),
+		StaleWhileRevalidate: 300,
+	})
+
+	if rec := proxyGet(handler, upstream.URL); rec.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("Expected X-Cache STALE, got %s", rec.Header().Get("X-Cache"))
+	}
+	waitFor(t, time.Second, func() bool {
+		return proxyGet(handler, upstream.URL).Body.String() == "updated"
+	})
+
+	// The refreshed entry went through the same rules as a miss would
+	rec := proxyGet(handler, upstream.URL)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected X-Cache HIT, got %s", rec.Header().Get("X-Cache"))
+	}
+	if server := rec.Header().Get("Server"); server != "" {
+		t.Errorf("Expected the Server header to be stripped, got %q", server)
+	}
+
+	// Its Vary header was recorded, so another variant isn't served from it
+	if rec := proxyGetWithHeader(handler, upstream.URL, "X-Variant", "other"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected a different variant to miss, got %s", rec.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+)
+
+// The sharded cache can stand in for any other cache
+var _ cache.Cache = (*cache.ShardedLRUCache)(nil)
+
+func TestShardedLRUCache_SetGetRemove(t *testing.T) {
+	c := cache.NewShardedLRUCache(100, 8)
+
+	if !c.Set("key", []byte("value"), 0) {
+		t.Error("Expected Set to add a new item")
+	}
+	item, found := c.Get("key")
+	if !found || string(item.Value) != "value" {
+		t.Fatalf("Expected to get value, got %v (found %v)", item, found)
+	}
+	if !c.Remove("key") {
+		t.Error("Expected Remove to find the item")
+	}
+	if _, found := c.Get("key"); found {
+		t.Error("Expected item to be gone after Remove")
+	}
+}
+
+func TestShardedLRUCache_CapacitySplitAcrossShards(t *testing.T) {
+	c := cache.NewShardedLRUCache(100, 8)
+	if c.Capacity() != 100 {
+		t.Errorf("Expected capacity 100, got %d", c.Capacity())
+	}
+
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("value"), 0)
+	}
+	if size := c.Size(); size > 100 {
+		t.Errorf("Expected at most 100 items, got %d", size)
+	}
+	if keys := c.Keys(); len(keys) != c.Size() {
+		t.Errorf("Expected %d keys, got %d", c.Size(), len(keys))
+	}
+}
+
+func TestShardedLRUCache_StatsAggregateShards(t *testing.T) {
+	c := cache.NewShardedLRUCache(100, 4)
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key%d", i), []byte("12345"), 0)
+	}
+	for i := 0; i < 20; i++ {
+		c.Get(fmt.Sprintf("key%d", i))
+	}
+
+	stats := c.Stats()
+	if stats.Size != 10 || stats.Hits != 10 || stats.Misses != 10 {
+		t.Errorf("Expected size 10, 10 hits and 10 misses, got %+v", stats)
+	}
+	if stats.HitRate != 0.5 {
+		t.Errorf("Expected hit rate 0.5, got %g", stats.HitRate)
+	}
+	if stats.AvgSize != 5 {
+		t.Errorf("Expected average size 5, got %d", stats.AvgSize)
+	}
+
+	c.ResetStats()
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Expected counters to be reset, got %+v", stats)
+	}
+}
+
+// benchmarkContended runs mostly reads with some writes against the cache
+// from all benchmark goroutines at once
+func benchmarkContended(b *testing.B, c cache.Cache) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		c.Set(keys[i], []byte("value"), 0)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := keys[rand.IntN(len(keys))]
+			if rand.IntN(10) == 0 {
+				c.Set(key, []byte("value"), 0)
+			} else {
+				c.Get(key)
+			}
+		}
+	})
+}
+
+func BenchmarkLRUCache_Contended(b *testing.B) {
+	benchmarkContended(b, cache.NewLRUCache(1000))
+}
+
+func BenchmarkShardedLRUCache_Contended(b *testing.B) {
+	benchmarkContended(b, cache.NewShardedLRUCache(1000, 16))
+}
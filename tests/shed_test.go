@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestLoadShedder_ShedsByPriority(t *testing.T) {
+	s := proxy.NewLoadShedder(proxy.ShedOptions{Threshold: 0.5, Fraction: 0}, func() float64 { return 0.8 })
+	defer s.Stop()
+
+	waitFor(t, time.Second, func() bool { return s.Pressure() >= 0.5 })
+
+	if !s.Shed(proxy.PriorityLow) {
+		t.Error("Expected low priority request to be shed under pressure")
+	}
+	if s.Shed(proxy.PriorityNormal) {
+		t.Error("Expected normal priority request to be kept with a zero shed fraction")
+	}
+	if s.Shed(proxy.PriorityHigh) {
+		t.Error("Expected high priority request never to be shed")
+	}
+	if s.ShedCount() != 1 {
+		t.Errorf("Expected 1 shed request, got %d", s.ShedCount())
+	}
+}
+
+func TestLoadShedder_StopTwice(t *testing.T) {
+	s := proxy.NewLoadShedder(proxy.ShedOptions{Threshold: 0.5}, func() float64 { return 0 })
+	s.Stop()
+
+	// A second stop, e.g. from a deferred cleanup, must not panic
+	s.Stop()
+}
+
+func TestProxy_ShutdownTwice(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.ShedThreshold = 0.5
+	handler := newTestProxy(t, cfg)
+
+	// newTestProxy shuts the handler down again when the test ends
+	handler.Shutdown()
+}
+
+func TestLoadShedder_ErrorRateRaisesPressure(t *testing.T) {
+	s := proxy.NewLoadShedder(proxy.ShedOptions{Threshold: 0.5, Fraction: 1}, func() float64 { return 0 })
+	defer s.Stop()
+
+	for i := 0; i < 30; i++ {
+		s.RecordResult(i%3 != 0)
+	}
+	waitFor(t, time.Second, func() bool { return s.Pressure() > 0.5 })
+
+	if !s.Shed(proxy.PriorityNormal) {
+		t.Error("Expected normal priority request to be shed with a full shed fraction")
+	}
+}
+
+func TestProxy_ShedsLowPriorityWhenOverloaded(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxConnections = 1
+	cfg.ShedThreshold = 0.5
+	cfg.ShedRetryAfter = 7
+	cfg.PriorityHeader = "X-Priority"
+	handler := newTestProxy(t, cfg)
+
+	// Keep the only worker busy and fill its queue
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(release)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxyGet(handler, upstream.URL)
+		}()
+		if i == 0 {
+			<-started
+		}
+	}
+	waitFor(t, time.Second, func() bool { return handler.LoadPressure() >= cfg.ShedThreshold })
+
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("X-Priority", "low")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "7" {
+		t.Errorf("Expected Retry-After 7, got %q", rec.Header().Get("Retry-After"))
+	}
+	if handler.ShedRequests() != 1 {
+		t.Errorf("Expected 1 shed request, got %d", handler.ShedRequests())
+	}
+}
+
+func TestProxy_FullQueueReturnsServiceUnavailable(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxConnections = 1
+	cfg.QueueFullTimeout = 50
+	handler := newTestProxy(t, cfg)
+
+	// Keep the only worker busy, then flood the pool; every request must be
+	// done before the handler shuts down
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(release)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		proxyGet(handler, upstream.URL)
+	}()
+	<-started
+
+	const flood = 10
+	codes := make(chan *httptest.ResponseRecorder, flood)
+	for i := 0; i < flood; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- proxyGet(handler, upstream.URL)
+		}()
+	}
+
+	// The queue holds two requests, everything beyond it is turned away
+	rejected := 0
+	timeout := time.After(2 * time.Second)
+	for rejected < flood-2 {
+		select {
+		case rec := <-codes:
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Expected status 503, got %d", rec.Code)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Errorf("Expected a Retry-After header")
+			}
+			rejected++
+		case <-timeout:
+			t.Fatalf("Expected excess requests to be rejected, only %d of %d were", rejected, flood-2)
+		}
+	}
+
+	if got := handler.Stats().RejectedRequests; got != flood-2 {
+		t.Errorf("Expected %d rejected requests in stats, got %d", flood-2, got)
+	}
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestTieredCache_PopulatesL1FromL2(t *testing.T) {
+	l1, l2 := cache.NewLRUCache(10), cache.NewLRUCache(100)
+	c := cache.NewTieredCache(l1, l2)
+
+	l2.Set("key", []byte("value"), time.Minute)
+
+	item, found := c.Get("key")
+	if !found || string(item.Value) != "value" {
+		t.Fatalf("Expected to find key in L2")
+	}
+
+	copied, found := l1.Peek("key")
+	if !found {
+		t.Fatalf("Expected key to be copied into L1")
+	}
+	if drift := copied.ExpiresAt.Sub(item.ExpiresAt); drift < 0 || drift > 10*time.Millisecond {
+		t.Errorf("Expected L1 copy to expire along with L2 at %v, got %v", item.ExpiresAt, copied.ExpiresAt)
+	}
+
+	c.Get("key")
+	stats := c.Stats()
+	if stats.L1Hits != 1 || stats.L2Hits != 1 || stats.Hits != 2 {
+		t.Errorf("Expected 1 L1 hit, 1 L2 hit and 2 hits, got %d, %d and %d", stats.L1Hits, stats.L2Hits, stats.Hits)
+	}
+}
+
+func TestTieredCache_WritesBothTiers(t *testing.T) {
+	l1, l2 := cache.NewLRUCache(10), cache.NewLRUCache(100)
+	c := cache.NewTieredCache(l1, l2)
+
+	if !c.Set("key", []byte("value"), 0) {
+		t.Errorf("Expected Set to report a new item")
+	}
+	if _, found := l1.Peek("key"); !found {
+		t.Errorf("Expected key in L1")
+	}
+	if _, found := l2.Peek("key"); !found {
+		t.Errorf("Expected key in L2")
+	}
+
+	if !c.Remove("key") {
+		t.Errorf("Expected Remove to find key")
+	}
+	if l1.Size() != 0 || l2.Size() != 0 {
+		t.Errorf("Expected both tiers empty, got sizes %d and %d", l1.Size(), l2.Size())
+	}
+
+	c.Set("a", []byte("1"), 0)
+	c.Clear()
+	if l1.Size() != 0 || l2.Size() != 0 {
+		t.Errorf("Expected both tiers empty after Clear, got sizes %d and %d", l1.Size(), l2.Size())
+	}
+}
+
+func TestTieredCache_MissAndStats(t *testing.T) {
+	l1, l2 := cache.NewLRUCache(10), cache.NewLRUCache(100)
+	c := cache.NewTieredCache(l1, l2)
+
+	if _, found := c.Get("missing"); found {
+		t.Errorf("Expected a miss")
+	}
+	if _, found := l1.Peek("missing"); found {
+		t.Errorf("Expected a miss not to populate L1")
+	}
+
+	stats := c.Stats()
+	if stats.Misses != 1 || stats.Hits != 0 {
+		t.Errorf("Expected 1 miss and 0 hits, got %d and %d", stats.Misses, stats.Hits)
+	}
+	if stats.Capacity != 100 {
+		t.Errorf("Expected the capacity of L2, got %d", stats.Capacity)
+	}
+
+	c.ResetStats()
+	if stats := c.Stats(); stats.Misses != 0 {
+		t.Errorf("Expected misses reset, got %d", stats.Misses)
+	}
+}
+
+func TestTieredCache_L1CanBeStale(t *testing.T) {
+	l1, l2 := cache.NewLRUCache(10), cache.NewLRUCache(100)
+	c := cache.NewTieredCache(l1, l2)
+
+	c.Set("key", []byte("old"), 0)
+
+	// Another instance replaces the shared copy
+	l2.Set("key", []byte("new"), 0)
+
+	if item, _ := c.Get("key"); string(item.Value) != "old" {
+		t.Errorf("Expected the local copy to be served, got %s", item.Value)
+	}
+}
+
+func TestProxy_TieredCacheServesHits(t *testing.T) {
+	upstream := maxAgeServer(60)
+	defer upstream.Close()
+
+	l1, l2 := cache.NewLRUCache(10), cache.NewLRUCache(100)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), cache.NewTieredCache(l1, l2))
+
+	proxyGet(handler, upstream.URL)
+
+	// Another instance starts with an empty local cache
+	l1.Clear()
+	if rec := proxyGet(handler, upstream.URL); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected a hit from L2, got %s", rec.Header().Get("X-Cache"))
+	}
+	if l1.Size() != 1 {
+		t.Errorf("Expected the hit to populate L1, got size %d", l1.Size())
+	}
+}
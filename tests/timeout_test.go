@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+func TestTimeout_AbortsSlowUpstream(t *testing.T) {
+	canceled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+			w.Write([]byte("too late"))
+		}
+	}))
+	defer upstream.Close()
+
+	handler := proxy.Timeout(200 * time.Millisecond)(newTestProxy(t, nil))
+
+	start := time.Now()
+	rec := proxyGet(handler, upstream.URL)
+	elapsed := time.Since(start)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	if elapsed > time.Second {
+		t.Errorf("Expected the request to end at the deadline, took %v", elapsed)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the upstream request to be canceled")
+	}
+}
+
+func TestTimeout_FastRequestPassesThrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		w.Write([]byte("quick"))
+	}))
+	defer upstream.Close()
+
+	handler := proxy.Timeout(time.Second)(newTestProxy(t, nil))
+	rec := proxyGet(handler, upstream.URL)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "quick" {
+		t.Errorf("Expected body 'quick', got %q", rec.Body.String())
+	}
+	if rec.Header().Get("X-Upstream") != "yes" {
+		t.Errorf("Expected upstream header to be copied, got %q", rec.Header().Get("X-Upstream"))
+	}
+}
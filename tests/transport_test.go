@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+// newCountingUpstream starts a keep-alive upstream that counts the
+// connections opened to it
+func newCountingUpstream(t testing.TB) (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	upstream.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+	return upstream, &conns
+}
+
+// proxyConcurrently sends rounds of concurrent uncached requests through the handler
+func proxyConcurrently(handler http.Handler, target string, rounds, concurrency int) {
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				proxyGet(handler, fmt.Sprintf("%s/?round=%d&i=%d", target, round, i))
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+func TestProxy_ReusesUpstreamConnections(t *testing.T) {
+	upstream, conns := newCountingUpstream(t)
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxIdleConnsPerHost = 16
+	handler := newTestProxy(t, cfg)
+
+	proxyConcurrently(handler, upstream.URL, 5, 16)
+
+	if got := conns.Load(); got > 16 {
+		t.Errorf("Expected at most 16 upstream connections, got %d", got)
+	}
+}
+
+func TestConfig_ConnectionPoolValidation(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.MaxConnsPerHost = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for negative max conns per host")
+	}
+
+	cfg = config.NewDefaultConfig()
+	cfg.TLSHandshakeTimeout = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for negative TLS handshake timeout")
+	}
+}
+
+// benchmarkUpstreamConnections reports how many upstream connections the
+// proxy opens per request with the given idle pool size per host
+func benchmarkUpstreamConnections(b *testing.B, idlePerHost int) {
+	upstream, conns := newCountingUpstream(b)
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxIdleConnsPerHost = idlePerHost
+	handler := newTestProxy(b, cfg)
+
+	b.ResetTimer()
+	proxyConcurrently(handler, upstream.URL, b.N, 16)
+	b.ReportMetric(float64(conns.Load())/float64(b.N*16), "conns/req")
+}
+
+func BenchmarkProxy_UpstreamDefaultIdlePool(b *testing.B) {
+	benchmarkUpstreamConnections(b, 2)
+}
+
+func BenchmarkProxy_UpstreamTunedIdlePool(b *testing.B) {
+	benchmarkUpstreamConnections(b, 64)
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_CacheTTLJitter(t *testing.T) {
+	tests := []struct {
+		random   float64
+		expected string
+	}{
+		{0, "max-age=90"},
+		{0.5, "max-age=100"},
+		{0.75, "max-age=105"},
+	}
+
+	for _, tt := range tests {
+		upstream := maxAgeServer(100)
+
+		cfg := config.NewDefaultConfig()
+		cfg.CacheTTLJitter = 0.1
+		handler := newTestProxy(t, cfg)
+		handler.SetRandomSource(func() float64 { return tt.random })
+
+		proxyGet(handler, upstream.URL)
+		rec := proxyGet(handler, upstream.URL)
+		upstream.Close()
+
+		if rec.Header().Get("X-Cache") != "HIT" {
+			t.Fatalf("Expected cache hit, got %s", rec.Header().Get("X-Cache"))
+		}
+		if cc := rec.Header().Get("Cache-Control"); cc != tt.expected {
+			t.Errorf("Expected %s with random value %g, got %s", tt.expected, tt.random, cc)
+		}
+	}
+}
+
+func TestProxy_CacheTTLJitterDisabledByDefault(t *testing.T) {
+	upstream := maxAgeServer(100)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	handler.SetRandomSource(func() float64 { return 0 })
+
+	proxyGet(handler, upstream.URL)
+	rec := proxyGet(handler, upstream.URL)
+
+	if cc := rec.Header().Get("Cache-Control"); cc != "max-age=100" {
+		t.Errorf("Expected max-age=100 without jitter, got %s", cc)
+	}
+}
+
+func TestConfig_CacheTTLJitterValidation(t *testing.T) {
+	for _, jitter := range []float64{-0.1, 1, 1.5} {
+		cfg := config.NewDefaultConfig()
+		cfg.CacheTTLJitter = jitter
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for cache TTL jitter %g", jitter)
+		}
+	}
+}
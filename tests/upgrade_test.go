@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// echoUpgradeServer accepts any upgrade and echoes back whatever it receives
+func echoUpgradeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Connection") != "Upgrade" {
+			http.Error(w, "Expected upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Expected upstream hijack to succeed: %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", r.Header.Get("Upgrade"))
+		buf.Flush()
+		io.Copy(conn, buf)
+	}))
+}
+
+// dialUpgrade sends an upgrade request through the proxy server and returns
+// the connection along with the proxy's response
+func dialUpgrade(t *testing.T, proxyURL, target, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyURL[len("http://"):])
+	if err != nil {
+		t.Fatalf("Expected to connect to proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /?url=%s HTTP/1.1\r\nHost: proxy\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", url.QueryEscape(target), protocol)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Expected upgrade response: %v", err)
+	}
+	return conn, reader, resp
+}
+
+func TestUpgrade_WebSocketTunneled(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	defer upstream.Close()
+
+	// Go through the middleware chain, whose writers must still allow hijacking
+	cfg := config.NewDefaultConfig()
+	server := httptest.NewServer(proxy.CreateMiddlewareChain(newTestProxy(t, cfg), cfg))
+	defer server.Close()
+
+	conn, reader, resp := dialUpgrade(t, server.URL, upstream.URL, "websocket")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Upgrade") != "websocket" {
+		t.Errorf("Expected Upgrade: websocket, got %q", resp.Header.Get("Upgrade"))
+	}
+
+	// Bytes flow through the tunnel in both directions
+	conn.Write([]byte("ping"))
+	echoed := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echoed); err != nil {
+		t.Fatalf("Expected echoed data: %v", err)
+	}
+	if string(echoed) != "ping" {
+		t.Errorf("Expected ping to be echoed, got %q", echoed)
+	}
+}
+
+func TestUpgrade_UnknownProtocolRejected(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+	req := httptest.NewRequest(http.MethodGet, "/?url="+url.QueryEscape(upstream.URL), nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "custom-proto")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", rec.Code)
+	}
+}
+
+func TestUpgrade_UnknownProtocolTunneledWhenEnabled(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.TunnelAllUpgrades = true
+	server := httptest.NewServer(newTestProxy(t, cfg))
+	defer server.Close()
+
+	_, _, resp := dialUpgrade(t, server.URL, upstream.URL, "custom-proto")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected status 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Upgrade") != "custom-proto" {
+		t.Errorf("Expected Upgrade: custom-proto, got %q", resp.Header.Get("Upgrade"))
+	}
+}
+
+func TestTunnelLimiter_PerIPCap(t *testing.T) {
+	limiter := proxy.NewTunnelLimiter(3, 2)
+
+	if !limiter.Acquire("192.0.2.1") || !limiter.Acquire("192.0.2.1") {
+		t.Fatal("Expected first two tunnels for an IP to be allowed")
+	}
+	if limiter.Acquire("192.0.2.1") {
+		t.Error("Expected third tunnel for the same IP to be rejected")
+	}
+	if !limiter.Acquire("192.0.2.2") {
+		t.Error("Expected tunnel for another IP to be allowed")
+	}
+	if limiter.Acquire("192.0.2.3") {
+		t.Error("Expected tunnel beyond the global cap to be rejected")
+	}
+
+	limiter.Release("192.0.2.1")
+	if limiter.Active() != 2 {
+		t.Errorf("Expected 2 active tunnels, got %d", limiter.Active())
+	}
+	if !limiter.Acquire("192.0.2.1") {
+		t.Error("Expected released slot to be reusable")
+	}
+}
+
+func TestTunnelLimiter_ReportsMetrics(t *testing.T) {
+	metrics := proxy.NewPrometheusMetrics()
+	limiter := proxy.NewTunnelLimiter(2, 0)
+	limiter.SetMetrics(metrics)
+
+	limiter.Acquire("192.0.2.1")
+	limiter.Acquire("192.0.2.2")
+	limiter.Acquire("192.0.2.3")
+	limiter.Release("192.0.2.1")
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"proxy_active_tunnels 1",
+		"proxy_tunnel_rejections_total 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestUpgrade_TunnelCapRejectsWith503(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	defer upstream.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.MaxTunnels = 1
+	handler := newTestProxy(t, cfg)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, _, resp := dialUpgrade(t, server.URL, upstream.URL, "websocket")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected first tunnel to open, got %d", resp.StatusCode)
+	}
+	if handler.ActiveTunnels() != 1 {
+		t.Errorf("Expected 1 active tunnel, got %d", handler.ActiveTunnels())
+	}
+
+	if _, _, resp := dialUpgrade(t, server.URL, upstream.URL, "websocket"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 at the tunnel cap, got %d", resp.StatusCode)
+	}
+
+	// Closing the tunnel frees its slot
+	conn.Close()
+	waitFor(t, time.Second, func() bool { return handler.ActiveTunnels() == 0 })
+	if _, _, resp := dialUpgrade(t, server.URL, upstream.URL, "websocket"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected tunnel to open after the previous one closed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_ChainsThroughUpstreamProxy(t *testing.T) {
+	var gotURL, gotAuth string
+	chained := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		gotAuth = r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("via upstream proxy"))
+	}))
+	defer chained.Close()
+
+	cfg := config.NewDefaultConfig()
+	cfg.UpstreamProxyURL = strings.Replace(chained.URL, "http://", "http://user:secret@", 1)
+	handler := newTestProxy(t, cfg)
+
+	rec := proxyGet(handler, "http://origin.example/page")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "via upstream proxy" {
+		t.Errorf("Expected body from upstream proxy, got %q", rec.Body.String())
+	}
+	if gotURL != "http://origin.example/page" {
+		t.Errorf("Expected absolute-form request URL, got %q", gotURL)
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if gotAuth != want {
+		t.Errorf("Expected Proxy-Authorization %q, got %q", want, gotAuth)
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Jovial-Kanwadia/proxy-server/cache"
+	"github.com/Jovial-Kanwadia/proxy-server/config"
+)
+
+func TestProxy_VaryCachesVariantsSeparately(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Write([]byte("variant-" + r.Header.Get("Accept-Encoding")))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, nil)
+
+	for _, encoding := range []string{"gzip", "identity"} {
+		rec := proxyGetWithHeader(handler, upstream.URL, "Accept-Encoding", encoding)
+		if rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("Expected X-Cache MISS for %s, got %s", encoding, rec.Header().Get("X-Cache"))
+		}
+		if rec.Body.String() != "variant-"+encoding {
+			t.Errorf("Expected body variant-%s, got %q", encoding, rec.Body.String())
+		}
+	}
+
+	// Each client gets its own variant back from the cache
+	for _, encoding := range []string{"gzip", "identity"} {
+		rec := proxyGetWithHeader(handler, upstream.URL, "Accept-Encoding", encoding)
+		if rec.Header().Get("X-Cache") != "HIT" {
+			t.Errorf("Expected X-Cache HIT for %s, got %s", encoding, rec.Header().Get("X-Cache"))
+		}
+		if rec.Body.String() != "variant-"+encoding {
+			t.Errorf("Expected body variant-%s, got %q", encoding, rec.Body.String())
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", n)
+	}
+}
+
+func TestProxy_VaryStarIsNotCached(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "*")
+		w.Write([]byte("fresh"))
+	}))
+	defer upstream.Close()
+
+	handler := newTestProxy(t, config.NewDefaultConfig())
+	proxyGet(handler, upstream.URL)
+	rec := proxyGet(handler, upstream.URL)
+
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected X-Cache MISS, got %s", rec.Header().Get("X-Cache"))
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Expected 2 upstream requests, got %d", n)
+	}
+}
+
+func TestProxy_VaryListKeptOutOfResponseCache(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte("variant-" + r.Header.Get("Accept-Language")))
+	}))
+	defer upstream.Close()
+
+	c := cache.NewLRUCache(1)
+	handler := newTestProxyWithCache(t, config.NewDefaultConfig(), c)
+	proxyGetWithHeader(handler, upstream.URL, "Accept-Language", "en")
+
+	// The only entry is the variant itself, which a full cache doesn't evict
+	if keys := c.Keys(); len(keys) != 1 || strings.HasPrefix(keys[0], "vary|") {
+		t.Errorf("Expected only the variant in the cache, got %v", keys)
+	}
+	rec := proxyGetWithHeader(handler, upstream.URL, "Accept-Language", "en")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != "variant-en" {
+		t.Errorf("Expected HIT for variant-en, got %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+}
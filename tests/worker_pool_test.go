@@ -0,0 +1,387 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jovial-Kanwadia/proxy-server/proxy"
+)
+
+// waitFor polls the condition until it holds or the timeout elapses
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPool_PriorityOrder(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+	defer pool.Stop(context.Background())
+
+	// Occupy the only worker so that further jobs queue up
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	<-started
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	enqueue := func(name string, priority proxy.Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+			})
+			pool.EnqueueWithPriority(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), handler, priority)
+		}()
+	}
+
+	// Saturate the queue with a low priority job first, then a high priority one
+	enqueue("low", proxy.PriorityLow)
+	waitFor(t, time.Second, func() bool { return pool.QueueLength() == 1 })
+	enqueue("high", proxy.PriorityHigh)
+	waitFor(t, time.Second, func() bool { return pool.QueueLength() == 2 })
+
+	close(release)
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "high" || order[1] != "low" {
+		t.Errorf("Expected high priority job to be served first, got %v", order)
+	}
+}
+
+func TestWorkerPool_EnqueueCanceledContext(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+	defer pool.Stop(context.Background())
+
+	// Occupy the only worker so the canceled job can't be picked up
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected canceled job not to run")
+	})
+	err := pool.Enqueue(ctx, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), handler)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWorkerPool_EnqueueDeadlineWhileQueued(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+	defer pool.Stop(context.Background())
+
+	// Occupy the only worker so that the next job stays queued
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	<-started
+
+	ran := make(chan struct{}, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ran <- struct{}{} })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := pool.Enqueue(ctx, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), handler)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Enqueue to return at the deadline, took %v", elapsed)
+	}
+
+	// Once the worker frees up, the abandoned job is skipped
+	close(release)
+	waitFor(t, time.Second, func() bool { return pool.QueueLength() == 0 })
+	done := make(chan struct{})
+	pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { close(done) }))
+	<-done
+	select {
+	case <-ran:
+		t.Error("Expected job abandoned in the queue not to run")
+	default:
+	}
+}
+
+func TestWorkerPool_SkipsAbandonedRequest(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+	defer pool.Stop(context.Background())
+
+	// The request's own context is already canceled, the enqueuer's isn't
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	// Depending on who notices first, the job is dropped by the enqueuer or skipped by the worker
+	if err := pool.Enqueue(context.Background(), httptest.NewRecorder(), req, handler); err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected no error or context.Canceled, got %v", err)
+	}
+	if called {
+		t.Errorf("Expected the abandoned request to be skipped")
+	}
+}
+
+func TestWorkerPool_RejectsWhenQueueFull(t *testing.T) {
+	pool := proxy.NewWorkerPoolWithTimeout(1, 50*time.Millisecond)
+	defer pool.Stop(context.Background())
+
+	// Occupy the only worker and fill the queue behind it
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(release)
+	enqueue := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+		}()
+	}
+	enqueue()
+	<-started
+	for i := 0; i < pool.QueueCapacity(); i++ {
+		enqueue()
+	}
+	waitFor(t, time.Second, func() bool { return pool.QueueLength() == pool.QueueCapacity() })
+
+	start := time.Now()
+	err := pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	if !errors.Is(err, proxy.ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the rejection after the full timeout, took %v", elapsed)
+	}
+	if pool.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected job, got %d", pool.Rejected())
+	}
+}
+
+func TestWorkerPool_EnqueueReturnsWhenClientLeaves(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+	defer pool.Stop(context.Background())
+
+	// Occupy the only worker so the job stays queued
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	<-started
+
+	// Only the request's own context is canceled, not the one passed to Enqueue
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected abandoned job not to run")
+	})
+	start := time.Now()
+	err := pool.Enqueue(context.Background(), httptest.NewRecorder(), req, handler)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Enqueue to return once the client left, took %v", elapsed)
+	}
+}
+
+func TestWorkerPool_AutoScaling(t *testing.T) {
+	pool := proxy.NewWorkerPoolWithOptions(proxy.WorkerPoolOptions{
+		MinWorkers:  1,
+		MaxWorkers:  4,
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	defer pool.Stop(context.Background())
+
+	if pool.Workers() != 1 {
+		t.Fatalf("Expected to start with 1 worker, got %d", pool.Workers())
+	}
+
+	// Queue up more jobs than the minimum can take on
+	release := make(chan struct{})
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+		}()
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return pool.Workers() == 4 })
+	close(release)
+	wg.Wait()
+
+	// Idle workers retire down to the minimum
+	waitFor(t, 2*time.Second, func() bool { return pool.Workers() == 1 })
+}
+
+func TestWorkerPool_AutoScalingStopsCleanly(t *testing.T) {
+	pool := proxy.NewAutoScalingWorkerPool(1, 3)
+
+	var (
+		mu        sync.Mutex
+		processed int
+		wg        sync.WaitGroup
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		processed++
+		mu.Unlock()
+	})
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), handler)
+		}()
+	}
+	wg.Wait()
+	pool.Stop(context.Background())
+
+	if processed != 6 {
+		t.Errorf("Expected all 6 jobs to be processed, got %d", processed)
+	}
+	if pool.Workers() != 0 {
+		t.Errorf("Expected no workers after Stop, got %d", pool.Workers())
+	}
+}
+
+func TestWorkerPool_StopGivesUpAtDeadline(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+
+	// A job that never finishes on its own
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	stuck := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	go pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), stuck)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := pool.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Stop to return at the deadline, took %v", elapsed)
+	}
+}
+
+func TestWorkerPool_EnqueueAfterStop(t *testing.T) {
+	pool := proxy.NewWorkerPool(1)
+
+	// Occupy the only worker and fill the queue behind it
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	blocker := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	var wg sync.WaitGroup
+	enqueue := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+		}()
+	}
+	enqueue()
+	<-started
+	for i := 0; i < pool.QueueCapacity(); i++ {
+		enqueue()
+	}
+	waitFor(t, time.Second, func() bool { return pool.QueueLength() == pool.QueueCapacity() })
+
+	// This one waits for a queue slot while the pool stops
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	pool.Stop(ctx)
+
+	// Draining the queue frees a slot, which must not let the job in
+	close(release)
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, proxy.ErrPoolStopped) {
+			t.Errorf("Expected ErrPoolStopped for the waiting job, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting job to be turned away")
+	}
+	wg.Wait()
+
+	err := pool.Enqueue(context.Background(), httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), blocker)
+	if !errors.Is(err, proxy.ErrPoolStopped) {
+		t.Errorf("Expected ErrPoolStopped after stop, got %v", err)
+	}
+}